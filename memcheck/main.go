@@ -0,0 +1,70 @@
+package main
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/edac"
+	"app/pkg/memcheck"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes for detected memory errors
+const (
+	exitCorruption = 2 // data read back differently than written
+	exitECCErrors  = 3 // no corruption, but ECC error counters increased
+)
+
+func main() {
+	// Create default config
+	config := memcheck.NewDefaultConfig()
+
+	// Parse command-line flags
+	flag.Float64Var(&config.Fraction, "fraction", config.Fraction, "Fraction of available memory to test")
+	flag.IntVar(&config.SizeInMB, "size", config.SizeInMB, "Size of memory to test in MB (overrides -fraction)")
+	flag.IntVar(&config.Passes, "passes", config.Passes, "Number of passes over all tests")
+	flag.IntVar(&config.Threads, "threads", config.Threads, "Number of threads to use")
+	flag.Var(&config.Alloc, "alloc", "Buffer allocation strategy: "+alloc.StrategyNames())
+	flag.BoolVar(&config.Lock, "lock", config.Lock, "mlock the test buffer")
+	flag.IntVar(&config.MaxErrors, "max-errors", config.MaxErrors, "Maximum number of errors to report (0 for all)")
+	flag.Uint64Var(&config.Seed, "seed", config.Seed, "Seed for random patterns")
+	dryRun := flag.Bool("dry-run", false, "Print the tests that would run with their memory and estimated time, then exit")
+	flag.Parse()
+
+	// Create checker with the configured settings
+	checker := memcheck.NewMemChecker(config)
+
+	// Only show what would run when requested
+	if *dryRun {
+		if err := checker.DryRun(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Run all tests, watching the ECC error counters
+	var mismatches []memcheck.Mismatch
+	var err error
+	eccDeltas := edac.Watch("Correctness Tests", func() { mismatches, err = checker.RunAll() })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\n==== Summary ====")
+	if checker.ErrorCount() == 0 {
+		fmt.Println("No errors found")
+		if len(eccDeltas) > 0 {
+			os.Exit(exitECCErrors)
+		}
+		return
+	}
+
+	fmt.Printf("%d errors found\n", checker.ErrorCount())
+	for _, mismatch := range mismatches {
+		fmt.Println(" ", mismatch)
+	}
+	memcheck.PrintDIMMSummary(mismatches)
+	os.Exit(exitCorruption)
+}
@@ -0,0 +1,173 @@
+// Package alloc allocates test buffers with a selectable strategy, so
+// results can be compared between GC-managed and manually managed memory
+package alloc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Strategy selects where and how a buffer is allocated
+type Strategy string
+
+const (
+	Heap     Strategy = "heap"     // Go heap via make, GC managed and lazily faulted
+	Mmap     Strategy = "mmap"     // anonymous mmap outside the Go heap, lazily faulted
+	Mlock    Strategy = "mlock"    // anonymous mmap locked in RAM, so never swapped
+	Populate Strategy = "populate" // anonymous mmap prefaulted with MAP_POPULATE
+	Shm      Strategy = "shm"      // shared mapping of a file on /dev/shm
+)
+
+// Strategies lists every strategy in the order used by help texts
+var Strategies = []Strategy{Heap, Mmap, Mlock, Populate, Shm}
+
+// ShmDir is where Shm buffers create their backing files
+const ShmDir = "/dev/shm"
+
+// ErrUnsupported is returned for strategies this platform cannot provide
+var ErrUnsupported = errors.New("allocation strategy not supported on this platform")
+
+// ParseStrategy returns the strategy with the given name
+func ParseStrategy(name string) (Strategy, error) {
+	for _, s := range Strategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown allocation strategy %q (want one of %s)", name, StrategyNames())
+}
+
+// StrategyNames returns the strategy names separated by "|" for help texts
+func StrategyNames() string {
+	names := make([]string, len(Strategies))
+	for i, s := range Strategies {
+		names[i] = string(s)
+	}
+	return strings.Join(names, "|")
+}
+
+// String implements flag.Value
+func (s *Strategy) String() string {
+	if s == nil {
+		return ""
+	}
+	return string(*s)
+}
+
+// Set implements flag.Value
+func (s *Strategy) Set(name string) error {
+	strategy, err := ParseStrategy(name)
+	if err != nil {
+		return err
+	}
+	*s = strategy
+	return nil
+}
+
+// Buffer is an allocated block of memory that must be released with Free
+type Buffer struct {
+	Strategy Strategy
+
+	data   []byte
+	heap   any // the typed heap slice, kept so the GC sees its pointers
+	locked bool
+	unmap  func() error
+}
+
+// Bytes returns the buffer's memory
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Lock pins the buffer in RAM so it cannot be swapped out
+func (b *Buffer) Lock() error {
+	if b.locked || len(b.data) == 0 {
+		return nil
+	}
+	if err := lock(b.data); err != nil {
+		return err
+	}
+	b.locked = true
+	return nil
+}
+
+// Free releases the buffer. Mapped memory is returned to the kernel
+// immediately; heap memory is left to the GC. Free may be called more
+// than once, and on a nil buffer.
+func (b *Buffer) Free() error {
+	if b == nil || b.data == nil {
+		return nil
+	}
+	var err error
+	if b.locked {
+		err = unlock(b.data)
+		b.locked = false
+	}
+	if b.unmap != nil {
+		err = errors.Join(err, b.unmap())
+	}
+	b.data, b.heap, b.unmap = nil, nil, nil
+	return err
+}
+
+// Alloc allocates n zeroed elements of type T with the given strategy.
+// The returned slice must not be used after the buffer is freed.
+func Alloc[T any](strategy Strategy, n int) ([]T, *Buffer, error) {
+	size := n * int(unsafe.Sizeof(*new(T)))
+	if strategy == Heap || strategy == "" || size == 0 {
+		// Heap buffers are allocated typed so the GC knows about any
+		// pointers they hold
+		s := make([]T, n)
+		return s, &Buffer{Strategy: Heap, data: bytesOf(s), heap: s}, nil
+	}
+
+	buffer := &Buffer{Strategy: strategy}
+	var err error
+	switch strategy {
+	case Mmap:
+		buffer.data, err = mapAnon(size, false)
+	case Mlock:
+		buffer.data, err = mapAnon(size, false)
+	case Populate:
+		buffer.data, err = mapAnon(size, true)
+	case Shm:
+		buffer.data, err = mapShm(size)
+	default:
+		return nil, nil, fmt.Errorf("unknown allocation strategy %q", strategy)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s allocation of %d bytes: %w", strategy, size, err)
+	}
+	data := buffer.data
+	buffer.unmap = func() error { return unmap(data) }
+
+	if strategy == Mlock {
+		if err := buffer.Lock(); err != nil {
+			buffer.Free()
+			return nil, nil, fmt.Errorf("mlock of %d bytes: %w (raise RLIMIT_MEMLOCK with ulimit -l or run as root)", size, err)
+		}
+	}
+
+	return unsafe.Slice((*T)(unsafe.Pointer(&buffer.data[0])), n), buffer, nil
+}
+
+// Make is Alloc for benchmarks: when the strategy fails it prints a warning
+// and falls back to the Go heap, so the test still runs
+func Make[T any](strategy Strategy, n int) ([]T, *Buffer) {
+	s, buffer, err := Alloc[T](strategy, n)
+	if err != nil {
+		fmt.Printf("Warning: %v; using the Go heap instead\n", err)
+		s, buffer, _ = Alloc[T](Heap, n)
+	}
+	return s, buffer
+}
+
+// bytesOf returns the memory of s as a byte slice
+func bytesOf[T any](s []T) []byte {
+	if len(s) == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*int(unsafe.Sizeof(s[0])))
+}
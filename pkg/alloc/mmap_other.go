@@ -0,0 +1,28 @@
+//go:build !(linux || darwin)
+
+package alloc
+
+// mapAnon is not supported on this platform
+func mapAnon(size int, populate bool) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// mapShm is not supported on this platform
+func mapShm(size int) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// unmap is not supported on this platform
+func unmap(data []byte) error {
+	return ErrUnsupported
+}
+
+// lock is not supported on this platform
+func lock(data []byte) error {
+	return ErrUnsupported
+}
+
+// unlock is not supported on this platform
+func unlock(data []byte) error {
+	return ErrUnsupported
+}
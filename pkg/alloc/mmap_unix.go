@@ -0,0 +1,60 @@
+//go:build linux || darwin
+
+package alloc
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapAnon maps size bytes of private anonymous memory, prefaulting every
+// page when populate is set
+func mapAnon(size int, populate bool) ([]byte, error) {
+	flags := syscall.MAP_ANON | syscall.MAP_PRIVATE
+	if populate {
+		flags |= mapPopulate
+	}
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, flags)
+	if err != nil {
+		return nil, err
+	}
+	if populate && mapPopulate == 0 {
+		// No MAP_POPULATE here, so fault the pages in by hand
+		pageSize := os.Getpagesize()
+		for i := 0; i < len(data); i += pageSize {
+			data[i] = 0
+		}
+	}
+	return data, nil
+}
+
+// mapShm maps a new file of size bytes on ShmDir. The file is unlinked
+// right away, so its memory goes back to the system when it is unmapped.
+func mapShm(size int) ([]byte, error) {
+	file, err := os.CreateTemp(ShmDir, "memtest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	defer os.Remove(file.Name())
+
+	if err := file.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// unmap releases memory returned by mapAnon or mapShm
+func unmap(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// lock pins data in RAM
+func lock(data []byte) error {
+	return syscall.Mlock(data)
+}
+
+// unlock releases a lock taken by lock
+func unlock(data []byte) error {
+	return syscall.Munlock(data)
+}
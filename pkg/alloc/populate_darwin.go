@@ -0,0 +1,4 @@
+package alloc
+
+// mapPopulate is not available, mapAnon touches the pages instead
+const mapPopulate = 0
@@ -0,0 +1,6 @@
+package alloc
+
+import "syscall"
+
+// mapPopulate asks mmap to fault in every page up front
+const mapPopulate = syscall.MAP_POPULATE
@@ -0,0 +1,188 @@
+// Package chain builds the cycles that pointer chasing tests walk. Every
+// builder returns a successor table: next[i] is the node visited after
+// node i, and following it from any node visits all nodes exactly once
+// before returning, so a walk of any length covers the whole working set.
+// Skewed instead returns the order of a walk that revisits popular nodes
+// and leaves others out.
+package chain
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Sattolo returns a uniformly random single cycle through n nodes, built
+// with Sattolo's algorithm. It shuffles the successor table in place, so
+// unlike linking a random permutation it needs no order slice besides it.
+func Sattolo(n int) []int {
+	next := make([]int, n)
+	for i := range next {
+		next[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := rand.Intn(i)
+		next[i], next[j] = next[j], next[i]
+	}
+	return next
+}
+
+// Sequential returns the cycle that visits the nodes in ascending order
+func Sequential(n int) []int {
+	next := make([]int, n)
+	for i := range next {
+		next[i] = (i + 1) % n
+	}
+	return next
+}
+
+// Reverse returns the cycle that visits the nodes in descending order
+func Reverse(n int) []int {
+	next := make([]int, n)
+	for i := range next {
+		next[i] = (i - 1 + n) % n
+	}
+	return next
+}
+
+// Strided visits every stride-th node, then repeats with the next offset
+// until all nodes have been visited
+func Strided(n, stride int) []int {
+	order := make([]int, 0, n)
+	for offset := 0; offset < max(1, stride); offset++ {
+		for i := offset; i < n; i += max(1, stride) {
+			order = append(order, i)
+		}
+	}
+	return FromOrder(order)
+}
+
+// Interleaved splits the nodes into equal regions and walks all of them
+// forward at the same time, one node from each region in turn. Nodes left
+// over after the last full region are visited at the end.
+func Interleaved(n, streams int) []int {
+	streams = max(1, streams)
+	regionNodes := n / streams
+	order := make([]int, 0, n)
+	for i := 0; i < regionNodes; i++ {
+		for s := 0; s < streams; s++ {
+			order = append(order, s*regionNodes+i)
+		}
+	}
+	for i := regionNodes * streams; i < n; i++ {
+		order = append(order, i)
+	}
+	return FromOrder(order)
+}
+
+// PageRandom walks forward within each page of nodesPerPage nodes but
+// visits the pages in random order. The nodes of a last partial page are
+// visited at the end.
+func PageRandom(n, nodesPerPage int) []int {
+	nodesPerPage = max(1, nodesPerPage)
+	pages := n / nodesPerPage
+	order := make([]int, 0, n)
+	for _, page := range rand.Perm(pages) {
+		for i := 0; i < nodesPerPage; i++ {
+			order = append(order, page*nodesPerPage+i)
+		}
+	}
+	for i := pages * nodesPerPage; i < n; i++ {
+		order = append(order, i)
+	}
+	return FromOrder(order)
+}
+
+// WithinPage visits the pages of nodesPerPage nodes in order but the nodes
+// of each page in random order, so only the accesses within a page are
+// random. A last partial page is shuffled on its own.
+func WithinPage(n, nodesPerPage int) []int {
+	nodesPerPage = max(1, nodesPerPage)
+	order := make([]int, 0, n)
+	for first := 0; first < n; first += nodesPerPage {
+		for _, i := range rand.Perm(min(nodesPerPage, n-first)) {
+			order = append(order, first+i)
+		}
+	}
+	return FromOrder(order)
+}
+
+// PageWindow visits the pages of nodesPerPage nodes in random order within
+// consecutive windows of windowPages pages, and the nodes of each page in
+// random order. A page is finished before the next is entered, so a window
+// no larger than the TLB keeps the walk's pages in it, while neither next
+// page nor adjacent line prefetchers can follow the walk. A last partial
+// page is shuffled on its own.
+func PageWindow(n, nodesPerPage, windowPages int) []int {
+	nodesPerPage, windowPages = max(1, nodesPerPage), max(1, windowPages)
+	pages := (n + nodesPerPage - 1) / nodesPerPage
+	order := make([]int, 0, n)
+	for window := 0; window < pages; window += windowPages {
+		for _, page := range rand.Perm(min(windowPages, pages-window)) {
+			first := (window + page) * nodesPerPage
+			for _, i := range rand.Perm(min(nodesPerPage, n-first)) {
+				order = append(order, first+i)
+			}
+		}
+	}
+	return FromOrder(order)
+}
+
+// Skewed returns the order of a walk of up to length loads over n nodes of
+// slots words each, which draws every node from draw, a source of indices
+// in [0, n) such as a skew.Generator. A chain holds one successor per word,
+// so a node drawn again is entered at its next unused word, and a node
+// whose words are all used is drawn again. The entries are word indices,
+// node*slots+slot, each at most once, so linking them in order and the
+// last back to the first gives one cycle whose loads follow the popularity
+// of draw up to slots visits per node. The walk ends short of length after
+// 4*length draws, when most draws fall on nodes that are full.
+func Skewed(n, slots, length int, draw func() int) []int {
+	slots = max(1, slots)
+	length = min(length, n*slots)
+	used := make([]int32, n) // words of every node in the walk
+	order := make([]int, 0, length)
+	for draws := 0; len(order) < length && draws < 4*length; draws++ {
+		node := draw()
+		if int(used[node]) == slots {
+			continue
+		}
+		order = append(order, node*slots+int(used[node]))
+		used[node]++
+	}
+	return order
+}
+
+// FromOrder returns the cycle that visits the nodes in the given order and
+// then returns to the first one. The order must be a permutation of
+// 0..len(order)-1.
+func FromOrder(order []int) []int {
+	next := make([]int, len(order))
+	for i, node := range order {
+		next[node] = order[(i+1)%len(order)]
+	}
+	return next
+}
+
+// Validate checks that next is one cycle through all of its nodes by
+// walking it from node 0. The walk is as slow as a pointer chase over the
+// table, so it is meant for tests and opt-in checks.
+func Validate(next []int) error {
+	n := len(next)
+	if n == 0 {
+		return fmt.Errorf("empty chain")
+	}
+	node := 0
+	for steps := 1; steps <= n; steps++ {
+		if node < 0 || node >= n || next[node] < 0 || next[node] >= n {
+			return fmt.Errorf("node %d links outside the %d nodes", node, n)
+		}
+		node = next[node]
+		if node == 0 {
+			if steps < n {
+				return fmt.Errorf("cycle through node 0 has %d of %d nodes", steps, n)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("walk from node 0 enters a cycle that does not contain it")
+}
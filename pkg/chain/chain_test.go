@@ -0,0 +1,172 @@
+package chain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildersFormOneCycle(t *testing.T) {
+	builders := []struct {
+		name  string
+		build func(n int) []int
+	}{
+		{"sattolo", Sattolo},
+		{"sequential", Sequential},
+		{"reverse", Reverse},
+		{"strided-1", func(n int) []int { return Strided(n, 1) }},
+		{"strided-4", func(n int) []int { return Strided(n, 4) }},
+		{"strided-7", func(n int) []int { return Strided(n, 7) }},
+		{"strided-0", func(n int) []int { return Strided(n, 0) }},
+		{"interleaved-1", func(n int) []int { return Interleaved(n, 1) }},
+		{"interleaved-3", func(n int) []int { return Interleaved(n, 3) }},
+		{"interleaved-8", func(n int) []int { return Interleaved(n, 8) }},
+		{"page-random-16", func(n int) []int { return PageRandom(n, 16) }},
+		{"page-random-64", func(n int) []int { return PageRandom(n, 64) }},
+		{"within-page-16", func(n int) []int { return WithinPage(n, 16) }},
+		{"within-page-64", func(n int) []int { return WithinPage(n, 64) }},
+		{"page-window-16-1", func(n int) []int { return PageWindow(n, 16, 1) }},
+		{"page-window-16-4", func(n int) []int { return PageWindow(n, 16, 4) }},
+		{"page-window-64-32", func(n int) []int { return PageWindow(n, 64, 32) }},
+	}
+	// Sizes around and between whole pages, strides and regions
+	sizes := []int{1, 2, 3, 7, 16, 17, 63, 64, 100, 1000, 4096, 4099}
+
+	for _, builder := range builders {
+		for _, n := range sizes {
+			next := builder.build(n)
+			if len(next) != n {
+				t.Errorf("%s(%d) has %d nodes", builder.name, n, len(next))
+				continue
+			}
+			if err := Validate(next); err != nil {
+				t.Errorf("%s(%d): %v", builder.name, n, err)
+			}
+		}
+	}
+}
+
+func TestOrders(t *testing.T) {
+	// walk returns the nodes visited from node 0
+	walk := func(next []int) []int {
+		order := []int{0}
+		for node := next[0]; node != 0; node = next[node] {
+			order = append(order, node)
+		}
+		return order
+	}
+
+	tests := []struct {
+		name string
+		next []int
+		want []int
+	}{
+		{"sequential", Sequential(5), []int{0, 1, 2, 3, 4}},
+		{"reverse", Reverse(5), []int{0, 4, 3, 2, 1}},
+		{"strided", Strided(7, 3), []int{0, 3, 6, 1, 4, 2, 5}},
+		{"interleaved", Interleaved(7, 3), []int{0, 2, 4, 1, 3, 5, 6}},
+		{"from order", FromOrder([]int{0, 3, 1, 2}), []int{0, 3, 1, 2}},
+	}
+	for _, test := range tests {
+		if got := walk(test.next); !slices.Equal(got, test.want) {
+			t.Errorf("%s visits %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPageOrders(t *testing.T) {
+	const n, nodesPerPage = 1000, 16
+	pages := (n + nodesPerPage - 1) / nodesPerPage
+
+	// All page orders finish a page before entering the next one, so the
+	// cycle crosses into another page once per page
+	crossings := func(next []int) int {
+		count := 0
+		for node, successor := range next {
+			if node/nodesPerPage != successor/nodesPerPage {
+				count++
+			}
+		}
+		return count
+	}
+	for name, next := range map[string][]int{
+		"PageRandom": PageRandom(n, nodesPerPage),
+		"WithinPage": WithinPage(n, nodesPerPage),
+		"PageWindow": PageWindow(n, nodesPerPage, 4),
+	} {
+		if got := crossings(next); got != pages {
+			t.Errorf("%s crosses pages %d times, want %d", name, got, pages)
+		}
+	}
+
+	// PageRandom walks forward within every page
+	for node, successor := range PageRandom(n, nodesPerPage) {
+		if node%nodesPerPage != nodesPerPage-1 && node != n-1 && successor != node+1 {
+			t.Errorf("PageRandom goes from node %d to %d", node, successor)
+		}
+	}
+}
+
+func TestPageWindow(t *testing.T) {
+	const n, nodesPerPage, windowPages = 1000, 16, 4
+	windows := (n + nodesPerPage*windowPages - 1) / (nodesPerPage * windowPages)
+	window := func(node int) int { return node / nodesPerPage / windowPages }
+
+	// The walk finishes every window before entering the next one, in
+	// order, and returns to the first after the last
+	for node, successor := range PageWindow(n, nodesPerPage, windowPages) {
+		if window(successor) != window(node) && window(successor) != (window(node)+1)%windows {
+			t.Errorf("walk jumps from window %d to %d", window(node), window(successor))
+		}
+	}
+}
+
+func TestSkewed(t *testing.T) {
+	// A node drawn again takes its next word, and a full one is drawn again
+	draws := []int{2, 0, 2, 2, 2, 1}
+	draw := func() int {
+		node := draws[0]
+		draws = append(draws[1:], node)
+		return node
+	}
+	if got, want := Skewed(3, 3, 5, draw), []int{6, 0, 7, 8, 3}; !slices.Equal(got, want) {
+		t.Errorf("Skewed() = %v, want %v", got, want)
+	}
+
+	// A walk longer than the words ends with all of them, and one whose
+	// draws all fall on full nodes ends after 4 draws per load
+	if got := Skewed(2, 2, 10, func() int { return 1 }); !slices.Equal(got, []int{2, 3}) {
+		t.Errorf("Skewed() of one node = %v, want [2 3]", got)
+	}
+	calls := 0
+	Skewed(100, 1, 10, func() int { calls++; return 0 })
+	if calls != 40 {
+		t.Errorf("Skewed() drew %d times, want 40", calls)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		next []int
+		err  string
+	}{
+		{"single node", []int{0}, ""},
+		{"cycle", []int{2, 0, 1}, ""},
+		{"empty", nil, "empty chain"},
+		{"two cycles", []int{1, 0, 3, 2}, "has 2 of 4 nodes"},
+		{"self loop", []int{0, 0}, "has 1 of 2 nodes"},
+		{"out of range", []int{1, 5}, "links outside"},
+		{"negative", []int{-1}, "links outside"},
+		{"cycle without node 0", []int{1, 2, 1}, "does not contain it"},
+	}
+	for _, test := range tests {
+		err := Validate(test.next)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("Validate(%s) = %v, want nil", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("Validate(%s) = %v, want %q", test.name, err, test.err)
+		}
+	}
+}
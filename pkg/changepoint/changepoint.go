@@ -0,0 +1,175 @@
+// Package changepoint fits a curve with straight line segments and finds
+// the points where its behavior changes. The best segmentation for every
+// number of segments is found exactly by dynamic programming, and the
+// number of segments is chosen by the Bayesian information criterion, so
+// a segment is only added when it explains more than noise.
+package changepoint
+
+import (
+	"math"
+	"sort"
+)
+
+// Segment is a straight line fitted through the points Start..End
+type Segment struct {
+	Start, End int // indices of the first and last point, inclusive
+	Intercept  float64
+	Slope      float64
+	RSS        float64 // residual sum of squares of the fit
+
+	// EndConfidence is the BIC weight of the change at the end of the
+	// segment: the approximate probability that the data changes there,
+	// rather than this and the next segment being one line. It is 0 for
+	// the last segment.
+	EndConfidence float64
+}
+
+// Mean returns the value of the line at the middle of the segment
+func (s Segment) Mean(x []float64) float64 {
+	return s.Intercept + s.Slope*(x[s.Start]+x[s.End])/2
+}
+
+// Options limits the segmentation
+type Options struct {
+	MinLength   int     // points per segment, at least 2
+	MaxSegments int     // upper bound on the number of segments, at least 1
+	Noise       float64 // standard deviation below which residuals count as noise
+}
+
+// Fit segments the points (x[i], y[i]), which must be sorted by x, into
+// the number of line segments with the lowest BIC
+func Fit(x, y []float64, opts Options) []Segment {
+	n := len(x)
+	minLength := max(2, opts.MinLength)
+	if n < minLength || len(y) != n {
+		return nil
+	}
+	maxSegments := max(1, min(opts.MaxSegments, n/minLength))
+	s := newSums(x, y)
+
+	// best[k][j] is the lowest RSS of k+1 segments through points 0..j,
+	// and start[k][j] where the last of them begins
+	best := make([][]float64, maxSegments)
+	start := make([][]int, maxSegments)
+	for k := range best {
+		best[k] = make([]float64, n)
+		start[k] = make([]int, n)
+		for j := range best[k] {
+			best[k][j] = math.Inf(1)
+		}
+	}
+	for j := minLength - 1; j < n; j++ {
+		best[0][j] = s.line(0, j).RSS
+	}
+	for k := 1; k < maxSegments; k++ {
+		for j := (k+1)*minLength - 1; j < n; j++ {
+			for i := k * minLength; i <= j-minLength+1; i++ {
+				if cost := best[k-1][i-1] + s.line(i, j).RSS; cost < best[k][j] {
+					best[k][j], start[k][j] = cost, i
+				}
+			}
+		}
+	}
+
+	bestK, bestBIC := 0, math.Inf(1)
+	for k := 0; k < maxSegments; k++ {
+		if b := bic(best[k][n-1], n, k+1, opts.Noise); b < bestBIC {
+			bestK, bestBIC = k, b
+		}
+	}
+
+	segments := make([]Segment, bestK+1)
+	for k, j := bestK, n-1; k >= 0; k-- {
+		i := 0
+		if k > 0 {
+			i = start[k][j]
+		}
+		segments[k] = s.line(i, j)
+		j = i - 1
+	}
+
+	// Compare the chosen model with the one that joins each pair of
+	// neighbouring segments into one line
+	total := best[bestK][n-1]
+	for k := 0; k < len(segments)-1; k++ {
+		a, b := segments[k], segments[k+1]
+		joined := total - a.RSS - b.RSS + s.line(a.Start, b.End).RSS
+		delta := bic(joined, n, len(segments)-1, opts.Noise) - bestBIC
+		segments[k].EndConfidence = 1 / (1 + math.Exp(-min(delta, 700)/2))
+	}
+	return segments
+}
+
+// NoiseLevel estimates the standard deviation of the noise on a curve
+// from the median absolute deviation of the differences between
+// neighbouring points. Steps and slopes only move a few differences, so
+// they barely change the estimate, unlike the plain standard deviation.
+func NoiseLevel(y []float64) float64 {
+	if len(y) < 3 {
+		return 0
+	}
+	diffs := make([]float64, len(y)-1)
+	for i := range diffs {
+		diffs[i] = y[i+1] - y[i]
+	}
+	center := median(diffs)
+	for i, d := range diffs {
+		diffs[i] = math.Abs(d - center)
+	}
+	// 1.4826 scales the MAD of Gaussian noise to its deviation, and a
+	// difference of two points has twice the variance of one
+	return 1.4826 * median(diffs) / math.Sqrt2
+}
+
+// median returns the median of values, reordering them
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
+
+// bic returns the Bayesian information criterion of a fit with the given
+// residuals, assuming Gaussian noise of at least the given deviation. Each
+// segment has an intercept and a slope, and every change point between
+// two segments is one more parameter.
+func bic(rss float64, n, segments int, noise float64) float64 {
+	variance := max(rss/float64(n), noise*noise, 1e-300)
+	params := 3*segments - 1
+	return float64(n)*math.Log(variance) + float64(params)*math.Log(float64(n))
+}
+
+// sums holds prefix sums for least squares fits of any range in O(1)
+type sums struct {
+	x, y, xx, xy, yy []float64
+}
+
+// newSums computes the prefix sums of the points
+func newSums(x, y []float64) *sums {
+	n := len(x)
+	s := &sums{
+		x: make([]float64, n+1), y: make([]float64, n+1),
+		xx: make([]float64, n+1), xy: make([]float64, n+1), yy: make([]float64, n+1),
+	}
+	for i := range x {
+		s.x[i+1] = s.x[i] + x[i]
+		s.y[i+1] = s.y[i] + y[i]
+		s.xx[i+1] = s.xx[i] + x[i]*x[i]
+		s.xy[i+1] = s.xy[i] + x[i]*y[i]
+		s.yy[i+1] = s.yy[i] + y[i]*y[i]
+	}
+	return s
+}
+
+// line fits a least squares line through the points i..j
+func (s *sums) line(i, j int) Segment {
+	n := float64(j - i + 1)
+	sx, sy := s.x[j+1]-s.x[i], s.y[j+1]-s.y[i]
+	sxx, sxy, syy := s.xx[j+1]-s.xx[i], s.xy[j+1]-s.xy[i], s.yy[j+1]-s.yy[i]
+
+	seg := Segment{Start: i, End: j}
+	if d := n*sxx - sx*sx; d > 1e-12 {
+		seg.Slope = (n*sxy - sx*sy) / d
+	}
+	seg.Intercept = (sy - seg.Slope*sx) / n
+	seg.RSS = max(0, syy-seg.Intercept*sy-seg.Slope*sxy)
+	return seg
+}
@@ -0,0 +1,219 @@
+// Package dryrun predicts what a test run will cost without running it,
+// using a short calibration probe of the machine
+package dryrun
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Working sets up to cachedBytes are treated as cache hits and those from
+// memoryBytes on as DRAM accesses; latencies in between are interpolated
+const (
+	cachedBytes = 256 * 1024
+	memoryBytes = 32 * 1024 * 1024
+)
+
+// Calibration holds the machine costs measured by Calibrate
+type Calibration struct {
+	CachedNs      float64 // dependent load that hits L1/L2
+	RandomNs      float64 // dependent load from DRAM
+	StreamGBs     float64 // sequential read bandwidth from DRAM
+	SetupNs       float64 // per element cost of rand.Perm and linking an array
+	FirstTouchGBs float64 // rate at which fresh pages are faulted in and written
+}
+
+// Calibrate measures the machine in well under a second
+func Calibrate() Calibration {
+	var cal Calibration
+
+	// First touch: write every word of a fresh buffer once
+	buffer := make([]int64, memoryBytes/8)
+	start := time.Now()
+	for i := range buffer {
+		buffer[i] = int64(i)
+	}
+	cal.FirstTouchGBs = float64(memoryBytes) / time.Since(start).Seconds() / 1e9
+
+	// Streaming read of the now resident buffer
+	start = time.Now()
+	sum := int64(0)
+	for _, v := range buffer {
+		sum += v
+	}
+	cal.StreamGBs = float64(memoryBytes) / time.Since(start).Seconds() / 1e9
+
+	// Setup cost as the tests pay it: a permutation linked into a cycle
+	const setupElements = 1024 * 1024
+	start = time.Now()
+	indices := rand.Perm(setupElements)
+	for i := 0; i < setupElements-1; i++ {
+		buffer[indices[i]] = int64(indices[i+1])
+	}
+	buffer[indices[setupElements-1]] = int64(indices[0])
+	cal.SetupNs = float64(time.Since(start).Nanoseconds()) / setupElements
+
+	// DRAM latency over the whole buffer, linked by a full-period LCG so
+	// setting it up is cheap
+	mask := int64(len(buffer) - 1)
+	for i := range buffer {
+		buffer[i] = (int64(i)*0x5851f42d4c957f2d + 0x14057b7ef767814f) & mask
+	}
+	cal.RandomNs = chase(buffer, 1000000)
+
+	// Cache latency over a buffer that fits in L1
+	small := buffer[:cachedBytes/64]
+	smallMask := int64(len(small) - 1)
+	for i := range small {
+		small[i] = (int64(i)*0x5851f42d4c957f2d + 0x14057b7ef767814f) & smallMask
+	}
+	cal.CachedNs = chase(small, 1000000)
+
+	if sum == 0 {
+		fmt.Println(sum)
+	}
+	return cal
+}
+
+// chase follows the chain in buffer and returns the ns per load
+func chase(buffer []int64, iterations int) float64 {
+	j := int64(0)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		j = buffer[j]
+	}
+	elapsed := time.Since(start)
+	if j < 0 {
+		fmt.Println(j)
+	}
+	return float64(elapsed.Nanoseconds()) / float64(iterations)
+}
+
+// String summarizes the calibration for reports
+func (c Calibration) String() string {
+	return fmt.Sprintf("cached load %.1f ns, DRAM load %.1f ns, stream %.1f GB/s, setup %.1f ns/element, first touch %.1f GB/s",
+		c.CachedNs, c.RandomNs, c.StreamGBs, c.SetupNs, c.FirstTouchGBs)
+}
+
+// LoadNs returns the expected cost of one dependent load over a working set
+func (c Calibration) LoadNs(workingSet int64) float64 {
+	switch {
+	case workingSet <= cachedBytes:
+		return c.CachedNs
+	case workingSet >= memoryBytes:
+		return c.RandomNs
+	}
+	// Interpolate on a log scale between the two measured points
+	f := math.Log(float64(workingSet)/cachedBytes) / math.Log(memoryBytes/cachedBytes)
+	return c.CachedNs + f*(c.RandomNs-c.CachedNs)
+}
+
+// Chase returns the expected time of n dependent loads over a working set
+func (c Calibration) Chase(n, workingSet int64) time.Duration {
+	return time.Duration(float64(n) * c.LoadNs(workingSet))
+}
+
+// Stream returns the expected time to read the given number of bytes sequentially
+func (c Calibration) Stream(bytes int64) time.Duration {
+	return time.Duration(float64(bytes) / c.StreamGBs)
+}
+
+// Setup returns the expected time to fault in, shuffle and link an array
+// of 8-byte elements
+func (c Calibration) Setup(elements int64) time.Duration {
+	return c.Shuffle(elements) + c.FirstTouch(elements*8)
+}
+
+// Shuffle returns the expected time to shuffle and link the given number
+// of elements of memory that is already resident
+func (c Calibration) Shuffle(elements int64) time.Duration {
+	return time.Duration(float64(elements) * c.SetupNs)
+}
+
+// FirstTouch returns the expected time to fault in the given number of bytes
+func (c Calibration) FirstTouch(bytes int64) time.Duration {
+	return time.Duration(float64(bytes) / c.FirstTouchGBs)
+}
+
+// Timing describes how the workload harness times each measurement
+type Timing struct {
+	Repetitions int           // timed runs per measurement
+	Target      time.Duration // length of each calibrated run, 0 for fixed iterations
+}
+
+// Duration returns the expected time of the timed runs of one measurement,
+// given the time of one run of its fixed iterations
+func (t Timing) Duration(run time.Duration) time.Duration {
+	reps := time.Duration(max(1, t.Repetitions))
+	if t.Target > 0 {
+		// The calibration runs add about one more target
+		return (reps + 1) * t.Target
+	}
+	return reps * run
+}
+
+// Iterations returns the timed operations of one measurement of n fixed
+// iterations, or 0 when the target time decides them
+func (t Timing) Iterations(n int64) int64 {
+	if t.Target > 0 {
+		return 0
+	}
+	return int64(max(1, t.Repetitions)) * n
+}
+
+// Step is one test as it would run
+type Step struct {
+	Name       string
+	WorkingSet string        // e.g. "256.0 MB" or "4.0 KB-64.0 MB"
+	Iterations int64         // timed accesses, 0 when not applicable
+	Threads    int           // most threads running at once
+	PeakBytes  int64         // peak memory, 0 when unknown
+	Duration   time.Duration // estimated wall-clock time, 0 when unknown
+}
+
+// Print prints the steps as a table with the estimated total time
+func Print(steps []Step) {
+	fmt.Println("\n==== Dry Run ====")
+	fmt.Printf("%-28s %-18s %14s %7s %10s %10s\n", "Test", "Working set", "Iterations", "Threads", "Peak", "Est. time")
+	fmt.Println(strings.Repeat("-", 92))
+
+	total := time.Duration(0)
+	peak := int64(0)
+	for _, step := range steps {
+		iterations := "-"
+		if step.Iterations > 0 {
+			iterations = fmt.Sprintf("%d", step.Iterations)
+		}
+		peakBytes := "?"
+		if step.PeakBytes > 0 {
+			peakBytes = fmt.Sprintf("%d MB", (step.PeakBytes+1<<20-1)>>20)
+		}
+		duration := "?"
+		if step.Duration > 0 {
+			duration = formatDuration(step.Duration)
+		}
+		fmt.Printf("%-28s %-18s %14s %7d %10s %10s\n",
+			step.Name, step.WorkingSet, iterations, step.Threads, peakBytes, duration)
+
+		total += step.Duration
+		peak = max(peak, step.PeakBytes)
+	}
+
+	fmt.Println(strings.Repeat("-", 92))
+	fmt.Printf("Peak memory: %d MB, estimated total time: %s (tests marked ? are not included)\n",
+		(peak+1<<20-1)>>20, formatDuration(total))
+}
+
+// formatDuration rounds a duration to a readable precision
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,126 @@
+package edac
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Counts holds corrected (CE) and uncorrected (UE) error counts
+type Counts struct {
+	CE int64
+	UE int64
+}
+
+// Counters is a snapshot of every ECC error counter, keyed by sysfs path
+// relative to the EDAC directory, e.g. "mc0", "mc0/csrow1" or "mc0/dimm2"
+type Counters struct {
+	Counts map[string]Counts
+	Labels map[string]string // module labels for the dimm and csrow keys
+}
+
+// Delta is the change of one counter between two snapshots
+type Delta struct {
+	Name  string
+	Label string
+	Counts
+}
+
+// String formats the delta for reports
+func (d Delta) String() string {
+	name := d.Name
+	if d.Label != "" {
+		name += " (" + d.Label + ")"
+	}
+	return fmt.Sprintf("%s: +%d corrected, +%d uncorrected", name, d.CE, d.UE)
+}
+
+// ReadCounters reads the error counters of every memory controller, chip
+// select row and module below dir. It returns nil when EDAC is not available.
+func ReadCounters(dir string) *Counters {
+	mcPaths := sortedDirs(dir, "mc")
+	if len(mcPaths) == 0 {
+		return nil
+	}
+
+	counters := &Counters{Counts: make(map[string]Counts), Labels: make(map[string]string)}
+	for _, mcPath := range mcPaths {
+		mc := filepath.Base(mcPath)
+		counters.Counts[mc] = Counts{
+			CE: int64(readInt(mcPath, "ce_count")),
+			UE: int64(readInt(mcPath, "ue_count")),
+		}
+
+		for _, rowPath := range sortedDirs(mcPath, "csrow") {
+			key := mc + "/" + filepath.Base(rowPath)
+			counters.Counts[key] = Counts{
+				CE: int64(readInt(rowPath, "ce_count")),
+				UE: int64(readInt(rowPath, "ue_count")),
+			}
+			counters.Labels[key] = readString(rowPath, "ch0_dimm_label")
+		}
+
+		for _, dimmPath := range sortedDirs(mcPath, "dimm") {
+			key := mc + "/" + filepath.Base(dimmPath)
+			counters.Counts[key] = Counts{
+				CE: int64(readInt(dimmPath, "dimm_ce_count")),
+				UE: int64(readInt(dimmPath, "dimm_ue_count")),
+			}
+			counters.Labels[key] = readString(dimmPath, "dimm_label")
+		}
+	}
+	return counters
+}
+
+// Sub returns the counters that increased since before, in name order. A
+// counter below its earlier value was reset, by the driver or through
+// reset_counters, so everything it counts now was counted since before.
+func (c *Counters) Sub(before *Counters) []Delta {
+	if c == nil || before == nil {
+		return nil
+	}
+
+	var deltas []Delta
+	for name, after := range c.Counts {
+		prev := before.Counts[name]
+		counts := Counts{CE: increase(prev.CE, after.CE), UE: increase(prev.UE, after.UE)}
+		if counts.CE == 0 && counts.UE == 0 {
+			continue
+		}
+		deltas = append(deltas, Delta{Name: name, Label: c.Labels[name], Counts: counts})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Name < deltas[j].Name })
+	return deltas
+}
+
+// increase returns how much a counter grew from before to after, treating a
+// smaller after as a reset
+func increase(before, after int64) int64 {
+	if after < before {
+		return after
+	}
+	return after - before
+}
+
+// Watch runs fn and reports any ECC errors counted while it ran. Nothing is
+// printed when EDAC is unavailable or no counter changed.
+func Watch(name string, fn func()) []Delta {
+	before := ReadCounters(SysfsDir)
+	fn()
+	deltas := ReadCounters(SysfsDir).Sub(before)
+	PrintDeltas(name, deltas)
+	return deltas
+}
+
+// PrintDeltas prints the ECC error counter changes seen during a test
+func PrintDeltas(name string, deltas []Delta) {
+	if len(deltas) == 0 {
+		return
+	}
+
+	fmt.Printf("\n==== ECC Errors During %s ====\n", name)
+	for _, delta := range deltas {
+		fmt.Println(delta)
+	}
+	fmt.Println("WARNING: ECC errors were counted during this test; even corrected errors indicate a failing DIMM.")
+}
@@ -0,0 +1,119 @@
+package edac
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree writes a fixture sysfs tree of files and their contents
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadCounters(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"mc0/ce_count":              "5",
+		"mc0/ue_count":              "1",
+		"mc0/csrow0/ce_count":       "3",
+		"mc0/csrow0/ue_count":       "0",
+		"mc0/csrow0/ch0_dimm_label": "CPU0_DIMM_A1",
+		"mc0/dimm0/dimm_ce_count":   "2",
+		"mc0/dimm0/dimm_ue_count":   "1",
+		"mc0/dimm0/dimm_label":      "CPU0_DIMM_A1",
+		"mc10/ce_count":             "7",
+		"mc10/ue_count":             "0",
+		"mc10/dimm1/dimm_ce_count":  "7",
+		"mc10/dimm1/dimm_ue_count":  "0",
+	})
+
+	got := ReadCounters(dir)
+	want := &Counters{
+		Counts: map[string]Counts{
+			"mc0":        {CE: 5, UE: 1},
+			"mc0/csrow0": {CE: 3},
+			"mc0/dimm0":  {CE: 2, UE: 1},
+			"mc10":       {CE: 7},
+			"mc10/dimm1": {CE: 7},
+		},
+		Labels: map[string]string{
+			"mc0/csrow0": "CPU0_DIMM_A1",
+			"mc0/dimm0":  "CPU0_DIMM_A1",
+			"mc10/dimm1": "",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadCounters() = %+v, want %+v", got, want)
+	}
+
+	if got := ReadCounters(t.TempDir()); got != nil {
+		t.Errorf("ReadCounters() without controllers = %+v, want nil", got)
+	}
+}
+
+func TestSub(t *testing.T) {
+	counters := func(counts map[string]Counts) *Counters {
+		return &Counters{Counts: counts, Labels: map[string]string{"mc0/dimm0": "A1"}}
+	}
+
+	tests := []struct {
+		name          string
+		before, after *Counters
+		want          []Delta
+	}{
+		{
+			name:   "unchanged",
+			before: counters(map[string]Counts{"mc0": {CE: 4, UE: 1}}),
+			after:  counters(map[string]Counts{"mc0": {CE: 4, UE: 1}}),
+		},
+		{
+			name:   "increased",
+			before: counters(map[string]Counts{"mc0": {CE: 4}, "mc0/dimm0": {CE: 4}, "mc1": {}}),
+			after:  counters(map[string]Counts{"mc0": {CE: 6, UE: 1}, "mc0/dimm0": {CE: 6, UE: 1}, "mc1": {}}),
+			want: []Delta{
+				{Name: "mc0", Counts: Counts{CE: 2, UE: 1}},
+				{Name: "mc0/dimm0", Label: "A1", Counts: Counts{CE: 2, UE: 1}},
+			},
+		},
+		{
+			name:   "reset",
+			before: counters(map[string]Counts{"mc0": {CE: 100, UE: 2}}),
+			after:  counters(map[string]Counts{"mc0": {CE: 3, UE: 2}}),
+			want:   []Delta{{Name: "mc0", Counts: Counts{CE: 3}}},
+		},
+		{
+			name:   "reset to zero",
+			before: counters(map[string]Counts{"mc0": {CE: 100}}),
+			after:  counters(map[string]Counts{"mc0": {}}),
+		},
+		{
+			name:   "new counter",
+			before: counters(map[string]Counts{}),
+			after:  counters(map[string]Counts{"mc0/dimm0": {UE: 1}}),
+			want:   []Delta{{Name: "mc0/dimm0", Label: "A1", Counts: Counts{UE: 1}}},
+		},
+		{
+			name:  "no earlier snapshot",
+			after: counters(map[string]Counts{"mc0": {CE: 1}}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.after.Sub(test.before); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Sub() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
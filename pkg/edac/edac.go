@@ -0,0 +1,108 @@
+// Package edac reads the Linux EDAC (Error Detection and Correction) sysfs tree
+package edac
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SysfsDir is where Linux exposes the EDAC memory controllers
+const SysfsDir = "/sys/devices/system/edac/mc"
+
+// DIMM describes one memory module (or chip-select row on older drivers)
+type DIMM struct {
+	Controller int
+	Index      int
+	Name       string // sysfs directory name, e.g. "dimm0" or "csrow1"
+	Label      string // motherboard label, e.g. "CPU0_DIMM_A1"
+	Location   string // driver specific location, e.g. "channel 0 slot 0"
+	SizeMB     int
+}
+
+// Controller describes one memory controller and its modules
+type Controller struct {
+	Index  int
+	Name   string
+	SizeMB int
+	DIMMs  []DIMM
+}
+
+// ReadControllers reads all memory controllers below dir (normally
+// /sys/devices/system/edac/mc). It returns nil when EDAC is not available.
+func ReadControllers(dir string) []Controller {
+	var controllers []Controller
+	for _, mcPath := range sortedDirs(dir, "mc") {
+		controller := Controller{
+			Index:  dirIndex(mcPath, "mc"),
+			Name:   readString(mcPath, "mc_name"),
+			SizeMB: readInt(mcPath, "size_mb"),
+		}
+
+		// Newer drivers describe each module in dimmN, older ones only
+		// have chip-select rows in csrowN
+		for _, dimmPath := range sortedDirs(mcPath, "dimm") {
+			controller.DIMMs = append(controller.DIMMs, DIMM{
+				Controller: controller.Index,
+				Index:      dirIndex(dimmPath, "dimm"),
+				Name:       filepath.Base(dimmPath),
+				Label:      readString(dimmPath, "dimm_label"),
+				Location:   readString(dimmPath, "dimm_location"),
+				SizeMB:     readInt(dimmPath, "size"),
+			})
+		}
+		if len(controller.DIMMs) == 0 {
+			for _, rowPath := range sortedDirs(mcPath, "csrow") {
+				controller.DIMMs = append(controller.DIMMs, DIMM{
+					Controller: controller.Index,
+					Index:      dirIndex(rowPath, "csrow"),
+					Name:       filepath.Base(rowPath),
+					Label:      readString(rowPath, "ch0_dimm_label"),
+					SizeMB:     readInt(rowPath, "size_mb"),
+				})
+			}
+		}
+
+		controllers = append(controllers, controller)
+	}
+	return controllers
+}
+
+// sortedDirs returns the entries of dir named prefix followed by a number,
+// in numeric order
+func sortedDirs(dir, prefix string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"[0-9]*"))
+	if err != nil {
+		return nil
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return dirIndex(paths[i], prefix) < dirIndex(paths[j], prefix)
+	})
+	return paths
+}
+
+// dirIndex returns the number following prefix in the base name of path
+func dirIndex(path, prefix string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), prefix))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// readString reads a single-value sysfs attribute, returning "" on error
+func readString(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readInt reads a numeric sysfs attribute, returning 0 on error
+func readInt(dir, name string) int {
+	n, _ := strconv.Atoi(readString(dir, name))
+	return n
+}
@@ -0,0 +1,200 @@
+// Package histogram records values into an HDR-style histogram. Buckets
+// double in width from one power of two to the next, and every power of
+// two is split into the same number of equal sub-buckets. Every value is
+// therefore kept with the same bounded relative error, from nanoseconds
+// to seconds, in little memory.
+package histogram
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Histogram counts values with a relative error of at most
+// 2^-SignificantBits
+type Histogram struct {
+	subBits uint     // log2 of the sub-buckets per power of two
+	counts  []uint64 // grows to the bucket of the largest value
+	total   uint64
+	min     uint64
+	max     uint64
+	sum     float64
+}
+
+// Bucket is a range of values [Low, High) and how many fell into it
+type Bucket struct {
+	Low   uint64
+	High  uint64
+	Count uint64
+}
+
+// New returns a histogram that splits every power of two into
+// 2^significantBits buckets, e.g. 5 bits for a relative error of 3%
+func New(significantBits int) *Histogram {
+	return &Histogram{subBits: uint(min(max(1, significantBits), 16))}
+}
+
+// Record adds one value
+func (h *Histogram) Record(v uint64) {
+	i := h.index(v)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	h.max = max(h.max, v)
+	h.total++
+	h.sum += float64(v)
+}
+
+// index returns the bucket of a value. Values below 2^subBits have a
+// bucket each; above that every power of two has 2^subBits buckets.
+func (h *Histogram) index(v uint64) int {
+	if v < 1<<h.subBits {
+		return int(v)
+	}
+	shift := uint(bits.Len64(v)) - 1 - h.subBits
+	return int((uint64(shift)+1)<<h.subBits + v>>shift - 1<<h.subBits)
+}
+
+// bounds returns the range [low, high) of values in bucket i. The last
+// bucket ends at math.MaxUint64, which it also holds.
+func (h *Histogram) bounds(i int) (low, high uint64) {
+	group, sub := uint(i)>>h.subBits, uint64(i)&(1<<h.subBits-1)
+	if group == 0 {
+		return sub, sub + 1
+	}
+	shift := group - 1
+	low = (1<<h.subBits + sub) << shift
+	if high = low + 1<<shift; high == 0 {
+		high = math.MaxUint64
+	}
+	return low, high
+}
+
+// Count returns the number of recorded values
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Min returns the smallest recorded value
+func (h *Histogram) Min() uint64 {
+	return h.min
+}
+
+// Max returns the largest recorded value
+func (h *Histogram) Max() uint64 {
+	return h.max
+}
+
+// Mean returns the average of the recorded values
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// ValueAt returns the value below which the fraction q of the recorded
+// values fall, e.g. 0.99 for the 99th percentile. It is the highest value
+// of the bucket holding that rank, never more than Max.
+func (h *Histogram) ValueAt(q float64) uint64 {
+	if h.total == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.min
+	}
+	rank := uint64(math.Ceil(min(q, 1) * float64(h.total)))
+	rank = max(rank, 1)
+
+	seen := uint64(0)
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			_, high := h.bounds(i)
+			if high != math.MaxUint64 {
+				high--
+			}
+			return max(min(high, h.max), h.min)
+		}
+	}
+	return h.max
+}
+
+// Buckets returns the buckets from the smallest to the largest recorded
+// value, including empty ones in between
+func (h *Histogram) Buckets() []Bucket {
+	if h.total == 0 {
+		return nil
+	}
+	var buckets []Bucket
+	for i := h.index(h.min); i <= h.index(h.max); i++ {
+		low, high := h.bounds(i)
+		buckets = append(buckets, Bucket{Low: low, High: high, Count: h.counts[i]})
+	}
+	return buckets
+}
+
+// Coarsen merges the buckets between low and high into at most rows
+// ranges of equal ratio, for printing. All values below low share one more
+// range before them, and all values from high on one after them. Buckets
+// that already fit are returned as they are.
+func (h *Histogram) Coarsen(rows int, low, high uint64) []Bucket {
+	var head, buckets, tail []Bucket
+	for _, b := range h.Buckets() {
+		switch {
+		case b.High <= low:
+			head = append(head, b)
+		case b.Low >= high && len(buckets) > 0:
+			tail = append(tail, b)
+		default:
+			buckets = append(buckets, b)
+		}
+	}
+	if rows > 0 && len(buckets) > rows {
+		buckets = merge(buckets, rows)
+	}
+	if len(head) > 0 {
+		buckets = append([]Bucket{sum(head)}, buckets...)
+	}
+	if len(tail) > 0 {
+		buckets = append(buckets, sum(tail))
+	}
+	return buckets
+}
+
+// sum combines consecutive buckets into one
+func sum(buckets []Bucket) Bucket {
+	total := Bucket{Low: buckets[0].Low, High: buckets[len(buckets)-1].High}
+	for _, b := range buckets {
+		total.Count += b.Count
+	}
+	return total
+}
+
+// merge combines buckets into rows ranges of equal ratio
+func merge(buckets []Bucket, rows int) []Bucket {
+	low := float64(max(1, buckets[0].Low))
+	high := float64(buckets[len(buckets)-1].High)
+	ratio := math.Pow(high/low, 1/float64(rows))
+
+	coarse := make([]Bucket, rows)
+	for r := range coarse {
+		coarse[r].Low = uint64(math.Round(low * math.Pow(ratio, float64(r))))
+		coarse[r].High = uint64(math.Round(low * math.Pow(ratio, float64(r+1))))
+	}
+	coarse[0].Low = buckets[0].Low
+	coarse[rows-1].High = buckets[len(buckets)-1].High
+
+	for _, b := range buckets {
+		r := 0
+		if b.Low > 0 {
+			r = int(math.Log(float64(b.Low)/low) / math.Log(ratio))
+		}
+		coarse[min(max(r, 0), rows-1)].Count += b.Count
+	}
+	return coarse
+}
@@ -0,0 +1,172 @@
+package histogram
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	// Two significant bits split every power of two into 4 buckets
+	h := New(2)
+	tests := []struct {
+		v         uint64
+		index     int
+		low, high uint64
+	}{
+		{0, 0, 0, 1},
+		{3, 3, 3, 4}, // last value with a bucket of its own
+		{4, 4, 4, 5}, // first power of two with sub-buckets, still 1 wide
+		{7, 7, 7, 8},
+		{8, 8, 8, 10}, // next power of two, buckets 2 wide
+		{9, 8, 8, 10},
+		{15, 11, 14, 16},
+		{16, 12, 16, 20},
+		{1 << 40, 156, 1 << 40, 1<<40 + 1<<38},
+		{1<<41 - 1, 159, 7 << 38, 1 << 41},
+		{math.MaxUint64, 251, 7 << 61, math.MaxUint64},
+	}
+	for _, test := range tests {
+		index := h.index(test.v)
+		low, high := h.bounds(index)
+		if index != test.index || low != test.low || high != test.high {
+			t.Errorf("%d is in bucket %d [%d, %d), want %d [%d, %d)", test.v, index, low, high, test.index, test.low, test.high)
+		}
+	}
+
+	// Every bucket starts where the one before it ends and holds the
+	// values that index maps to it
+	for _, bits := range []int{1, 2, 5} {
+		h := New(bits)
+		prevHigh := uint64(0)
+		for i := 0; i <= h.index(math.MaxUint64); i++ {
+			low, high := h.bounds(i)
+			if low != prevHigh || high <= low {
+				t.Fatalf("%d bits: bucket %d is [%d, %d) after one ending at %d", bits, i, low, high, prevHigh)
+			}
+			if h.index(low) != i || h.index(high-1) != i {
+				t.Fatalf("%d bits: bucket %d [%d, %d) holds values of buckets %d and %d", bits, i, low, high, h.index(low), h.index(high-1))
+			}
+			prevHigh = high
+		}
+		if prevHigh != math.MaxUint64 {
+			t.Errorf("%d bits: last bucket ends at %d", bits, prevHigh)
+		}
+	}
+}
+
+func TestLargestValue(t *testing.T) {
+	h := New(5)
+	h.Record(math.MaxUint64)
+	h.Record(1)
+	if got := h.ValueAt(1); got != math.MaxUint64 {
+		t.Errorf("ValueAt(1) = %d, want %d", got, uint64(math.MaxUint64))
+	}
+	buckets := h.Buckets()
+	if last := buckets[len(buckets)-1]; last.High != math.MaxUint64 || last.Count != 1 {
+		t.Errorf("last bucket %+v, want one value up to %d", last, uint64(math.MaxUint64))
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	uniform := New(5)
+	for v := uint64(1); v <= 1000; v++ {
+		uniform.Record(v)
+	}
+	// 90 fast values and 10 slow ones
+	bimodal := New(5)
+	for i := 0; i < 100; i++ {
+		if i < 90 {
+			bimodal.Record(10)
+		} else {
+			bimodal.Record(1000)
+		}
+	}
+
+	tests := []struct {
+		name string
+		h    *Histogram
+		q    float64
+		want uint64
+	}{
+		{"uniform min", uniform, 0, 1},
+		{"uniform small", uniform, 0.01, 10},    // exact below 64
+		{"uniform median", uniform, 0.5, 503},   // top of [496, 504)
+		{"uniform p99", uniform, 0.99, 991},     // top of [976, 992)
+		{"uniform max", uniform, 1, 1000},       // [992, 1008) capped at the max
+		{"uniform above one", uniform, 2, 1000}, // clamped to the max
+		{"bimodal median", bimodal, 0.5, 10},
+		{"bimodal p90", bimodal, 0.9, 10},
+		{"bimodal p91", bimodal, 0.91, 1000},
+	}
+	for _, test := range tests {
+		if got := test.h.ValueAt(test.q); got != test.want {
+			t.Errorf("%s: ValueAt(%g) = %d, want %d", test.name, test.q, got, test.want)
+		}
+	}
+
+	if uniform.Count() != 1000 || uniform.Min() != 1 || uniform.Max() != 1000 || uniform.Mean() != 500.5 {
+		t.Errorf("count %d, min %d, max %d, mean %g, want 1000, 1, 1000 and 500.5",
+			uniform.Count(), uniform.Min(), uniform.Max(), uniform.Mean())
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	h := New(5)
+	if h.Count() != 0 || h.Mean() != 0 || h.ValueAt(0.5) != 0 || h.ValueAt(0) != 0 {
+		t.Errorf("empty histogram: count %d, mean %g, median %d", h.Count(), h.Mean(), h.ValueAt(0.5))
+	}
+	if buckets := h.Buckets(); buckets != nil {
+		t.Errorf("Buckets() = %v, want nil", buckets)
+	}
+	if buckets := h.Coarsen(10, 0, 100); buckets != nil {
+		t.Errorf("Coarsen() = %v, want nil", buckets)
+	}
+}
+
+func TestCoarsen(t *testing.T) {
+	h := New(2)
+	for v := uint64(1); v <= 1000; v++ {
+		h.Record(v)
+	}
+
+	// Buckets that fit are returned as they are
+	if got := h.Coarsen(100, 0, math.MaxUint64); !reflect.DeepEqual(got, h.Buckets()) {
+		t.Errorf("Coarsen() of %d buckets into 100 rows = %v", len(h.Buckets()), got)
+	}
+
+	tests := []struct {
+		rows      int
+		low, high uint64
+		want      int // ranges
+	}{
+		{4, 10, 500, 6}, // values below 10 and from 512 on get a range each
+		{4, 0, math.MaxUint64, 4},
+		{1, 0, math.MaxUint64, 1},
+		{0, 10, 500, 25}, // no row limit: 23 buckets between the two ranges
+	}
+	for _, test := range tests {
+		buckets := h.Coarsen(test.rows, test.low, test.high)
+		if len(buckets) != test.want {
+			t.Errorf("Coarsen(%d, %d, %d) has %d ranges, want %d: %v", test.rows, test.low, test.high, len(buckets), test.want, buckets)
+		}
+		// The ranges cover the buckets without gaps and keep every value
+		count := uint64(0)
+		for i, b := range buckets {
+			if i > 0 && b.Low != buckets[i-1].High {
+				t.Errorf("Coarsen(%d, %d, %d): range %d starts at %d after one ending at %d", test.rows, test.low, test.high, i, b.Low, buckets[i-1].High)
+			}
+			count += b.Count
+		}
+		if count != h.Count() || buckets[0].Low != 1 || buckets[len(buckets)-1].High != 1024 {
+			t.Errorf("Coarsen(%d, %d, %d) holds %d values from %d to %d, want 1000 from 1 to 1024",
+				test.rows, test.low, test.high, count, buckets[0].Low, buckets[len(buckets)-1].High)
+		}
+	}
+
+	// Values below low and from high on are summed before and after
+	buckets := h.Coarsen(4, 10, 500)
+	if head, tail := buckets[0], buckets[len(buckets)-1]; head.High != 10 || head.Count != 9 || tail.Low != 512 || tail.Count != 489 {
+		t.Errorf("head %+v and tail %+v, want 9 values below 10 and 489 from 512 on", head, tail)
+	}
+}
@@ -0,0 +1,260 @@
+// Package memcheck provides memtest86-style RAM correctness testing from userspace
+package memcheck
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/dryrun"
+	"app/pkg/physaddr"
+	"app/pkg/sysmem"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Config holds all configuration parameters for correctness tests
+type Config struct {
+	Fraction  float64 // fraction of available memory to test, within any cgroup limit
+	SizeInMB  int     // explicit size to test, overrides Fraction when > 0
+	Passes    int
+	Threads   int
+	Alloc     alloc.Strategy
+	Lock      bool // mlock the buffer so it stays in RAM
+	MaxErrors int  // mismatches to keep for the report, 0 for no limit
+	Seed      uint64
+}
+
+// NewDefaultConfig creates a Config with sensible defaults
+func NewDefaultConfig() *Config {
+	return &Config{
+		Fraction:  0.5,
+		SizeInMB:  0,
+		Passes:    1,
+		Threads:   runtime.NumCPU(),
+		Alloc:     alloc.Heap,
+		Lock:      true,
+		MaxErrors: 100,
+		Seed:      uint64(time.Now().UnixNano()),
+	}
+}
+
+// Mismatch describes a word that did not read back what was written
+type Mismatch struct {
+	Test     string
+	Address  uintptr // virtual address of the word
+	Expected uint64
+	Actual   uint64
+
+	// Physical location of the word, resolved while the buffer is still
+	// mapped. PhysicalErr explains why it is missing.
+	Physical    *physaddr.Location
+	PhysicalErr error
+}
+
+// NewMismatch describes a mismatch found in buf[i] outside of a MemChecker
+// and resolves its physical location
+func NewMismatch(test string, buf []uint64, i int, expected, actual uint64) Mismatch {
+	mismatch := Mismatch{
+		Test:     test,
+		Address:  uintptr(unsafe.Pointer(&buf[i])),
+		Expected: expected,
+		Actual:   actual,
+	}
+	if location, err := physaddr.Resolve(mismatch.Address); err != nil {
+		mismatch.PhysicalErr = err
+	} else {
+		mismatch.Physical = &location
+	}
+	return mismatch
+}
+
+// FlippedBits returns the positions of the bits that differ
+func (e Mismatch) FlippedBits() []int {
+	var positions []int
+	for diff := e.Expected ^ e.Actual; diff != 0; diff &= diff - 1 {
+		positions = append(positions, bits.TrailingZeros64(diff))
+	}
+	return positions
+}
+
+// String formats the mismatch for reports
+func (e Mismatch) String() string {
+	physical := fmt.Sprintf("physical address unavailable: %v", e.PhysicalErr)
+	if e.Physical != nil {
+		physical = e.Physical.String()
+	}
+	return fmt.Sprintf("[%s] addr 0x%x: expected 0x%016x, got 0x%016x, flipped bits %v\n    %s",
+		e.Test, e.Address, e.Expected, e.Actual, e.FlippedBits(), physical)
+}
+
+// PrintDIMMSummary prints how many of the mismatches fall on each memory
+// module, so the failing module can be identified
+func PrintDIMMSummary(mismatches []Mismatch) {
+	counts := make(map[string]int)
+	var names []string
+	for _, mismatch := range mismatches {
+		name := "unknown"
+		if mismatch.Physical != nil {
+			name = mismatch.Physical.Module()
+		}
+		if counts[name] == 0 {
+			names = append(names, name)
+		}
+		counts[name]++
+	}
+
+	fmt.Println("\n==== Errors by DIMM ====")
+	for _, name := range names {
+		fmt.Printf("%-40s %d\n", name, counts[name])
+	}
+}
+
+// MemChecker runs correctness tests over one buffer
+type MemChecker struct {
+	Config *Config
+
+	mu         sync.Mutex
+	mismatches []Mismatch
+	errors     int
+}
+
+// NewMemChecker creates a new checker with the given configuration
+func NewMemChecker(config *Config) *MemChecker {
+	if config == nil {
+		config = NewDefaultConfig()
+	}
+	return &MemChecker{Config: config}
+}
+
+// TestSize returns the number of bytes the checker will test
+func (c *MemChecker) TestSize() (int, error) {
+	if c.Config.SizeInMB > 0 {
+		return c.Config.SizeInMB * 1024 * 1024, nil
+	}
+	budget, err := sysmem.ReadBudget()
+	if err != nil {
+		return 0, fmt.Errorf("cannot determine available memory, set a size explicitly: %w", err)
+	}
+	return int(float64(budget.Available()) * c.Config.Fraction), nil
+}
+
+// RunAll allocates the test buffer and runs every test for the configured
+// number of passes. It returns the mismatches found, limited to MaxErrors.
+func (c *MemChecker) RunAll() ([]Mismatch, error) {
+	fmt.Println("Memory Correctness Test - Similar to memtest86")
+
+	size, err := c.TestSize()
+	if err != nil {
+		return nil, err
+	}
+	words := size / 8
+	if words < c.Config.Threads*2 {
+		return nil, fmt.Errorf("test size of %d bytes is too small", size)
+	}
+
+	fmt.Printf("Allocating %d MB of RAM for testing (%s)...\n", size/1024/1024, c.Config.Alloc)
+	buf, buffer, err := alloc.Alloc[uint64](c.Config.Alloc, words)
+	if err != nil {
+		return nil, err
+	}
+	defer buffer.Free()
+	if c.Config.Lock {
+		if err := buffer.Lock(); err != nil {
+			fmt.Printf("Warning: mlock failed (%v); pages may be swapped out during the test.\n", err)
+			fmt.Println("Raise RLIMIT_MEMLOCK (ulimit -l) or run as root to lock the buffer.")
+		} else {
+			fmt.Println("Buffer locked in RAM")
+		}
+	}
+
+	for pass := 1; pass <= c.Config.Passes; pass++ {
+		fmt.Printf("\n==== Pass %d of %d ====\n", pass, c.Config.Passes)
+		for _, test := range c.tests() {
+			start := time.Now()
+			before := c.ErrorCount()
+			test.run(buf)
+			fmt.Printf("%-20s %10v  errors: %d\n", test.name, time.Since(start).Round(time.Millisecond), c.ErrorCount()-before)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Mismatch(nil), c.mismatches...), nil
+}
+
+// DryRun prints every test that RunAll would run with the buffer size,
+// passes and an estimated time from a short calibration probe
+func (c *MemChecker) DryRun() error {
+	size, err := c.TestSize()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\nCalibrating...")
+	cal := dryrun.Calibrate()
+	fmt.Println("Calibration:", cal)
+
+	// Sweeps are split between the threads as far as there are CPUs for them
+	parallel := time.Duration(max(1, min(c.Config.Threads, runtime.GOMAXPROCS(0))))
+	steps := []dryrun.Step{{
+		Name:       "allocate",
+		WorkingSet: fmt.Sprintf("%d MB", size>>20),
+		Threads:    1,
+		PeakBytes:  int64(size),
+		Duration:   cal.FirstTouch(int64(size)),
+	}}
+	for _, test := range c.tests() {
+		sweeps := int64(test.sweeps * c.Config.Passes)
+		steps = append(steps, dryrun.Step{
+			Name:       test.name,
+			WorkingSet: fmt.Sprintf("%d MB x%d", size>>20, sweeps),
+			Iterations: sweeps * int64(size/8),
+			Threads:    c.Config.Threads,
+			PeakBytes:  int64(size),
+			Duration:   cal.Stream(sweeps*int64(size)) / parallel,
+		})
+	}
+	dryrun.Print(steps)
+	return nil
+}
+
+// ErrorCount returns the total number of mismatches found so far,
+// including those not kept because of MaxErrors
+func (c *MemChecker) ErrorCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errors
+}
+
+// report records a mismatch at buf[i]
+func (c *MemChecker) report(test string, buf []uint64, i int, expected, actual uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors++
+	if c.Config.MaxErrors == 0 || len(c.mismatches) < c.Config.MaxErrors {
+		c.mismatches = append(c.mismatches, NewMismatch(test, buf, i, expected, actual))
+	}
+}
+
+// parallel splits buf into one contiguous chunk per thread and runs fn on
+// each chunk concurrently, passing the chunk index and its bounds
+func (c *MemChecker) parallel(buf []uint64, fn func(chunk, lo, hi int)) {
+	threads := max(1, c.Config.Threads)
+	size := (len(buf) + threads - 1) / threads
+
+	var wg sync.WaitGroup
+	for t := 0; t < threads; t++ {
+		lo, hi := t*size, min((t+1)*size, len(buf))
+		if lo >= hi {
+			break
+		}
+		wg.Add(1)
+		go func(chunk int) {
+			defer wg.Done()
+			fn(chunk, lo, hi)
+		}(t)
+	}
+	wg.Wait()
+}
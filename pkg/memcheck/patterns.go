@@ -0,0 +1,213 @@
+package memcheck
+
+import "unsafe"
+
+// blockMoveWords is the size of the blocks moved by the block move test
+const blockMoveWords = 512 * 1024 // 4 MB
+
+// memTest is one named correctness test
+type memTest struct {
+	name   string
+	run    func(buf []uint64)
+	sweeps int // full passes over the buffer, for time estimates
+}
+
+// tests returns the correctness tests in the order they run
+func (c *MemChecker) tests() []memTest {
+	return []memTest{
+		{"walking-ones", c.walkingOnes, 64 * 2},
+		{"walking-zeros", c.walkingZeros, 64 * 2},
+		{"moving-inversions", c.movingInversions, 4 * 3},
+		{"own-address", c.ownAddress, 2 * 2},
+		{"checkerboard", c.checkerboard, 2 * 2},
+		{"random-pattern", c.randomPattern, 2},
+		{"block-move", c.blockMove, 3},
+	}
+}
+
+// fillVerify writes pattern to every word and reads it back
+func (c *MemChecker) fillVerify(test string, buf []uint64, pattern uint64) {
+	c.parallel(buf, func(_, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			buf[i] = pattern
+		}
+		for i := lo; i < hi; i++ {
+			if buf[i] != pattern {
+				c.report(test, buf, i, pattern, buf[i])
+			}
+		}
+	})
+}
+
+// walkingOnes fills memory with a single set bit walking through all positions
+func (c *MemChecker) walkingOnes(buf []uint64) {
+	for bit := 0; bit < 64; bit++ {
+		c.fillVerify("walking-ones", buf, 1<<bit)
+	}
+}
+
+// walkingZeros fills memory with a single clear bit walking through all positions
+func (c *MemChecker) walkingZeros(buf []uint64) {
+	for bit := 0; bit < 64; bit++ {
+		c.fillVerify("walking-zeros", buf, ^uint64(1<<bit))
+	}
+}
+
+// movingInversions is memtest86's moving inversions test: fill with a
+// pattern, then walk up verifying and writing the complement, then walk
+// down verifying the complement and writing the pattern back
+func (c *MemChecker) movingInversions(buf []uint64) {
+	for _, pattern := range []uint64{0, ^uint64(0), 0x0f0f0f0f0f0f0f0f, splitmix64(c.Config.Seed)} {
+		inverse := ^pattern
+		c.parallel(buf, func(_, lo, hi int) {
+			for i := lo; i < hi; i++ {
+				buf[i] = pattern
+			}
+			for i := lo; i < hi; i++ {
+				if buf[i] != pattern {
+					c.report("moving-inversions", buf, i, pattern, buf[i])
+				}
+				buf[i] = inverse
+			}
+			for i := hi - 1; i >= lo; i-- {
+				if buf[i] != inverse {
+					c.report("moving-inversions", buf, i, inverse, buf[i])
+				}
+				buf[i] = pattern
+			}
+		})
+	}
+}
+
+// ownAddress writes every word's own address into it, then its complement,
+// which catches address line faults that map two addresses to one cell
+func (c *MemChecker) ownAddress(buf []uint64) {
+	for _, invert := range []bool{false, true} {
+		c.parallel(buf, func(_, lo, hi int) {
+			for i := lo; i < hi; i++ {
+				buf[i] = addressPattern(&buf[i], invert)
+			}
+			for i := lo; i < hi; i++ {
+				if expected := addressPattern(&buf[i], invert); buf[i] != expected {
+					c.report("own-address", buf, i, expected, buf[i])
+				}
+			}
+		})
+	}
+}
+
+// checkerboard writes alternating bit patterns to neighboring words
+func (c *MemChecker) checkerboard(buf []uint64) {
+	const even, odd = 0x5555555555555555, 0xaaaaaaaaaaaaaaaa
+	for _, first := range []uint64{even, odd} {
+		second := ^first
+		c.parallel(buf, func(_, lo, hi int) {
+			for i := lo; i < hi; i++ {
+				buf[i] = checkerPattern(i, first, second)
+			}
+			for i := lo; i < hi; i++ {
+				if expected := checkerPattern(i, first, second); buf[i] != expected {
+					c.report("checkerboard", buf, i, expected, buf[i])
+				}
+			}
+		})
+	}
+}
+
+// randomPattern fills memory from a seeded generator and verifies it by
+// replaying the same sequence
+func (c *MemChecker) randomPattern(buf []uint64) {
+	c.parallel(buf, func(chunk, lo, hi int) {
+		seed := c.Config.Seed + uint64(chunk)<<32
+		FillRandom(buf[lo:hi], seed)
+		VerifyRandom(buf[lo:hi], seed, func(i int, expected, actual uint64) {
+			c.report("random-pattern", buf, lo+i, expected, actual)
+		})
+	})
+}
+
+// FillRandom fills buf with the pseudo-random sequence for seed
+func FillRandom(buf []uint64, seed uint64) {
+	state := seed
+	for i := range buf {
+		state += 0x9e3779b97f4a7c15
+		buf[i] = splitmix64(state)
+	}
+}
+
+// VerifyRandom checks buf against the sequence written by FillRandom and
+// calls onMismatch for every word that differs. It returns the number of
+// mismatches.
+func VerifyRandom(buf []uint64, seed uint64, onMismatch func(i int, expected, actual uint64)) int {
+	errors := 0
+	state := seed
+	for i := range buf {
+		state += 0x9e3779b97f4a7c15
+		if expected := splitmix64(state); buf[i] != expected {
+			errors++
+			onMismatch(i, expected, buf[i])
+		}
+	}
+	return errors
+}
+
+// blockMove fills blocks with distinct patterns, then moves every block onto
+// its neighbor with copy and verifies the moved data
+func (c *MemChecker) blockMove(buf []uint64) {
+	blocks := len(buf) / blockMoveWords
+	if blocks < 2 {
+		return
+	}
+
+	pattern := func(block, i int) uint64 {
+		return splitmix64(c.Config.Seed ^ uint64(block)<<40 ^ uint64(i))
+	}
+
+	for b := 0; b < blocks; b++ {
+		block := buf[b*blockMoveWords : (b+1)*blockMoveWords]
+		for i := range block {
+			block[i] = pattern(b, i)
+		}
+	}
+
+	// Move each block one slot up, starting from the top so nothing is
+	// overwritten before it has been moved
+	for b := blocks - 1; b > 0; b-- {
+		copy(buf[b*blockMoveWords:(b+1)*blockMoveWords], buf[(b-1)*blockMoveWords:b*blockMoveWords])
+	}
+
+	// Block 0 keeps its own data, every other block holds its lower neighbor's
+	for b := 0; b < blocks; b++ {
+		source := max(b-1, 0)
+		for i := 0; i < blockMoveWords; i++ {
+			index := b*blockMoveWords + i
+			if expected := pattern(source, i); buf[index] != expected {
+				c.report("block-move", buf, index, expected, buf[index])
+			}
+		}
+	}
+}
+
+// addressPattern returns the address of p, optionally complemented
+func addressPattern(p *uint64, invert bool) uint64 {
+	address := uint64(uintptr(unsafe.Pointer(p)))
+	if invert {
+		return ^address
+	}
+	return address
+}
+
+// checkerPattern returns first for even words and second for odd words
+func checkerPattern(i int, first, second uint64) uint64 {
+	if i%2 == 0 {
+		return first
+	}
+	return second
+}
+
+// splitmix64 is a fast, well-mixed hash used to generate test patterns
+func splitmix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
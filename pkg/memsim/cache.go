@@ -0,0 +1,161 @@
+package memsim
+
+import (
+	"fmt"
+)
+
+// cache is a set-associative array of tags. It holds cache lines for the
+// caches and page numbers for the TLB.
+type cache struct {
+	sets, ways int
+	mask       uint64 // sets-1 when sets is a power of two, else 0
+	policy     Policy
+	tags       []uint64 // sets*ways slots, a tag plus one so 0 is empty
+	prefetched []bool   // slots filled by the prefetcher and not loaded yet
+	used       []uint64 // LRU: when each slot was last used
+	tree       []uint64 // PLRU: ways-1 direction bits per set, as a heap
+	clock      uint64
+}
+
+// validateSets checks that entries split evenly into sets of ways entries
+func validateSets(entries, ways int, policy Policy) error {
+	switch {
+	case ways <= 0 || entries < ways:
+		return fmt.Errorf("%d entries cannot hold %d ways", entries, ways)
+	case entries%ways != 0:
+		return fmt.Errorf("%d entries are not a multiple of %d ways", entries, ways)
+	case policy != "" && policy != LRU && policy != PLRU:
+		return fmt.Errorf("unknown replacement policy %q", policy)
+	case policy == PLRU && (ways&(ways-1) != 0 || ways > 64):
+		return fmt.Errorf("tree PLRU needs a power of two ways up to 64, not %d", ways)
+	}
+	return nil
+}
+
+// newCache allocates an empty cache of entries slots
+func newCache(entries, ways int, policy Policy) *cache {
+	c := &cache{
+		sets:       entries / ways,
+		ways:       ways,
+		policy:     policy,
+		tags:       make([]uint64, entries),
+		prefetched: make([]bool, entries),
+	}
+	if c.sets&(c.sets-1) == 0 {
+		c.mask = uint64(c.sets - 1)
+	}
+	if policy == PLRU {
+		c.tree = make([]uint64, c.sets)
+	} else {
+		c.used = make([]uint64, entries)
+	}
+	return c
+}
+
+// set returns the first slot of the set a tag maps to
+func (c *cache) set(tag uint64) int {
+	if c.mask > 0 || c.sets == 1 {
+		return int(tag&c.mask) * c.ways
+	}
+	return int(tag%uint64(c.sets)) * c.ways
+}
+
+// find returns the slot holding tag, or -1
+func (c *cache) find(tag uint64) int {
+	first := c.set(tag)
+	for slot := first; slot < first+c.ways; slot++ {
+		if c.tags[slot] == tag+1 {
+			return slot
+		}
+	}
+	return -1
+}
+
+// contains reports whether tag is cached without counting it as a use
+func (c *cache) contains(tag uint64) bool {
+	return c.find(tag) >= 0
+}
+
+// access looks tag up and marks it used on a hit
+func (c *cache) access(tag uint64) bool {
+	slot := c.find(tag)
+	if slot < 0 {
+		return false
+	}
+	c.touch(slot)
+	return true
+}
+
+// takePrefetched reports whether tag was prefetched and not loaded since,
+// and clears the mark
+func (c *cache) takePrefetched(tag uint64) bool {
+	slot := c.find(tag)
+	if slot < 0 || !c.prefetched[slot] {
+		return false
+	}
+	c.prefetched[slot] = false
+	return true
+}
+
+// insert puts tag into its set, replacing an empty slot or the policy's
+// victim, and marks it used
+func (c *cache) insert(tag uint64, prefetched bool) {
+	slot := c.victim(c.set(tag))
+	c.tags[slot] = tag + 1
+	c.prefetched[slot] = prefetched
+	c.touch(slot)
+}
+
+// touch marks a slot as the most recently used of its set
+func (c *cache) touch(slot int) {
+	if c.policy != PLRU {
+		c.clock++
+		c.used[slot] = c.clock
+		return
+	}
+	// Point every node on the path to the way at the other half
+	set, way := slot/c.ways, slot%c.ways
+	node := 1
+	for half := c.ways / 2; half > 0; half /= 2 {
+		right := way&half != 0
+		if right {
+			c.tree[set] &^= 1 << node
+		} else {
+			c.tree[set] |= 1 << node
+		}
+		node = 2*node + b2i(right)
+	}
+}
+
+// victim returns the slot of a set to replace: an empty one when there
+// is one, else the least recently used or the one the PLRU tree points at
+func (c *cache) victim(first int) int {
+	if c.policy != PLRU {
+		// Empty slots were never used, so they are the oldest
+		victim := first
+		for slot := first + 1; slot < first+c.ways; slot++ {
+			if c.used[slot] < c.used[victim] {
+				victim = slot
+			}
+		}
+		return victim
+	}
+	for slot := first; slot < first+c.ways; slot++ {
+		if c.tags[slot] == 0 {
+			return slot
+		}
+	}
+	bits, node := c.tree[first/c.ways], 1
+	for node < c.ways {
+		node = 2*node + int(bits>>node&1)
+	}
+	return first + node - c.ways
+}
+
+// b2i converts a bool to 0 or 1
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
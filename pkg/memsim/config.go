@@ -0,0 +1,238 @@
+package memsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Presets are simulated CPUs after the published geometry of common
+// processors. Latencies are rounded load-to-use times at typical clocks.
+var Presets = []Config{
+	{
+		Name:     "skylake",
+		LineSize: 64,
+		Caches: []CacheConfig{
+			{Size: 32 << 10, Ways: 8, Policy: PLRU, LatencyNs: 1.0},
+			{Size: 256 << 10, Ways: 4, Policy: PLRU, LatencyNs: 3.0},
+			{Size: 8 << 20, Ways: 16, Policy: LRU, LatencyNs: 10.5},
+		},
+		TLB:        TLBConfig{Entries: 1536, Ways: 12, PageSize: 4096, MissNs: 8},
+		Prefetcher: PrefetcherConfig{Streams: 16, Distance: 8, Level: 2},
+		MemoryNs:   80,
+	},
+	{
+		Name:     "zen3",
+		LineSize: 64,
+		Caches: []CacheConfig{
+			{Size: 32 << 10, Ways: 8, Policy: PLRU, LatencyNs: 1.0},
+			{Size: 512 << 10, Ways: 8, Policy: PLRU, LatencyNs: 3.0},
+			{Size: 32 << 20, Ways: 16, Policy: LRU, LatencyNs: 11.5},
+		},
+		TLB:        TLBConfig{Entries: 2048, Ways: 16, PageSize: 4096, MissNs: 7},
+		Prefetcher: PrefetcherConfig{Streams: 16, Distance: 8, Level: 2},
+		MemoryNs:   75,
+	},
+	{
+		Name:     "sapphire-rapids",
+		LineSize: 64,
+		Caches: []CacheConfig{
+			{Size: 48 << 10, Ways: 12, Policy: LRU, LatencyNs: 1.2},
+			{Size: 2 << 20, Ways: 16, Policy: PLRU, LatencyNs: 4.5},
+			{Size: 105 << 20, Ways: 15, Policy: LRU, LatencyNs: 30},
+		},
+		TLB:        TLBConfig{Entries: 2048, Ways: 16, PageSize: 4096, MissNs: 10},
+		Prefetcher: PrefetcherConfig{Streams: 32, Distance: 16, Level: 2},
+		MemoryNs:   110,
+	},
+	{
+		Name:     "m1",
+		LineSize: 128,
+		Caches: []CacheConfig{
+			{Size: 128 << 10, Ways: 8, Policy: PLRU, LatencyNs: 0.9},
+			{Size: 12 << 20, Ways: 12, Policy: LRU, LatencyNs: 5.2},
+		},
+		TLB:        TLBConfig{Entries: 3072, Ways: 12, PageSize: 16384, MissNs: 6},
+		Prefetcher: PrefetcherConfig{Streams: 16, Distance: 8, Level: 2},
+		MemoryNs:   95,
+	},
+}
+
+// PresetNames returns the names of the Presets for usage messages
+func PresetNames() string {
+	names := make([]string, len(Presets))
+	for i, p := range Presets {
+		names[i] = p.Name
+	}
+	return strings.Join(names, "|")
+}
+
+// Parse reads a simulated CPU from a comma separated spec. It may start
+// with the name of a preset, and every other item sets one part:
+//
+//	L<n>=SIZE/WAYS/NS[/POLICY]     cache level n, e.g. L2=1M/16/4.5/plru
+//	mem=NS                         main memory latency
+//	line=BYTES                     cache line size
+//	tlb=ENTRIES/WAYS/NS            TLB and page walk cost, tlb=0 for none
+//	page=SIZE                      page size
+//	prefetch=STREAMS/DISTANCE/LEVEL  stride prefetcher, prefetch=0 for none
+//
+// For example "skylake,L3=16M/16/12" is a Skylake with a larger L3, and
+// "L1=32K/8/1,L2=1M/16/4,mem=90" a CPU without a TLB or prefetcher.
+func Parse(spec string) (Config, error) {
+	config := Config{Name: "custom", LineSize: 64}
+	for i, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			preset, found := findPreset(item)
+			if i > 0 || !found {
+				return Config{}, fmt.Errorf("unknown simulated CPU %q, want one of %s or a spec", item, PresetNames())
+			}
+			config = preset
+			config.Caches = append([]CacheConfig(nil), preset.Caches...)
+			continue
+		}
+		if err := config.set(strings.ToLower(key), value); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", item, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// findPreset returns the preset with the given name
+func findPreset(name string) (Config, bool) {
+	for _, p := range Presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Config{}, false
+}
+
+// set applies one key=value item of a spec
+func (c *Config) set(key, value string) error {
+	fields := strings.Split(value, "/")
+	switch {
+	case key == "mem":
+		return parseFields(fields, &c.MemoryNs)
+	case key == "line":
+		return parseFields(fields, &c.LineSize)
+	case key == "page":
+		return parseFields(fields, &c.TLB.PageSize)
+	case key == "tlb":
+		if value == "0" {
+			c.TLB.Entries = 0
+			return nil
+		}
+		return parseFields(fields, &c.TLB.Entries, &c.TLB.Ways, &c.TLB.MissNs)
+	case key == "prefetch":
+		if value == "0" {
+			c.Prefetcher = PrefetcherConfig{}
+			return nil
+		}
+		return parseFields(fields, &c.Prefetcher.Streams, &c.Prefetcher.Distance, &c.Prefetcher.Level)
+	case strings.HasPrefix(key, "l"):
+		level, err := strconv.Atoi(key[1:])
+		if err != nil || level < 1 || level > len(c.Caches)+1 {
+			return fmt.Errorf("cache level %s must be L1 to L%d", strings.ToUpper(key), len(c.Caches)+1)
+		}
+		var cache CacheConfig
+		if len(fields) == 4 {
+			cache.Policy = Policy(strings.ToLower(fields[3]))
+			fields = fields[:3]
+		}
+		if err := parseFields(fields, &cache.Size, &cache.Ways, &cache.LatencyNs); err != nil {
+			return err
+		}
+		if level > len(c.Caches) {
+			c.Caches = append(c.Caches, cache)
+		} else {
+			c.Caches[level-1] = cache
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+// parseFields parses fields into the given ints, which take sizes with a
+// K, M or G suffix, and float64s
+func parseFields(fields []string, targets ...any) error {
+	if len(fields) != len(targets) {
+		return fmt.Errorf("want %d values separated by /, got %d", len(targets), len(fields))
+	}
+	for i, field := range fields {
+		switch t := targets[i].(type) {
+		case *int:
+			n, err := parseSize(field)
+			if err != nil {
+				return err
+			}
+			*t = n
+		case *float64:
+			f, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", field)
+			}
+			*t = f
+		}
+	}
+	return nil
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+func parseSize(s string) (int, error) {
+	shift := 0
+	switch strings.ToUpper(s[len(s)-min(1, len(s)):]) {
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// String describes the geometry on one line, e.g. "skylake: L1 32 KB
+// 8-way plru 1.00 ns, ..."
+func (c Config) String() string {
+	parts := []string{}
+	for i, cache := range c.Caches {
+		policy := cache.Policy
+		if policy == "" {
+			policy = LRU
+		}
+		parts = append(parts, fmt.Sprintf("L%d %s %d-way %s %.2f ns", i+1, formatSize(cache.Size), cache.Ways, policy, cache.LatencyNs))
+	}
+	parts = append(parts, fmt.Sprintf("memory %.2f ns", c.MemoryNs))
+	if c.TLB.Entries > 0 {
+		parts = append(parts, fmt.Sprintf("TLB %d entries %d-way %s pages %.2f ns walk",
+			c.TLB.Entries, c.TLB.Ways, formatSize(c.pageSize()), c.TLB.MissNs))
+	}
+	if p := c.Prefetcher; p.Streams > 0 {
+		parts = append(parts, fmt.Sprintf("prefetcher %d streams %d lines ahead into L%d", p.Streams, p.Distance, p.Level))
+	}
+	return fmt.Sprintf("%s: %d B lines, %s", c.Name, c.LineSize, strings.Join(parts, ", "))
+}
+
+// formatSize formats a power of two byte count, e.g. "32 KB"
+func formatSize(bytes int) string {
+	switch {
+	case bytes >= 1<<20 && bytes%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", bytes>>20)
+	case bytes >= 1<<10 && bytes%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", bytes>>10)
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
@@ -0,0 +1,239 @@
+// Package memsim simulates a memory hierarchy: set-associative caches with
+// LRU or tree-PLRU replacement, a TLB and a stride prefetcher, each with a
+// latency cost. Feeding it the addresses a workload loads gives the time
+// those loads would take on a CPU of known geometry, deterministically and
+// without timing real hardware, so detection algorithms can be checked
+// against the geometry they should find.
+//
+// Every load is modeled as dependent on the one before it, the way a
+// pointer chase is, so its latency is added in full. For independent loads
+// that a real CPU overlaps the result is an upper bound.
+package memsim
+
+import (
+	"fmt"
+)
+
+// Config describes a simulated CPU
+type Config struct {
+	Name       string
+	LineSize   int           // bytes per cache line, for every level
+	Caches     []CacheConfig // from the smallest, L1, to the largest
+	TLB        TLBConfig
+	Prefetcher PrefetcherConfig
+	MemoryNs   float64 // latency of a load that misses every cache
+}
+
+// CacheConfig describes one cache level
+type CacheConfig struct {
+	Size      int     // bytes
+	Ways      int     // lines per set
+	Policy    Policy  // replacement policy, LRU when empty
+	LatencyNs float64 // load-to-use latency of a hit at this level
+}
+
+// TLBConfig describes the TLB. A load that misses it pays MissNs for the
+// page walk on top of its cache or memory latency.
+type TLBConfig struct {
+	Entries  int     // translations held, 0 for no TLB
+	Ways     int     // entries per set
+	PageSize int     // bytes, 4096 when 0
+	MissNs   float64 // cost of a page walk
+}
+
+// Policy is a cache replacement policy
+type Policy string
+
+const (
+	LRU  Policy = "lru"  // evicts the least recently used line
+	PLRU Policy = "plru" // tree pseudo-LRU, needs a power of two ways
+)
+
+// defaultPageSize is the page size when TLBConfig.PageSize is 0
+const defaultPageSize = 4096
+
+// pageSize returns the page size the TLB and the prefetcher work with
+func (c Config) pageSize() int {
+	if c.TLB.PageSize > 0 {
+		return c.TLB.PageSize
+	}
+	return defaultPageSize
+}
+
+// Validate checks that the geometry can be built
+func (c Config) Validate() error {
+	if c.LineSize <= 0 || c.LineSize&(c.LineSize-1) != 0 {
+		return fmt.Errorf("line size %d is not a power of two", c.LineSize)
+	}
+	if len(c.Caches) == 0 {
+		return fmt.Errorf("no cache levels")
+	}
+	for i, cache := range c.Caches {
+		if err := validateSets(cache.Size/c.LineSize, cache.Ways, cache.Policy); err != nil {
+			return fmt.Errorf("L%d: %w", i+1, err)
+		}
+	}
+	if c.TLB.Entries > 0 {
+		if c.pageSize()%c.LineSize != 0 {
+			return fmt.Errorf("TLB: page size %d is not a multiple of the line size", c.pageSize())
+		}
+		if err := validateSets(c.TLB.Entries, c.TLB.Ways, LRU); err != nil {
+			return fmt.Errorf("TLB: %w", err)
+		}
+	}
+	if p := c.Prefetcher; p.Streams > 0 && (p.Level < 1 || p.Level > len(c.Caches)) {
+		return fmt.Errorf("prefetcher: level %d is not one of L1 to L%d", p.Level, len(c.Caches))
+	}
+	return nil
+}
+
+// Stats counts what the loads since the last Reset did
+type Stats struct {
+	Loads            uint64
+	TotalNs          float64
+	Levels           []LevelStats // one per cache level
+	MemoryLoads      uint64       // loads that missed every cache
+	TLBMisses        uint64
+	Prefetches       uint64 // lines the prefetcher brought in
+	UsefulPrefetches uint64 // prefetched lines a load hit before they were evicted
+}
+
+// LevelStats counts the lookups of one cache level
+type LevelStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRate returns the share of lookups that hit, 0 without lookups
+func (l LevelStats) HitRate() float64 {
+	if l.Hits+l.Misses == 0 {
+		return 0
+	}
+	return float64(l.Hits) / float64(l.Hits+l.Misses)
+}
+
+// NsPerLoad returns the average latency of the loads
+func (s Stats) NsPerLoad() float64 {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.TotalNs / float64(s.Loads)
+}
+
+// Hierarchy is a simulated memory hierarchy. It is not safe for concurrent
+// use.
+type Hierarchy struct {
+	config     Config
+	lineShift  uint
+	caches     []*cache
+	tlb        *cache // caches page numbers instead of lines
+	pageShift  uint
+	prefetcher *prefetcher
+	stats      Stats
+}
+
+// New builds an empty hierarchy from a validated configuration
+func New(config Config) (*Hierarchy, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", config.Name, err)
+	}
+	h := &Hierarchy{config: config, lineShift: log2(config.LineSize), pageShift: log2(config.pageSize())}
+	for _, c := range config.Caches {
+		h.caches = append(h.caches, newCache(c.Size/config.LineSize, c.Ways, c.Policy))
+	}
+	if config.TLB.Entries > 0 {
+		h.tlb = newCache(config.TLB.Entries, config.TLB.Ways, LRU)
+	}
+	if config.Prefetcher.Streams > 0 {
+		h.prefetcher = newPrefetcher(config.Prefetcher, config.pageSize()/config.LineSize)
+	}
+	h.Reset()
+	return h, nil
+}
+
+// Config returns the configuration the hierarchy was built from
+func (h *Hierarchy) Config() Config {
+	return h.config
+}
+
+// Load simulates a load from addr and returns its latency in ns
+func (h *Hierarchy) Load(addr uint64) float64 {
+	ns := 0.0
+	if h.tlb != nil && !h.tlb.access(addr>>h.pageShift) {
+		h.tlb.insert(addr>>h.pageShift, false)
+		h.stats.TLBMisses++
+		ns += h.config.TLB.MissNs
+	}
+
+	line := addr >> h.lineShift
+	level := len(h.caches)
+	for i, c := range h.caches {
+		if c.access(line) {
+			level = i
+			break
+		}
+		h.stats.Levels[i].Misses++
+	}
+	if level < len(h.caches) {
+		h.stats.Levels[level].Hits++
+		if h.caches[level].takePrefetched(line) {
+			h.stats.UsefulPrefetches++
+		}
+		ns += h.config.Caches[level].LatencyNs
+	} else {
+		h.stats.MemoryLoads++
+		ns += h.config.MemoryNs
+	}
+	// Every level the load missed keeps the line from now on
+	for i := 0; i < level; i++ {
+		h.caches[i].insert(line, false)
+	}
+
+	if h.prefetcher != nil {
+		for _, p := range h.prefetcher.observe(line) {
+			h.prefetch(p)
+		}
+	}
+
+	h.stats.Loads++
+	h.stats.TotalNs += ns
+	return ns
+}
+
+// prefetch brings a line into the prefetcher's level and every larger one
+// that does not hold it yet
+func (h *Hierarchy) prefetch(line uint64) {
+	target := h.config.Prefetcher.Level - 1
+	if h.caches[target].contains(line) {
+		return
+	}
+	h.stats.Prefetches++
+	h.caches[target].insert(line, true)
+	for _, c := range h.caches[target+1:] {
+		if !c.contains(line) {
+			c.insert(line, false)
+		}
+	}
+}
+
+// Stats returns the counts since the hierarchy was built or last reset
+func (h *Hierarchy) Stats() Stats {
+	stats := h.stats
+	stats.Levels = append([]LevelStats(nil), h.stats.Levels...)
+	return stats
+}
+
+// Reset clears the counts but keeps the contents of the caches, so a
+// measurement can follow a warm-up
+func (h *Hierarchy) Reset() {
+	h.stats = Stats{Levels: make([]LevelStats, len(h.caches))}
+}
+
+// log2 returns the exponent of a power of two
+func log2(n int) uint {
+	shift := uint(0)
+	for 1<<shift < n {
+		shift++
+	}
+	return shift
+}
@@ -0,0 +1,244 @@
+package memsim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fill inserts the tags 0 to ways-1 into a single set cache, which puts
+// tag i into way i
+func fill(c *cache) {
+	for tag := 0; tag < c.ways; tag++ {
+		c.insert(uint64(tag), false)
+	}
+}
+
+// evicted inserts a new tag and returns the one it replaced
+func evicted(t *testing.T, c *cache, tag uint64) uint64 {
+	t.Helper()
+	before := append([]uint64(nil), c.tags...)
+	c.insert(tag, false)
+	for slot, old := range before {
+		if c.tags[slot] != old {
+			return old - 1
+		}
+	}
+	t.Fatalf("inserting %d replaced nothing", tag)
+	return 0
+}
+
+func TestVictim(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		ways   int
+		use    []uint64 // tags used after the set is filled
+		want   uint64   // tag the next insert replaces
+	}{
+		{"lru oldest", LRU, 4, nil, 0},
+		{"lru after reuse", LRU, 4, []uint64{0}, 1},
+		{"lru reuse order", LRU, 4, []uint64{2, 0, 3, 1}, 2},
+		{"plru oldest", PLRU, 4, nil, 0},
+		// The tree points away from way 0 at the root and away from way 3
+		// below, so it picks way 2 where true LRU picks way 1
+		{"plru after reuse", PLRU, 4, []uint64{0}, 2},
+		{"plru reuse order", PLRU, 4, []uint64{2, 0, 3, 1}, 2},
+		// Way 0 was used last, so the tree goes right; the right half
+		// last used way 4, so it goes to ways 6 and 7, of which way 7 was
+		// filled last
+		{"plru 8 ways", PLRU, 8, []uint64{4, 0}, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newCache(test.ways, test.ways, test.policy)
+			fill(c)
+			for _, tag := range test.use {
+				if !c.access(tag) {
+					t.Fatalf("tag %d missing", tag)
+				}
+			}
+			if got := evicted(t, c, 100); got != test.want {
+				t.Errorf("evicted %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEmptySlotsFirst(t *testing.T) {
+	for _, policy := range []Policy{LRU, PLRU} {
+		c := newCache(4, 4, policy)
+		for tag := uint64(0); tag < 4; tag++ {
+			c.insert(tag, false)
+			c.access(0)
+		}
+		for tag := uint64(0); tag < 4; tag++ {
+			if !c.contains(tag) {
+				t.Errorf("%s: tag %d was evicted while a way was empty", policy, tag)
+			}
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	// Tags of different sets never evict each other, also for a number of
+	// sets that is not a power of two
+	for _, sets := range []int{4, 3} {
+		c := newCache(sets*2, 2, LRU)
+		for tag := uint64(0); tag < uint64(sets*2); tag++ {
+			c.insert(tag, false)
+		}
+		for tag := uint64(0); tag < uint64(sets*2); tag++ {
+			if !c.contains(tag) {
+				t.Errorf("%d sets: tag %d was evicted", sets, tag)
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	h, err := New(Config{
+		Name:     "test",
+		LineSize: 64,
+		Caches: []CacheConfig{
+			{Size: 128, Ways: 2, LatencyNs: 1},
+			{Size: 512, Ways: 8, LatencyNs: 4},
+		},
+		TLB:      TLBConfig{Entries: 1, Ways: 1, MissNs: 10},
+		MemoryNs: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loads := []struct {
+		addr uint64
+		want float64
+	}{
+		{0, 110},    // memory and a page walk
+		{8, 1},      // same line
+		{64, 100},   // next line of the same page
+		{4096, 110}, // another page, evicts line 0 from the L1 only
+		{64, 11},    // L1 hit after a TLB miss
+		{0, 4},      // L2 hit
+		{8, 1},      // back in the L1
+	}
+	for i, load := range loads {
+		if got := h.Load(load.addr); got != load.want {
+			t.Errorf("load %d of 0x%x took %.0f ns, want %.0f ns", i, load.addr, got, load.want)
+		}
+	}
+
+	stats := h.Stats()
+	if stats.Loads != uint64(len(loads)) || stats.MemoryLoads != 3 || stats.TLBMisses != 3 {
+		t.Errorf("stats %+v, want %d loads, 3 from memory and 3 TLB misses", stats, len(loads))
+	}
+	if l1, l2 := stats.Levels[0], stats.Levels[1]; l1.Hits != 3 || l2.Hits != 1 || l2.Misses != 3 {
+		t.Errorf("L1 stats %+v, L2 stats %+v, want 3 L1 hits, 1 L2 hit and 3 L2 misses", l1, l2)
+	}
+}
+
+func TestPrefetcher(t *testing.T) {
+	h, err := New(Config{
+		Name:       "test",
+		LineSize:   64,
+		Caches:     []CacheConfig{{Size: 64 << 10, Ways: 8, LatencyNs: 1}},
+		Prefetcher: PrefetcherConfig{Streams: 1, Distance: 4, Level: 1},
+		MemoryNs:   100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two equal strides confirm a stream, which then runs ahead of the
+	// loads up to the page boundary
+	for line := uint64(0); line < 64; line++ {
+		h.Load(line * 64)
+	}
+	stats := h.Stats()
+	if stats.MemoryLoads != 3 || stats.UsefulPrefetches != 61 {
+		t.Errorf("stats %+v, want 3 loads from memory and 61 useful prefetches", stats)
+	}
+
+	// The next page starts over
+	h.Reset()
+	if ns := h.Load(4096); ns != 100 {
+		t.Errorf("first load of the next page took %.0f ns, want 100 ns", ns)
+	}
+}
+
+func TestParse(t *testing.T) {
+	skylake, _ := findPreset("skylake")
+
+	tests := []struct {
+		spec string
+		want func() Config
+		err  string
+	}{
+		{spec: "skylake", want: func() Config { return skylake }},
+		{spec: "skylake, L3=16M/16/12", want: func() Config {
+			c := skylake
+			c.Caches = append([]CacheConfig(nil), skylake.Caches...)
+			c.Caches[2] = CacheConfig{Size: 16 << 20, Ways: 16, LatencyNs: 12}
+			return c
+		}},
+		{spec: "skylake,L4=128M/16/40/lru,tlb=0,prefetch=0", want: func() Config {
+			c := skylake
+			c.Caches = append(append([]CacheConfig(nil), skylake.Caches...), CacheConfig{Size: 128 << 20, Ways: 16, Policy: LRU, LatencyNs: 40})
+			c.TLB.Entries = 0
+			c.Prefetcher = PrefetcherConfig{}
+			return c
+		}},
+		{spec: "L1=32K/8/1/PLRU,L2=1M/16/4,mem=90,line=128,page=16K,tlb=64/4/5,prefetch=8/4/2", want: func() Config {
+			return Config{
+				Name:     "custom",
+				LineSize: 128,
+				Caches: []CacheConfig{
+					{Size: 32 << 10, Ways: 8, Policy: PLRU, LatencyNs: 1},
+					{Size: 1 << 20, Ways: 16, LatencyNs: 4},
+				},
+				TLB:        TLBConfig{Entries: 64, Ways: 4, PageSize: 16 << 10, MissNs: 5},
+				Prefetcher: PrefetcherConfig{Streams: 8, Distance: 4, Level: 2},
+				MemoryNs:   90,
+			}
+		}},
+		{spec: "pentium", err: "unknown simulated CPU"},
+		{spec: "L1=32K/8/1,skylake", err: "unknown simulated CPU"},
+		{spec: "skylake,L5=1M/8/1", err: "must be L1 to L4"},
+		{spec: "skylake,L1=32K/8", err: "want 3 values"},
+		{spec: "skylake,L1=48K/6/1/plru", err: "power of two ways"},
+		{spec: "skylake,L1=32K/8/1/fifo", err: "unknown replacement policy"},
+		{spec: "skylake,L1=1000/8/1", err: "not a multiple"},
+		{spec: "skylake,mem=fast", err: "invalid number"},
+		{spec: "skylake,line=96", err: "not a power of two"},
+		{spec: "skylake,prefetch=8/4/5", err: "level 5"},
+		{spec: "skylake,color=red", err: "unknown key"},
+		{spec: "L2=1M/16/4", err: "must be L1 to L1"},
+		{spec: "mem=90", err: "no cache levels"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			got, err := Parse(test.spec)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Parse() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := test.want(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestPresetsValid(t *testing.T) {
+	for _, preset := range Presets {
+		if _, err := New(preset); err != nil {
+			t.Errorf("preset %v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package memsim
+
+// PrefetcherConfig describes a stride prefetcher. It follows the loads of
+// every page separately; once two steps between consecutive lines of a
+// page are the same, it fetches the next Distance lines at that stride.
+// Like real prefetchers it stops at the page boundary.
+type PrefetcherConfig struct {
+	Streams  int // pages tracked at once, 0 for no prefetcher
+	Distance int // lines fetched ahead of the load
+	Level    int // cache level the lines are brought into, 1 for L1
+}
+
+// stream is the state of one tracked page
+type stream struct {
+	page      uint64
+	last      uint64 // line of the latest load
+	stride    int64  // lines between the two latest loads
+	confirmed bool   // the stride was seen twice in a row
+	used      uint64 // for replacing the least recently used stream
+}
+
+// prefetcher detects strides per page
+type prefetcher struct {
+	config       PrefetcherConfig
+	linesPerPage uint64
+	streams      []stream
+	clock        uint64
+	lines        []uint64 // reused result of observe
+}
+
+// newPrefetcher creates a prefetcher without any streams yet
+func newPrefetcher(config PrefetcherConfig, linesPerPage int) *prefetcher {
+	return &prefetcher{config: config, linesPerPage: uint64(linesPerPage), streams: make([]stream, 0, config.Streams)}
+}
+
+// observe trains the prefetcher with a loaded line and returns the lines
+// to prefetch, valid until the next call
+func (p *prefetcher) observe(line uint64) []uint64 {
+	p.clock++
+	p.lines = p.lines[:0]
+	page := line / p.linesPerPage
+
+	s := p.stream(page)
+	if s == nil {
+		p.track(page, line)
+		return nil
+	}
+	s.used = p.clock
+	stride := int64(line) - int64(s.last)
+	if stride == 0 {
+		return nil
+	}
+	s.confirmed = stride == s.stride
+	s.stride, s.last = stride, line
+	if !s.confirmed {
+		return nil
+	}
+
+	next := int64(line)
+	for i := 0; i < p.config.Distance; i++ {
+		next += stride
+		if next < 0 || uint64(next)/p.linesPerPage != page {
+			break
+		}
+		p.lines = append(p.lines, uint64(next))
+	}
+	return p.lines
+}
+
+// stream returns the stream tracking a page, or nil
+func (p *prefetcher) stream(page uint64) *stream {
+	for i := range p.streams {
+		if p.streams[i].page == page {
+			return &p.streams[i]
+		}
+	}
+	return nil
+}
+
+// track starts a stream for a page, replacing the least recently used one
+// when all are taken
+func (p *prefetcher) track(page, line uint64) {
+	s := stream{page: page, last: line, used: p.clock}
+	if len(p.streams) < p.config.Streams {
+		p.streams = append(p.streams, s)
+		return
+	}
+	oldest := 0
+	for i := range p.streams {
+		if p.streams[i].used < p.streams[oldest].used {
+			oldest = i
+		}
+	}
+	p.streams[oldest] = s
+}
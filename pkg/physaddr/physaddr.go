@@ -0,0 +1,215 @@
+// Package physaddr resolves virtual addresses of this process to physical
+// page frames and, where the EDAC tree allows it, to memory modules
+package physaddr
+
+import (
+	"app/pkg/edac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PagemapPath is the kernel's virtual to physical mapping of this process
+const PagemapPath = "/proc/self/pagemap"
+
+// pagemap entry layout, see Documentation/admin-guide/mm/pagemap.rst
+const (
+	pagemapPresent = 1 << 63
+	pagemapSwapped = 1 << 62
+	pagemapPFNMask = 1<<55 - 1
+)
+
+var (
+	// ErrUnsupported is returned when no pagemap file can be read
+	ErrUnsupported = errors.New("pagemap not available on this system")
+	// ErrNoPrivilege is returned when the kernel hides page frame numbers,
+	// which it does for processes without CAP_SYS_ADMIN
+	ErrNoPrivilege = errors.New("page frame numbers hidden by the kernel, run as root (CAP_SYS_ADMIN)")
+	// ErrNotPresent is returned when the page is not resident in RAM
+	ErrNotPresent = errors.New("page not present in RAM")
+	// ErrSwapped is returned when the page has been swapped out
+	ErrSwapped = errors.New("page swapped out")
+)
+
+// Location is the physical location of a virtual address
+type Location struct {
+	Virtual  uintptr
+	PFN      uint64 // physical page frame number
+	Physical uint64 // physical address
+
+	// DIMM is the module holding the address. It is only known when the
+	// system has a single module: with several, consecutive lines are
+	// interleaved across channels, ranks and sockets in ways EDAC does not
+	// describe.
+	DIMM *edac.DIMM
+
+	// Candidates are the modules of the controller whose share of the
+	// address space holds the address, when DIMM is unknown. The controller
+	// is inferred by laying out the controllers one after another, which
+	// ignores memory holes and interleaving between controllers, so it is
+	// only exact when ExactController is set.
+	Candidates      []edac.DIMM
+	ExactController bool
+}
+
+// Resolver resolves virtual addresses using the given files, so tests can
+// point it at fixture pagemap and EDAC trees
+type Resolver struct {
+	PagemapPath string
+	EDACDir     string
+	PageSize    int
+}
+
+// NewResolver creates a resolver for the running process
+func NewResolver() *Resolver {
+	return &Resolver{
+		PagemapPath: PagemapPath,
+		EDACDir:     edac.SysfsDir,
+		PageSize:    os.Getpagesize(),
+	}
+}
+
+// Resolve returns the physical location of vaddr
+func Resolve(vaddr uintptr) (Location, error) {
+	return NewResolver().Resolve(vaddr)
+}
+
+// Resolve returns the physical location of vaddr
+func (r *Resolver) Resolve(vaddr uintptr) (Location, error) {
+	entry, err := r.readEntry(vaddr)
+	if err != nil {
+		return Location{}, err
+	}
+
+	switch {
+	case entry&pagemapSwapped != 0:
+		return Location{}, ErrSwapped
+	case entry&pagemapPresent == 0:
+		return Location{}, ErrNotPresent
+	}
+
+	pfn := entry & pagemapPFNMask
+	if pfn == 0 {
+		return Location{}, ErrNoPrivilege
+	}
+
+	location := Location{
+		Virtual:  vaddr,
+		PFN:      pfn,
+		Physical: pfn*uint64(r.PageSize) + uint64(vaddr)%uint64(r.PageSize),
+	}
+	r.findDIMM(&location)
+	return location, nil
+}
+
+// Describe returns a one-line description of where vaddr lives physically,
+// or why that cannot be determined
+func (r *Resolver) Describe(vaddr uintptr) string {
+	location, err := r.Resolve(vaddr)
+	if err != nil {
+		return fmt.Sprintf("physical address unavailable: %v", err)
+	}
+	return location.String()
+}
+
+// String formats the location for reports
+func (l Location) String() string {
+	s := fmt.Sprintf("pfn 0x%x, phys 0x%x, ", l.PFN, l.Physical)
+	if len(l.Candidates) == 0 {
+		return s + l.Module()
+	}
+	names := make([]string, len(l.Candidates))
+	for i, dimm := range l.Candidates {
+		names[i] = dimmName(dimm)
+	}
+	return s + l.Module() + ", one of " + strings.Join(names, ", ")
+}
+
+// Module names the module holding the address, or as much of it as is
+// known, for reports that group errors by module
+func (l Location) Module() string {
+	switch {
+	case l.DIMM != nil:
+		return "DIMM " + dimmName(*l.DIMM)
+	case len(l.Candidates) == 0:
+		return "DIMM unknown (no EDAC data)"
+	case l.ExactController:
+		return fmt.Sprintf("DIMM unknown (interleaved) on mc%d", l.Candidates[0].Controller)
+	}
+	return fmt.Sprintf("DIMM unknown (interleaved) probably on mc%d", l.Candidates[0].Controller)
+}
+
+// dimmName returns the motherboard label of a module, or its sysfs name
+func dimmName(dimm edac.DIMM) string {
+	if dimm.Label != "" {
+		return dimm.Label
+	}
+	return fmt.Sprintf("mc%d/%s", dimm.Controller, dimm.Name)
+}
+
+// readEntry reads the 64-bit pagemap entry for the page containing vaddr
+func (r *Resolver) readEntry(vaddr uintptr) (uint64, error) {
+	file, err := os.Open(r.PagemapPath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	defer file.Close()
+
+	var buf [8]byte
+	offset := int64(vaddr) / int64(r.PageSize) * 8
+	if _, err := file.ReadAt(buf[:], offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, ErrNotPresent
+		}
+		return 0, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return binary.NativeEndian.Uint64(buf[:]), nil
+}
+
+// findDIMM sets the module of the location when there is a single one, and
+// otherwise the modules of the controller whose range contains the address
+// when the controllers are laid out in order. Addresses above the last range,
+// moved there by memory holes, are taken to be on the last controller.
+func (r *Resolver) findDIMM(location *Location) {
+	var controllers []edac.Controller
+	dimms := 0
+	for _, controller := range edac.ReadControllers(r.EDACDir) {
+		var populated []edac.DIMM
+		for _, dimm := range controller.DIMMs {
+			if dimm.SizeMB > 0 {
+				populated = append(populated, dimm)
+			}
+		}
+		if len(populated) > 0 {
+			controller.DIMMs = populated
+			controllers = append(controllers, controller)
+			dimms += len(populated)
+		}
+	}
+	switch {
+	case dimms == 0:
+		return
+	case dimms == 1:
+		location.DIMM = &controllers[0].DIMMs[0]
+		return
+	}
+
+	found := len(controllers) - 1
+	base := uint64(0)
+	for i, controller := range controllers {
+		size := 0
+		for _, dimm := range controller.DIMMs {
+			size += dimm.SizeMB
+		}
+		base += uint64(size) * 1024 * 1024
+		if location.Physical < base {
+			found = i
+			break
+		}
+	}
+	location.Candidates = controllers[found].DIMMs
+	location.ExactController = len(controllers) == 1
+}
@@ -0,0 +1,188 @@
+package physaddr
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testPageSize = 4096
+
+// writePagemap writes a fake pagemap file holding the entry of every page
+func writePagemap(t *testing.T, entries []uint64) string {
+	t.Helper()
+	buf := make([]byte, 8*len(entries))
+	for i, entry := range entries {
+		binary.NativeEndian.PutUint64(buf[8*i:], entry)
+	}
+	path := filepath.Join(t.TempDir(), "pagemap")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeEDAC writes a fixture EDAC tree with one controller per element of
+// sizes, each holding modules of the given sizes in MB labelled
+// "mc<controller>_<module>"
+func writeEDAC(t *testing.T, sizes ...[]int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for mc, dimms := range sizes {
+		for i, size := range dimms {
+			dimmDir := filepath.Join(dir, "mc"+strconv.Itoa(mc), "dimm"+strconv.Itoa(i))
+			if err := os.MkdirAll(dimmDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{
+				"size":       strconv.Itoa(size) + "\n",
+				"dimm_label": "mc" + strconv.Itoa(mc) + "_" + strconv.Itoa(i) + "\n",
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dimmDir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	return dir
+}
+
+func TestReadEntry(t *testing.T) {
+	entries := []uint64{pagemapPresent | 0x1234, 0, pagemapPresent | pagemapPFNMask}
+	r := &Resolver{PagemapPath: writePagemap(t, entries), PageSize: testPageSize}
+
+	tests := []struct {
+		vaddr uintptr
+		want  uint64
+		err   error
+	}{
+		{0, entries[0], nil},
+		{testPageSize - 1, entries[0], nil},
+		{testPageSize + 8, entries[1], nil},
+		{2*testPageSize + 100, entries[2], nil},
+		{3 * testPageSize, 0, ErrNotPresent},
+	}
+	for _, test := range tests {
+		got, err := r.readEntry(test.vaddr)
+		if !errors.Is(err, test.err) || got != test.want {
+			t.Errorf("readEntry(0x%x) = 0x%x, %v, want 0x%x, %v", test.vaddr, got, err, test.want, test.err)
+		}
+	}
+
+	r.PagemapPath = filepath.Join(t.TempDir(), "missing")
+	if _, err := r.readEntry(0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("readEntry without pagemap = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := &Resolver{
+		PagemapPath: writePagemap(t, []uint64{
+			pagemapPresent | 0x10,
+			0,
+			pagemapPresent | pagemapSwapped | 0x20,
+			pagemapPresent,
+		}),
+		EDACDir:  t.TempDir(),
+		PageSize: testPageSize,
+	}
+
+	tests := []struct {
+		vaddr uintptr
+		phys  uint64
+		err   error
+	}{
+		{0x123, 0x10*testPageSize + 0x123, nil},
+		{testPageSize, 0, ErrNotPresent},
+		{2 * testPageSize, 0, ErrSwapped},
+		{3 * testPageSize, 0, ErrNoPrivilege},
+	}
+	for _, test := range tests {
+		location, err := r.Resolve(test.vaddr)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve(0x%x) error = %v, want %v", test.vaddr, err, test.err)
+			continue
+		}
+		if err == nil && (location.Physical != test.phys || location.PFN != 0x10 || location.Virtual != test.vaddr) {
+			t.Errorf("Resolve(0x%x) = %+v, want phys 0x%x", test.vaddr, location, test.phys)
+		}
+	}
+}
+
+func TestFindDIMM(t *testing.T) {
+	const mb = 1024 * 1024
+
+	tests := []struct {
+		name       string
+		edac       string
+		phys       uint64
+		dimm       string
+		candidates []string
+		exact      bool
+		module     string
+	}{
+		{
+			name:   "no EDAC",
+			edac:   t.TempDir(),
+			module: "DIMM unknown (no EDAC data)",
+		},
+		{
+			name:   "single module",
+			edac:   writeEDAC(t, []int{0, 1024, 0}),
+			phys:   4096 * mb,
+			dimm:   "mc0_1",
+			module: "DIMM mc0_1",
+		},
+		{
+			name:       "one controller interleaved",
+			edac:       writeEDAC(t, []int{1024, 1024}),
+			phys:       1536 * mb,
+			candidates: []string{"mc0_0", "mc0_1"},
+			exact:      true,
+			module:     "DIMM unknown (interleaved) on mc0",
+		},
+		{
+			name:       "second controller",
+			edac:       writeEDAC(t, []int{1024, 1024}, []int{512, 512}),
+			phys:       2048 * mb,
+			candidates: []string{"mc1_0", "mc1_1"},
+			module:     "DIMM unknown (interleaved) probably on mc1",
+		},
+		{
+			name:       "above the last range",
+			edac:       writeEDAC(t, []int{1024, 1024}, []int{512, 512}),
+			phys:       8192 * mb,
+			candidates: []string{"mc1_0", "mc1_1"},
+			module:     "DIMM unknown (interleaved) probably on mc1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Resolver{EDACDir: test.edac, PageSize: testPageSize}
+			location := Location{Physical: test.phys}
+			r.findDIMM(&location)
+
+			dimm := ""
+			if location.DIMM != nil {
+				dimm = location.DIMM.Label
+			}
+			var candidates []string
+			for _, candidate := range location.Candidates {
+				candidates = append(candidates, candidate.Label)
+			}
+			if dimm != test.dimm || strings.Join(candidates, ",") != strings.Join(test.candidates, ",") ||
+				location.ExactController != test.exact {
+				t.Errorf("DIMM %q, candidates %v, exact controller %v, want %q, %v, %v",
+					dimm, candidates, location.ExactController, test.dimm, test.candidates, test.exact)
+			}
+			if module := location.Module(); module != test.module {
+				t.Errorf("Module() = %q, want %q", module, test.module)
+			}
+		})
+	}
+}
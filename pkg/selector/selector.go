@@ -0,0 +1,120 @@
+// Package selector selects tests by hierarchical name with -run and -skip
+// patterns that work like those of go test
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter holds the compiled -run and -skip patterns. A nil Filter selects
+// every test.
+type Filter struct {
+	run  []*regexp.Regexp // one pattern per name level, nil to run everything
+	skip []*regexp.Regexp // one pattern per name level, nil to skip nothing
+}
+
+// New compiles the -run and -skip patterns. Like go test, each pattern is
+// split on slashes into one regular expression per name level, so
+// "cache/L2" selects every test below cache whose second level matches L2.
+func New(run, skip string) (*Filter, error) {
+	runLevels, err := compileLevels(run)
+	if err != nil {
+		return nil, fmt.Errorf("-run: %w", err)
+	}
+	skipLevels, err := compileLevels(skip)
+	if err != nil {
+		return nil, fmt.Errorf("-skip: %w", err)
+	}
+	return &Filter{run: runLevels, skip: skipLevels}, nil
+}
+
+// Match reports whether the test with the given name is selected. It also
+// works for a group name such as "cache/L2", in which case it reports
+// whether tests below the group may be selected.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	levels := strings.Split(name, "/")
+	if !matchLevels(f.run, levels) {
+		return false
+	}
+	// A test is skipped only when the skip pattern reaches down to its
+	// level, so "-skip cache/L1" leaves the rest of cache alone
+	return f.skip == nil || len(f.skip) > len(levels) || !matchLevels(f.skip, levels)
+}
+
+// matchLevels reports whether every pattern level that the name reaches
+// matches the corresponding name level
+func matchLevels(patterns []*regexp.Regexp, levels []string) bool {
+	for i := 0; i < len(patterns) && i < len(levels); i++ {
+		if !patterns[i].MatchString(levels[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileLevels splits a pattern on slashes outside of brackets and
+// escapes and compiles each level
+func compileLevels(pattern string) ([]*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	var levels []string
+	depth, start := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				levels = append(levels, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	levels = append(levels, pattern[start:])
+
+	compiled := make([]*regexp.Regexp, len(levels))
+	for i, level := range levels {
+		re, err := regexp.Compile(level)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// SizeName formats a byte count for use in test names, e.g. "4KiB" or
+// "256MiB", using the largest unit that divides it evenly
+func SizeName(bytes int) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for i < len(units)-1 && bytes >= 1024 && bytes%1024 == 0 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", bytes, units[i])
+}
+
+// Select returns the names that the filter selects, in order
+func (f *Filter) Select(names []string) []string {
+	var selected []string
+	for _, name := range names {
+		if f.Match(name) {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,270 @@
+// Package skew draws node indices with the skewed popularity of real
+// workloads instead of uniformly: Zipfian keys as caches and key-value
+// stores see them, a hot set that takes most accesses, and a Gaussian
+// neighborhood around a cursor that moves through memory. Hot nodes of
+// the Zipf and hot/cold distributions are scattered over the buffer, so
+// only their popularity helps the caches, not their placement.
+package skew
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is an access distribution
+type Kind string
+
+const (
+	Uniform  Kind = "uniform"
+	Zipf     Kind = "zipf"     // popularity of rank k falls as 1/k^S
+	HotCold  Kind = "hotcold"  // HotProbability of accesses go to HotFraction of the nodes
+	Gaussian Kind = "gaussian" // normal around a cursor that moves Step nodes per access
+)
+
+// Spec selects a distribution and its parameters
+type Spec struct {
+	Kind           Kind
+	S              float64 // Zipf exponent, 0 is uniform, around 1 is typical
+	HotFraction    float64 // share of the nodes in the hot set, 0 to 1
+	HotProbability float64 // share of the accesses that go to the hot set, 0 to 1
+	Sigma          float64 // Gaussian standard deviation in nodes
+	Step           float64 // nodes the Gaussian cursor moves per access
+}
+
+// Default is the distribution of skewed workloads that are given none
+var Default = Spec{Kind: Zipf, S: 0.99}
+
+// Sweep is the set of distributions the skew analysis compares by default,
+// from uniform to strongly skewed
+var Sweep = []Spec{
+	{Kind: Uniform},
+	{Kind: Zipf, S: 0.6},
+	{Kind: Zipf, S: 0.9},
+	{Kind: Zipf, S: 0.99},
+	{Kind: Zipf, S: 1.2},
+	{Kind: HotCold, HotFraction: 0.1, HotProbability: 0.9},
+	{Kind: HotCold, HotFraction: 0.01, HotProbability: 0.99},
+	{Kind: Gaussian, Sigma: 1024, Step: 1},
+}
+
+// Parse reads a spec written like String: "uniform", "zipf:S",
+// "hotcold:FRACTION:PROBABILITY" or "gaussian:SIGMA:STEP"
+func Parse(s string) (Spec, error) {
+	fields := strings.Split(strings.TrimSpace(s), ":")
+	values := make([]float64, len(fields)-1)
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return Spec{}, fmt.Errorf("%s: invalid number %q", s, field)
+		}
+		values[i] = v
+	}
+
+	spec := Spec{Kind: Kind(strings.ToLower(fields[0]))}
+	want := 0
+	switch spec.Kind {
+	case Uniform:
+	case Zipf:
+		want = 1
+		if len(values) == want {
+			spec.S = values[0]
+		}
+	case HotCold:
+		want = 2
+		if len(values) == want {
+			spec.HotFraction, spec.HotProbability = values[0], values[1]
+		}
+	case Gaussian:
+		want = 2
+		if len(values) == want {
+			spec.Sigma, spec.Step = values[0], values[1]
+		}
+	default:
+		return Spec{}, fmt.Errorf("unknown distribution %q, want uniform, zipf, hotcold or gaussian", fields[0])
+	}
+	if len(values) != want {
+		return Spec{}, fmt.Errorf("%s: %s takes %d parameters", s, spec.Kind, want)
+	}
+	return spec, spec.Validate()
+}
+
+// ParseList reads comma separated specs
+func ParseList(s string) ([]Spec, error) {
+	var specs []Spec
+	for _, item := range strings.Split(s, ",") {
+		spec, err := Parse(item)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Validate checks the parameters of the distribution
+func (s Spec) Validate() error {
+	switch {
+	case s.Kind == Zipf && s.S < 0:
+		return fmt.Errorf("zipf exponent %g is negative", s.S)
+	case s.Kind == HotCold && (s.HotFraction <= 0 || s.HotFraction > 1 || s.HotProbability < 0 || s.HotProbability > 1):
+		return fmt.Errorf("hot fraction %g and probability %g must be within 0 to 1", s.HotFraction, s.HotProbability)
+	case s.Kind == Gaussian && s.Sigma <= 0:
+		return fmt.Errorf("gaussian sigma %g must be positive", s.Sigma)
+	}
+	return nil
+}
+
+// String formats the spec the way Parse reads it
+func (s Spec) String() string {
+	switch s.Kind {
+	case Zipf:
+		return fmt.Sprintf("zipf:%g", s.S)
+	case HotCold:
+		return fmt.Sprintf("hotcold:%g:%g", s.HotFraction, s.HotProbability)
+	case Gaussian:
+		return fmt.Sprintf("gaussian:%g:%g", s.Sigma, s.Step)
+	}
+	return string(Uniform)
+}
+
+// Generator draws node indices in [0, n)
+type Generator interface {
+	Next() int
+}
+
+// New creates a generator of the distribution over n nodes. The Zipf
+// generator keeps a table of 12 bytes per node.
+func New(spec Spec, n int) (Generator, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("no nodes to draw from")
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	switch spec.Kind {
+	case Zipf:
+		return newZipf(n, spec.S), nil
+	case HotCold:
+		return newHotCold(n, spec.HotFraction, spec.HotProbability), nil
+	case Gaussian:
+		return &gaussian{n: n, sigma: spec.Sigma, step: spec.Step}, nil
+	}
+	return uniform(n), nil
+}
+
+// Fill draws len(indices) nodes into indices
+func Fill(g Generator, indices []int32) {
+	for i := range indices {
+		indices[i] = int32(g.Next())
+	}
+}
+
+// uniform draws every node with the same probability
+type uniform int
+
+// Next draws a node
+func (u uniform) Next() int {
+	return rand.Intn(int(u))
+}
+
+// zipf draws ranks by inverting their cumulative distribution and maps
+// them to nodes through a random permutation
+type zipf struct {
+	cdf   []float64 // cdf[k] is the probability of a rank up to k
+	nodes []int32   // node of every rank
+}
+
+// newZipf tabulates the distribution of n ranks with exponent s
+func newZipf(n int, s float64) *zipf {
+	z := &zipf{cdf: make([]float64, n), nodes: permutation(n)}
+	total := 0.0
+	for k := range z.cdf {
+		total += math.Pow(float64(k+1), -s)
+		z.cdf[k] = total
+	}
+	for k := range z.cdf {
+		z.cdf[k] /= total
+	}
+	return z
+}
+
+// Next draws a node
+func (z *zipf) Next() int {
+	rank := sort.SearchFloat64s(z.cdf, rand.Float64())
+	return int(z.nodes[min(rank, len(z.nodes)-1)])
+}
+
+// hotCold draws from a random hot set with a fixed probability and from
+// the remaining cold nodes otherwise
+type hotCold struct {
+	nodes       []int32 // hot nodes first, then cold ones
+	hot         int
+	probability float64
+}
+
+// newHotCold picks the hot set of a share of n nodes
+func newHotCold(n int, fraction, probability float64) *hotCold {
+	hot := min(n, max(1, int(math.Round(fraction*float64(n)))))
+	return &hotCold{nodes: permutation(n), hot: hot, probability: probability}
+}
+
+// Next draws a node
+func (h *hotCold) Next() int {
+	if h.hot == len(h.nodes) || rand.Float64() < h.probability {
+		return int(h.nodes[rand.Intn(h.hot)])
+	}
+	return int(h.nodes[h.hot+rand.Intn(len(h.nodes)-h.hot)])
+}
+
+// gaussian draws nodes normally distributed around a cursor, which moves
+// on after every draw and wraps around at the end of the buffer
+type gaussian struct {
+	n           int
+	sigma, step float64
+	cursor      float64
+}
+
+// Next draws a node
+func (g *gaussian) Next() int {
+	node := int(math.Round(g.cursor + rand.NormFloat64()*g.sigma))
+	g.cursor = math.Mod(g.cursor+g.step, float64(g.n))
+	return ((node % g.n) + g.n) % g.n
+}
+
+// permutation returns the nodes in random order
+func permutation(n int) []int32 {
+	nodes := make([]int32, n)
+	for i, node := range rand.Perm(n) {
+		nodes[i] = int32(node)
+	}
+	return nodes
+}
+
+// TopShare returns, for every count in top, the share of the draws that
+// fall on that many of the most frequently drawn nodes. With top as the
+// lines of a cache it is the hit rate of an ideal cache that always holds
+// the hottest lines.
+func TopShare(indices []int32, n int, top []int) []float64 {
+	counts := make([]int32, n)
+	for _, i := range indices {
+		counts[i]++
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i] > counts[j] })
+
+	shares := make([]float64, len(top))
+	if len(indices) == 0 {
+		return shares
+	}
+	for i, k := range top {
+		sum := 0
+		for _, c := range counts[:min(max(k, 0), n)] {
+			sum += int(c)
+		}
+		shares[i] = float64(sum) / float64(len(indices))
+	}
+	return shares
+}
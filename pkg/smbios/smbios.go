@@ -0,0 +1,276 @@
+// Package smbios parses the SMBIOS Memory Device (type 17) entries that
+// describe the installed memory modules
+package smbios
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TablePath is where Linux exposes the raw SMBIOS structure table
+const TablePath = "/sys/firmware/dmi/tables/DMI"
+
+// SMBIOS structure types used by the parser
+const (
+	typeMemoryDevice = 17
+	typeEndOfTable   = 127
+)
+
+// memoryTypes maps the Memory Type field to a name (SMBIOS 3.x, 7.18.2)
+var memoryTypes = map[byte]string{
+	0x12: "DDR", 0x13: "DDR2", 0x18: "DDR3", 0x1A: "DDR4",
+	0x1B: "LPDDR", 0x1C: "LPDDR2", 0x1D: "LPDDR3", 0x1E: "LPDDR4",
+	0x20: "HBM", 0x21: "HBM2", 0x22: "DDR5", 0x23: "LPDDR5", 0x24: "HBM3",
+}
+
+// MemoryDevice is one memory slot as described by a type 17 structure
+type MemoryDevice struct {
+	Locator         string // slot name, e.g. "DIMM_A1"
+	BankLocator     string // bank or channel name, e.g. "P0 CHANNEL A"
+	SizeMB          int64  // 0 when the slot is empty
+	Type            string // e.g. "DDR4" or "DDR5"
+	DataWidth       int    // bits, excluding ECC
+	Speed           int    // maximum speed in MT/s
+	ConfiguredSpeed int    // configured speed in MT/s
+	Rank            int    // 0 when unknown
+	Manufacturer    string
+	PartNumber      string
+	SerialNumber    string
+}
+
+// Populated reports whether a module is installed in the slot
+func (d MemoryDevice) Populated() bool {
+	return d.SizeMB > 0
+}
+
+// ReadMemoryDevices reads and parses the SMBIOS table at path
+func ReadMemoryDevices(path string) ([]MemoryDevice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTable(data)
+}
+
+// ParseTable parses a raw SMBIOS structure table and returns its memory
+// devices, populated or not, in table order
+func ParseTable(data []byte) ([]MemoryDevice, error) {
+	var devices []MemoryDevice
+	for len(data) >= 4 {
+		kind, length := data[0], int(data[1])
+		if length < 4 || length > len(data) {
+			return devices, fmt.Errorf("smbios: truncated structure of type %d", kind)
+		}
+
+		// The formatted area is followed by a set of strings that ends
+		// with an empty string
+		end := length
+		for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+			end++
+		}
+		if end+1 >= len(data) {
+			return devices, errors.New("smbios: unterminated string set")
+		}
+		strs := strings.Split(string(data[length:end]), "\x00")
+
+		if kind == typeMemoryDevice {
+			devices = append(devices, parseMemoryDevice(data[:length], strs))
+		}
+		if kind == typeEndOfTable {
+			break
+		}
+		data = data[end+2:]
+	}
+	return devices, nil
+}
+
+// parseMemoryDevice decodes the formatted area of a type 17 structure
+func parseMemoryDevice(f []byte, strs []string) MemoryDevice {
+	word := func(offset int) int {
+		if offset+2 > len(f) {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint16(f[offset:]))
+	}
+	dword := func(offset int) int {
+		if offset+4 > len(f) {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint32(f[offset:]))
+	}
+	byteAt := func(offset int) byte {
+		if offset >= len(f) {
+			return 0
+		}
+		return f[offset]
+	}
+	str := func(offset int) string {
+		index := int(byteAt(offset))
+		if index == 0 || index > len(strs) {
+			return ""
+		}
+		return strings.TrimSpace(strs[index-1])
+	}
+
+	device := MemoryDevice{
+		Locator:      str(0x10),
+		BankLocator:  str(0x11),
+		DataWidth:    word(0x0A),
+		Speed:        word(0x15),
+		Manufacturer: str(0x17),
+		SerialNumber: str(0x18),
+		PartNumber:   str(0x1A),
+		Rank:         int(byteAt(0x1B) & 0x0f),
+	}
+	if device.DataWidth == 0xFFFF {
+		device.DataWidth = 0
+	}
+
+	// Size is in MB unless bit 15 is set (KB); 0x7FFF means the real size
+	// is in the Extended Size field, 0xFFFF means unknown
+	switch size := word(0x0C); {
+	case size == 0x7FFF:
+		device.SizeMB = int64(dword(0x1C) & 0x7FFFFFFF)
+	case size == 0xFFFF:
+		device.SizeMB = 0
+	case size&0x8000 != 0:
+		device.SizeMB = int64(size&0x7FFF) / 1024
+	default:
+		device.SizeMB = int64(size)
+	}
+
+	device.Type = memoryTypes[byteAt(0x12)]
+	if device.Type == "" {
+		device.Type = fmt.Sprintf("type 0x%02x", byteAt(0x12))
+	}
+
+	// Speeds of 0xFFFF are stored in the extended fields (SMBIOS 3.3)
+	if device.Speed == 0xFFFF {
+		device.Speed = dword(0x54)
+	}
+	device.ConfiguredSpeed = word(0x20)
+	if device.ConfiguredSpeed == 0xFFFF {
+		device.ConfiguredSpeed = dword(0x58)
+	}
+	return device
+}
+
+// channelPattern finds channel names such as "CHANNEL A", "Channel0" or "CH_B"
+var channelPattern = regexp.MustCompile(`(?i)\b(?:channel|chan|ch)[\s_-]*([a-z0-9]+)`)
+
+// slotPattern finds channel letters in slot names such as "DIMM_A1" or "A2"
+var slotPattern = regexp.MustCompile(`(?i)(?:^|[\s_-])(?:dimm[\s_-]*)?([a-z])[0-9]+$`)
+
+// socketPattern finds the socket or node of a slot, e.g. "P0", "CPU1" or "Node0"
+var socketPattern = regexp.MustCompile(`(?i)\b(?:cpu|p|node|socket)[\s_-]*([0-9]+)`)
+
+// Channels estimates the number of populated memory channels from the slot
+// and bank names. When the names do not identify channels, every populated
+// module is assumed to sit on its own channel.
+func Channels(devices []MemoryDevice) int {
+	channels := make(map[string]bool)
+	populated := 0
+	unknown := false
+	for _, d := range devices {
+		if !d.Populated() {
+			continue
+		}
+		populated++
+
+		names := d.BankLocator + " " + d.Locator
+		channel := ""
+		if m := channelPattern.FindStringSubmatch(names); m != nil {
+			channel = m[1]
+		} else if m := slotPattern.FindStringSubmatch(d.Locator); m != nil {
+			channel = m[1]
+		}
+		if channel == "" {
+			unknown = true
+			continue
+		}
+
+		socket := ""
+		if m := socketPattern.FindStringSubmatch(names); m != nil {
+			socket = m[1]
+		}
+		channels[strings.ToUpper(socket+"/"+channel)] = true
+	}
+
+	if unknown {
+		return populated
+	}
+	return len(channels)
+}
+
+// PeakBandwidthGBs returns the theoretical peak bandwidth in GB/s:
+// channels × MT/s × 8 bytes per transfer, using the slowest configured speed
+func PeakBandwidthGBs(devices []MemoryDevice) float64 {
+	speed := 0
+	for _, d := range devices {
+		if !d.Populated() {
+			continue
+		}
+		s := d.ConfiguredSpeed
+		if s == 0 {
+			s = d.Speed
+		}
+		if s > 0 && (speed == 0 || s < speed) {
+			speed = s
+		}
+	}
+	return float64(Channels(devices)) * float64(speed) * 1e6 * 8 / 1e9
+}
+
+// systemPeak reads the system's table once for SystemPeakBandwidthGBs
+var systemPeak = sync.OnceValue(func() float64 {
+	devices, err := ReadMemoryDevices(TablePath)
+	if err != nil {
+		return 0
+	}
+	return PeakBandwidthGBs(devices)
+})
+
+// SystemPeakBandwidthGBs returns the theoretical peak bandwidth of this
+// system, or 0 when the SMBIOS table cannot be read
+func SystemPeakBandwidthGBs() float64 {
+	return systemPeak()
+}
+
+// PrintInventory prints the memory module inventory and the theoretical peak
+// bandwidth, or why the inventory is unavailable
+func PrintInventory() {
+	devices, err := ReadMemoryDevices(TablePath)
+	if err != nil {
+		fmt.Printf("DIMM inventory: unavailable (%v)\n", err)
+		return
+	}
+
+	populated := 0
+	for _, d := range devices {
+		if d.Populated() {
+			populated++
+		}
+	}
+	fmt.Printf("DIMM slots: %d populated of %d\n", populated, len(devices))
+
+	for _, d := range devices {
+		if !d.Populated() {
+			continue
+		}
+		rank := "?"
+		if d.Rank > 0 {
+			rank = fmt.Sprintf("%d", d.Rank)
+		}
+		fmt.Printf("  %-16s %6d MB %-6s %5d MT/s rank %s  %s %s\n",
+			d.Locator, d.SizeMB, d.Type, d.ConfiguredSpeed, rank, d.Manufacturer, d.PartNumber)
+	}
+
+	if peak := PeakBandwidthGBs(devices); peak > 0 {
+		fmt.Printf("Theoretical peak bandwidth: %.1f GB/s (%d channels)\n", peak, Channels(devices))
+	}
+}
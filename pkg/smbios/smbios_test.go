@@ -0,0 +1,187 @@
+package smbios
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// raw decodes a fixture table written as hex fields, one per part
+func raw(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(strings.Join(parts, ""), " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Raw type 17 structures as firmware stores them, little endian
+var (
+	// DDR4 RDIMM, SMBIOS 3.2 layout of 0x28 bytes
+	ddr4 = []string{
+		"11 28 3000",         // 0x00 type 17, length, handle
+		"0010 feff",          // 0x04 array handle, no error information
+		"4800 4000",          // 0x08 total width 72, data width 64
+		"0040",               // 0x0C size 16384 MB
+		"09 00",              // 0x0E form factor DIMM, no set
+		"01 02 1a",           // 0x10 locator, bank locator, DDR4
+		"8000",               // 0x13 type detail
+		"800c",               // 0x15 speed 3200 MT/s
+		"03 04 05 06",        // 0x17 manufacturer, serial, asset tag, part number
+		"02",                 // 0x1B two ranks
+		"00000000",           // 0x1C extended size unused
+		"750b",               // 0x20 configured speed 2933 MT/s
+		"b004 b004 b004",     // 0x22 voltages
+		hexString("DIMM_A1"), // strings
+		hexString("P0 CHANNEL A"),
+		hexString("Samsung"),
+		hexString("12345678"),
+		hexString("Asset"),
+		hexString("M393A2K43DB3-CWE  "),
+		"00",
+	}
+
+	// DDR5 RDIMM, SMBIOS 3.3 layout of 0x5C bytes, with its size and both
+	// speeds only in the extended fields
+	ddr5 = []string{
+		"11 5c 3100",
+		"0010 feff",
+		"5000 4000",
+		"ff7f", // 0x0C size in the extended size field
+		"09 00",
+		"01 02 22", // DDR5
+		"8000",
+		"ffff",        // 0x15 speed in the extended speed field
+		"03 04 00 05", // no asset tag
+		"02",
+		"00000100", // 0x1C extended size 65536 MB
+		"ffff",     // 0x20 configured speed in its extended field
+		"4c04 4c04 4c04",
+		strings.Repeat("00", 0x54-0x28), // 0x28 technology to logical size
+		"401f0000",                      // 0x54 extended speed 8000 MT/s
+		"201c0000",                      // 0x58 extended configured speed 7200 MT/s
+		hexString("DIMM_B1"),
+		hexString("P0 CHANNEL B"),
+		hexString("SK Hynix"),
+		hexString("87654321"),
+		hexString("HMCG94AGBRA181N"),
+		"00",
+	}
+
+	// Empty slot, with an unknown data width
+	empty = []string{
+		"11 28 3200",
+		"0010 feff",
+		"ffff ffff",
+		"0000",
+		"02 00",
+		"01 02 02",
+		"0000",
+		"0000",
+		"00 00 00 00",
+		"00",
+		"00000000",
+		"0000",
+		"0000 0000 0000",
+		hexString("DIMM_B2"),
+		hexString("NO DIMM"),
+		"00",
+	}
+
+	// SODIMM in the SMBIOS 2.3 layout of 0x1B bytes, sized in KB
+	sodimm = []string{
+		"11 1b 3300",
+		"0010 feff",
+		"4000 4000",
+		"0088", // 0x0C 2048 KB
+		"0d 00",
+		"01 02 18", // DDR3
+		"8000",
+		"3505", // 1333 MT/s
+		"00 00 00 00",
+		hexString("SODIMM0"),
+		hexString("BANK 0"),
+		"00",
+	}
+
+	// BIOS information, skipped by the parser
+	bios = []string{"00 04 0000", hexString("Vendor"), "00"}
+
+	endOfTable = []string{"7f 04 ffff", "0000"}
+)
+
+// hexString encodes a string of the string set with its terminating zero
+func hexString(s string) string {
+	return hex.EncodeToString([]byte(s)) + "00"
+}
+
+// table joins structures into one raw table
+func table(structures ...[]string) []string {
+	var parts []string
+	for _, structure := range structures {
+		parts = append(parts, structure...)
+	}
+	return parts
+}
+
+func TestParseTable(t *testing.T) {
+	data := raw(t, table(bios, ddr4, ddr5, empty, sodimm, endOfTable, ddr4)...)
+	devices, err := ParseTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []MemoryDevice{
+		{
+			Locator: "DIMM_A1", BankLocator: "P0 CHANNEL A", SizeMB: 16384, Type: "DDR4",
+			DataWidth: 64, Speed: 3200, ConfiguredSpeed: 2933, Rank: 2,
+			Manufacturer: "Samsung", PartNumber: "M393A2K43DB3-CWE", SerialNumber: "12345678",
+		},
+		{
+			Locator: "DIMM_B1", BankLocator: "P0 CHANNEL B", SizeMB: 65536, Type: "DDR5",
+			DataWidth: 64, Speed: 8000, ConfiguredSpeed: 7200, Rank: 2,
+			Manufacturer: "SK Hynix", PartNumber: "HMCG94AGBRA181N", SerialNumber: "87654321",
+		},
+		{Locator: "DIMM_B2", BankLocator: "NO DIMM", Type: "type 0x02"},
+		{Locator: "SODIMM0", BankLocator: "BANK 0", SizeMB: 2, Type: "DDR3", DataWidth: 64, Speed: 1333},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("ParseTable() =\n%+v\nwant\n%+v", devices, want)
+	}
+}
+
+func TestParseTableErrors(t *testing.T) {
+	full := raw(t, table(ddr4, endOfTable)...)
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"truncated formatted area", full[:0x20], "truncated structure"},
+		{"truncated string set", full[:0x30], "unterminated string set"},
+		{"length below the header", raw(t, "11 02 0000 0000"), "truncated structure"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseTable(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseTable() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestChannels(t *testing.T) {
+	devices, err := ParseTable(raw(t, table(ddr4, ddr5, empty, endOfTable)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channels := Channels(devices); channels != 2 {
+		t.Errorf("Channels() = %d, want 2", channels)
+	}
+	// Two channels at the slower configured speed of 2933 MT/s
+	if peak := PeakBandwidthGBs(devices); peak < 46.9 || peak > 47 {
+		t.Errorf("PeakBandwidthGBs() = %.2f, want 46.93", peak)
+	}
+}
@@ -0,0 +1,39 @@
+package sysmem
+
+import "fmt"
+
+// Budget is how much memory the tests can allocate before the kernel or
+// the cgroup's OOM killer steps in
+type Budget struct {
+	Meminfo Meminfo
+	Cgroup  *CgroupLimit // nil when no cgroup limit applies
+}
+
+// ReadBudget reads MemAvailable and the process's cgroup memory limit
+func ReadBudget() (Budget, error) {
+	info, err := ReadMeminfo(ProcMeminfo)
+	if err != nil {
+		return Budget{}, err
+	}
+	// A missing or unreadable cgroup tree just means there is no limit to apply
+	cgroup, _ := ReadCgroupLimit(ProcSelfCgroup, CgroupRoot)
+	return Budget{Meminfo: info, Cgroup: cgroup}, nil
+}
+
+// Available returns the smaller of MemAvailable and the room left in the cgroup
+func (b Budget) Available() int64 {
+	if b.Cgroup != nil && b.Cgroup.Remaining() < b.Meminfo.Available {
+		return b.Cgroup.Remaining()
+	}
+	return b.Meminfo.Available
+}
+
+// String describes where the available memory figure comes from
+func (b Budget) String() string {
+	s := fmt.Sprintf("MemAvailable %d MB", b.Meminfo.Available>>20)
+	if b.Cgroup != nil {
+		s += fmt.Sprintf(", cgroup v%d limit %d MB with %d MB used (%s)",
+			b.Cgroup.Version, b.Cgroup.Limit>>20, b.Cgroup.Usage>>20, b.Cgroup.Path)
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package sysmem
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Standard locations of the process's cgroup membership and the cgroup mounts
+const (
+	ProcSelfCgroup = "/proc/self/cgroup"
+	CgroupRoot     = "/sys/fs/cgroup"
+)
+
+// cgroupUnlimited is the smallest cgroup v1 limit treated as "no limit";
+// the kernel reports an unset limit as a page-rounded int64 maximum
+const cgroupUnlimited = 1 << 60
+
+// CgroupLimit is the tightest memory limit of the process's cgroup or one
+// of its ancestors, with that cgroup's current usage
+type CgroupLimit struct {
+	Version int    // 1 or 2
+	Path    string // cgroup directory that sets the limit
+	Limit   int64  // memory.max or memory.limit_in_bytes
+	Usage   int64  // memory.current or memory.usage_in_bytes
+}
+
+// Remaining returns how many more bytes the cgroup can charge before the
+// OOM killer steps in
+func (c CgroupLimit) Remaining() int64 {
+	return max(0, c.Limit-c.Usage)
+}
+
+// ReadCgroupLimit finds the memory limit of the cgroup listed in
+// procCgroup, looking for the v1 memory controller first and the v2
+// unified hierarchy second, below root. It returns nil when no cgroup on
+// the way up to root sets a limit.
+func ReadCgroupLimit(procCgroup, root string) (*CgroupLimit, error) {
+	file, err := os.Open(procCgroup)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Lines look like "4:memory:/kubepods/pod1234" (v1) or "0::/user.slice" (v2)
+	var v1Path, v2Path string
+	hasV1, hasV2 := false, false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			v2Path, hasV2 = fields[2], true
+		case hasController(fields[1], "memory"):
+			v1Path, hasV1 = fields[2], true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if hasV1 {
+		if limit := walkCgroup(filepath.Join(root, "memory"), v1Path, 1,
+			"memory.limit_in_bytes", "memory.usage_in_bytes"); limit != nil {
+			return limit, nil
+		}
+	}
+	if hasV2 {
+		// Hybrid systems mount the unified hierarchy below root/unified
+		for _, mount := range []string{root, filepath.Join(root, "unified")} {
+			if limit := walkCgroup(mount, v2Path, 2, "memory.max", "memory.current"); limit != nil {
+				return limit, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// walkCgroup reads limitFile and usageFile in the cgroup at mount/cgroupPath
+// and each of its ancestors and returns the one with the least room left.
+// Inside a cgroup namespace the listed path may not exist below mount, in
+// which case mount itself is the process's cgroup.
+func walkCgroup(mount, cgroupPath string, version int, limitFile, usageFile string) *CgroupLimit {
+	cgroupPath = path.Clean("/" + cgroupPath)
+	if _, err := os.Stat(filepath.Join(mount, cgroupPath)); err != nil {
+		cgroupPath = "/"
+	}
+
+	var tightest *CgroupLimit
+	for dir := cgroupPath; ; dir = path.Dir(dir) {
+		full := filepath.Join(mount, dir)
+		limit, ok := readCgroupValue(filepath.Join(full, limitFile))
+		if ok && limit < cgroupUnlimited {
+			usage, _ := readCgroupValue(filepath.Join(full, usageFile))
+			candidate := &CgroupLimit{Version: version, Path: full, Limit: limit, Usage: usage}
+			if tightest == nil || candidate.Remaining() < tightest.Remaining() {
+				tightest = candidate
+			}
+		}
+		if dir == "/" {
+			break
+		}
+	}
+	return tightest
+}
+
+// readCgroupValue reads a cgroup file holding a byte count or "max"
+func readCgroupValue(file string) (int64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "max" {
+		return cgroupUnlimited, true
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// hasController reports whether a comma-separated controller list from
+// /proc/self/cgroup contains name
+func hasController(list, name string) bool {
+	for _, controller := range strings.Split(list, ",") {
+		if controller == name {
+			return true
+		}
+	}
+	return false
+}
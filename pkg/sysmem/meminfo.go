@@ -0,0 +1,64 @@
+// Package sysmem reads how much memory the system can give to the tests
+package sysmem
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcMeminfo is the standard location of the kernel's memory statistics
+const ProcMeminfo = "/proc/meminfo"
+
+// Meminfo holds the fields of /proc/meminfo used by the tests, in bytes
+type Meminfo struct {
+	Total     int64
+	Free      int64
+	Available int64
+}
+
+// ReadMeminfo parses a /proc/meminfo style file
+func ReadMeminfo(path string) (Meminfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Meminfo{}, err
+	}
+	defer file.Close()
+
+	var info Meminfo
+	found := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines look like "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			value *= 1024
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			info.Total = value
+		case "MemFree:":
+			info.Free = value
+		case "MemAvailable:":
+			info.Available = value
+			found = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Meminfo{}, err
+	}
+	if !found {
+		return Meminfo{}, fmt.Errorf("%s: no MemAvailable field", path)
+	}
+	return info, nil
+}
@@ -0,0 +1,47 @@
+package sysmem
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Actions of the memory planners when the selected tests do not fit
+const (
+	LowMemoryRefuse = "refuse" // stop before allocating anything
+	LowMemoryScale  = "scale"  // shrink or drop tests until they fit
+	LowMemoryWarn   = "warn"   // run anyway
+)
+
+// Reserve is the memory left for the Go runtime and the rest of the
+// process when planning the tests
+const Reserve = 64 * 1024 * 1024
+
+// ValidateLowMemory returns an error unless action is one of the
+// LowMemory actions
+func ValidateLowMemory(action string) error {
+	switch action {
+	case LowMemoryRefuse, LowMemoryScale, LowMemoryWarn:
+		return nil
+	}
+	return fmt.Errorf("unknown -on-low-memory action %q (want %s, %s or %s)",
+		action, LowMemoryRefuse, LowMemoryScale, LowMemoryWarn)
+}
+
+// LimitHeap lowers the Go runtime's soft memory limit to what the process
+// uses now plus the available memory, and returns the new limit or 0 when
+// it was left alone. The buffers of one test are garbage once it ends,
+// but with the default GOGC the heap grows to twice its live size before
+// they are collected, so the next test's buffers would come on top of
+// them; the limit makes the runtime collect them first. A lower limit set
+// with GOMEMLIMIT is kept.
+func LimitHeap(available int64) int64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	limit := int64(stats.Sys-stats.HeapReleased) + max(0, available)
+	if limit >= debug.SetMemoryLimit(-1) {
+		return 0
+	}
+	debug.SetMemoryLimit(limit)
+	return limit
+}
@@ -0,0 +1,89 @@
+package test1
+
+import (
+	"app/pkg/selector"
+	"app/pkg/workload"
+	"fmt"
+)
+
+// Names of the tests and test groups, see TestNames
+const (
+	sequentialTestName = "access/sequential-vs-random"
+	pageFaultGroup     = "faults"
+)
+
+// TestNames returns the names of the tests RunAll would run, in order.
+// Names are hierarchical, e.g. "latency/block/64KiB" or "threads/4", and
+// are what the -run and -skip patterns match.
+func (m *MemTester) TestNames() []string {
+	var names []string
+	if m.selected(m.latencyTestName()) {
+		names = append(names, m.latencyTestName())
+	}
+	if m.Config.TestDetailedSizes {
+		for _, size := range m.detailedSizes() {
+			names = append(names, blockTestName(size))
+		}
+	}
+	if m.Config.TestStructures {
+		for _, size := range m.structureSizes() {
+			for _, structure := range workload.LookupStructures {
+				if name := structureTestName(structure, size/8); m.selected(name) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	if m.Config.TestSequential && m.selected(sequentialTestName) {
+		names = append(names, sequentialTestName)
+	}
+	if m.Config.TestThreaded {
+		for _, t := range m.threadCounts() {
+			names = append(names, threadTestName(t))
+		}
+	}
+	if m.Config.TestPageFaults {
+		for _, kind := range pageKinds {
+			for _, threads := range m.pageFaultThreadCounts() {
+				if name := pageFaultTestName(kind, threads); m.selected(name) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// selected reports whether Config.Filter selects the named test or group
+func (m *MemTester) selected(name string) bool {
+	return m.Config.Filter.Match(name)
+}
+
+// latencyTestName names the random access latency test over the whole array
+func (m *MemTester) latencyTestName() string {
+	return "latency/random/" + selector.SizeName(m.Config.ArraySize*8)
+}
+
+// blockTestName names one block size of the detailed benchmark
+func blockTestName(size int) string {
+	return "latency/block/" + selector.SizeName(size)
+}
+
+// structureTestName names one data structure at one element count of the
+// structure benchmark, e.g. "structures/btree/131072"
+func structureTestName(structure string, elements int) string {
+	return fmt.Sprintf("%s/%s/%d", structureGroup, structure, elements)
+}
+
+// threadTestName names one thread count of the multi-threaded test
+func threadTestName(threads int) string {
+	return fmt.Sprintf("threads/%d", threads)
+}
+
+// pageFaultTestName names one case of the page fault test
+func pageFaultTestName(kind pageKind, threads int) string {
+	if threads == 1 {
+		return fmt.Sprintf("%s/%s/1-thread", pageFaultGroup, kind.name())
+	}
+	return fmt.Sprintf("%s/%s/%d-threads", pageFaultGroup, kind.name(), threads)
+}
@@ -0,0 +1,202 @@
+package test1
+
+import (
+	"app/pkg/timer"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// pageKind selects the page size used to back a fresh mapping
+type pageKind int
+
+const (
+	pageSmall   pageKind = iota // base pages, transparent huge pages disabled
+	pageTHP                     // transparent huge pages via madvise
+	pageHugeTLB                 // explicit huge pages from hugetlbfs
+)
+
+// pageKinds are the page kinds in the order they are tested
+var pageKinds = []pageKind{pageSmall, pageTHP, pageHugeTLB}
+
+// name returns the page kind as used in test names
+func (k pageKind) name() string {
+	switch k {
+	case pageSmall:
+		return "base-pages"
+	case pageTHP:
+		return "thp"
+	case pageHugeTLB:
+		return "hugetlbfs"
+	}
+	return "unknown"
+}
+
+// String returns the label used for the page kind in reports
+func (k pageKind) String() string {
+	switch k {
+	case pageSmall:
+		return fmt.Sprintf("%d KB pages", os.Getpagesize()/1024)
+	case pageTHP:
+		return "THP"
+	case pageHugeTLB:
+		return "hugetlbfs"
+	}
+	return "unknown"
+}
+
+// PageFaultResult holds the measured first-touch cost of one case
+type PageFaultResult struct {
+	Pages   string
+	Threads int
+	Bytes   int
+	Elapsed time.Duration
+	Faults  int64 // minor faults counted by getrusage, -1 if unavailable
+	Huge    int64 // bytes of a THP case backed by huge pages, -1 if unknown or not THP
+}
+
+// FaultsPerSecond returns the minor fault rate
+func (r PageFaultResult) FaultsPerSecond() float64 {
+	if r.Faults < 0 {
+		return 0
+	}
+	return float64(r.Faults) / r.Elapsed.Seconds()
+}
+
+// NsPerPage returns the time taken per base page touched
+func (r PageFaultResult) NsPerPage() float64 {
+	return float64(r.Elapsed.Nanoseconds()) / float64(r.Bytes/os.Getpagesize())
+}
+
+// ZeroFillGBs returns how fast the kernel handed out zeroed memory
+func (r PageFaultResult) ZeroFillGBs() float64 {
+	return float64(r.Bytes) / r.Elapsed.Seconds() / 1e9
+}
+
+// RunPageFaultTest measures the cost of touching freshly mapped memory for
+// the first time, once per page size and thread count. The kernel has to
+// fault in and zero every page on first touch, a cost the other tests
+// hide in their setup.
+func (m *MemTester) RunPageFaultTest() []PageFaultResult {
+	fmt.Println("\n==== Page Fault / First-Touch Cost ====")
+
+	size := m.pageFaultTestSize()
+	fmt.Printf("Mapping and touching %s per case...\n", FormatSize(size))
+
+	var results []PageFaultResult
+	for _, kind := range pageKinds {
+		for _, threads := range m.pageFaultThreadCounts() {
+			if !m.selected(pageFaultTestName(kind, threads)) {
+				continue
+			}
+			result, err := firstTouch(m.measurementTimer(), size, kind, threads)
+			if err != nil {
+				fmt.Printf("%-12s %2d thread(s): skipped (%v)\n", kind, threads, err)
+				continue
+			}
+			// Without free huge pages or with THP disabled, madvise still
+			// succeeds and the kernel silently faults in base pages
+			if kind == pageTHP && result.Huge == 0 {
+				fmt.Printf("%-12s %2d thread(s): skipped (not backed by huge pages, see /sys/kernel/mm/transparent_hugepage/enabled)\n", kind, threads)
+				continue
+			}
+			results = append(results, result)
+
+			faults := "n/a"
+			if result.Faults >= 0 {
+				faults = fmt.Sprintf("%d faults, %.0f faults/s", result.Faults, result.FaultsPerSecond())
+			}
+			backing := ""
+			switch {
+			case kind != pageTHP:
+			case result.Huge < 0:
+				backing = ", huge page backing unknown"
+			case result.Huge < int64(result.Bytes):
+				backing = fmt.Sprintf(", only %.0f%% in huge pages", 100*float64(result.Huge)/float64(result.Bytes))
+			}
+			fmt.Printf("%-12s %2d thread(s): %v, %.0f ns%s per page, %.2f GB/s zero-fill, %s%s\n",
+				kind, threads, result.Elapsed, result.NsPerPage(), m.cycles(result.NsPerPage()), result.ZeroFillGBs(), faults, backing)
+		}
+	}
+
+	if len(results) > 0 {
+		values := make([]float64, len(results))
+		labels := make([]string, len(results))
+		for i, r := range results {
+			values[i] = r.ZeroFillGBs()
+			labels[i] = fmt.Sprintf("%s x%d", r.Pages, r.Threads)
+		}
+		m.drawChart("First-Touch Zero-Fill Rate", values, labels, "GB/s")
+	}
+
+	return results
+}
+
+// pageFaultThreadCounts returns the thread counts each page kind is tested with
+func (m *MemTester) pageFaultThreadCounts() []int {
+	if m.Config.Threads > 1 {
+		return []int{1, m.Config.Threads}
+	}
+	return []int{1}
+}
+
+// pageFaultTestSize returns the mapping size of each case, the array size
+// rounded up to whole 2 MB huge pages so every page kind maps the same size
+func (m *MemTester) pageFaultTestSize() int {
+	const hugePage = 2 * 1024 * 1024
+	return (m.Config.ArraySize*8 + hugePage - 1) / hugePage * hugePage
+}
+
+// firstTouch maps size bytes and writes one byte per base page, split
+// evenly between the given number of threads, timed with clock
+func firstTouch(clock *timer.Timer, size int, kind pageKind, threads int) (PageFaultResult, error) {
+	data, err := mapFresh(size, kind)
+	if err != nil {
+		return PageFaultResult{}, err
+	}
+	defer unmapFresh(data)
+
+	pageSize := os.Getpagesize()
+	chunk := (size/threads + pageSize - 1) / pageSize * pageSize
+
+	faultsBefore, ok := minorFaults()
+	start := clock.Now()
+
+	var wg sync.WaitGroup
+	for t := 0; t < threads; t++ {
+		begin := t * chunk
+		end := min(begin+chunk, size)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := begin; i < end; i += pageSize {
+				data[i] = 1
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := clock.Since(start)
+	faultsAfter, _ := minorFaults()
+
+	faults := int64(-1)
+	if ok {
+		faults = faultsAfter - faultsBefore
+	}
+	huge := int64(-1)
+	if kind == pageTHP {
+		if bytes, ok := hugePageBytes(data); ok {
+			huge = bytes
+		}
+	}
+
+	return PageFaultResult{
+		Pages:   kind.String(),
+		Threads: threads,
+		Bytes:   size,
+		Elapsed: elapsed,
+		Faults:  faults,
+		Huge:    huge,
+	}, nil
+}
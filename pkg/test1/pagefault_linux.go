@@ -0,0 +1,91 @@
+//go:build linux
+
+package test1
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// mapFresh maps size bytes of anonymous memory that has never been touched,
+// backed by pages of the requested kind
+func mapFresh(size int, kind pageKind) ([]byte, error) {
+	flags := syscall.MAP_ANON | syscall.MAP_PRIVATE
+	if kind == pageHugeTLB {
+		flags |= syscall.MAP_HUGETLB
+	}
+
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, flags)
+	if err != nil {
+		return nil, fmt.Errorf("mmap: %w", err)
+	}
+
+	switch kind {
+	case pageSmall:
+		err = syscall.Madvise(data, syscall.MADV_NOHUGEPAGE)
+	case pageTHP:
+		err = syscall.Madvise(data, syscall.MADV_HUGEPAGE)
+	}
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("madvise: %w", err)
+	}
+	return data, nil
+}
+
+// unmapFresh releases memory returned by mapFresh
+func unmapFresh(data []byte) {
+	syscall.Munmap(data)
+}
+
+// minorFaults returns the number of minor page faults of the process so far
+func minorFaults() (int64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return int64(usage.Minflt), true
+}
+
+// hugePageBytes returns how many bytes of the mapping that holds data are
+// backed by transparent huge pages, the AnonHugePages of its entry in
+// /proc/self/smaps
+func hugePageBytes(data []byte) (int64, bool) {
+	f, err := os.Open("/proc/self/smaps")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	return anonHugePages(f, uint64(uintptr(unsafe.Pointer(&data[0]))))
+}
+
+// anonHugePages reads the AnonHugePages field of the smaps entry whose
+// address range contains addr
+func anonHugePages(r io.Reader, addr uint64) (int64, bool) {
+	scanner := bufio.NewScanner(r)
+	inside := false
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// Entries start with the address range, "start-end perms ..."
+		if start, end, ok := strings.Cut(fields[0], "-"); ok && !strings.HasSuffix(fields[0], ":") {
+			low, err1 := strconv.ParseUint(start, 16, 64)
+			high, err2 := strconv.ParseUint(end, 16, 64)
+			inside = err1 == nil && err2 == nil && addr >= low && addr < high
+			continue
+		}
+		if inside && fields[0] == "AnonHugePages:" && len(fields) >= 2 {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024, err == nil
+		}
+	}
+	return 0, false
+}
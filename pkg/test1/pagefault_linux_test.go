@@ -0,0 +1,42 @@
+//go:build linux
+
+package test1
+
+import (
+	"strings"
+	"testing"
+)
+
+const smaps = `00400000-00452000 r-xp 00000000 08:02 173521      /usr/bin/test1
+Size:                328 kB
+AnonHugePages:         0 kB
+VmFlags: rd ex mr mw me dw
+7f0000000000-7f0000400000 rw-p 00000000 00:00 0
+Size:               4096 kB
+Anon-Test:             1 kB
+AnonHugePages:      2048 kB
+VmFlags: rd wr mr mw me ac hg
+7f0000400000-7f0000600000 rw-p 00000000 00:00 0
+Size:               2048 kB
+VmFlags: rd wr mr mw me ac nh
+`
+
+func TestAnonHugePages(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  uint64
+		bytes int64
+		ok    bool
+	}{
+		{"first mapping", 0x400000, 0, true},
+		{"inside a mapping", 0x7f0000123000, 2 << 20, true},
+		{"mapping without the field", 0x7f0000400000, 0, false},
+		{"no mapping", 0x1000, 0, false},
+	}
+	for _, test := range tests {
+		bytes, ok := anonHugePages(strings.NewReader(smaps), test.addr)
+		if bytes != test.bytes || ok != test.ok {
+			t.Errorf("%s: anonHugePages(%#x) = %d, %v, want %d, %v", test.name, test.addr, bytes, ok, test.bytes, test.ok)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package test1
+
+import "errors"
+
+// mapFresh is only implemented on Linux
+func mapFresh(size int, kind pageKind) ([]byte, error) {
+	return nil, errors.New("fresh anonymous mappings are only supported on Linux")
+}
+
+// unmapFresh is only implemented on Linux
+func unmapFresh(data []byte) {}
+
+// minorFaults is only implemented on Linux
+func minorFaults() (int64, bool) {
+	return 0, false
+}
+
+// hugePageBytes is only implemented on Linux
+func hugePageBytes(data []byte) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,363 @@
+package test1
+
+import (
+	"app/pkg/dryrun"
+	"app/pkg/sysmem"
+	"app/pkg/workload"
+	"fmt"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+// Planner limits
+const (
+	minArraySize   = 1024 * 1024 // elements, the smallest -size scaling goes down to
+	minThreadBlock = 1024 * 1024 // bytes per thread for the multi-threaded test
+)
+
+// Fixed parameters of the sequential vs random access test
+const (
+	sequentialBytes      = 64 * 1024 * 1024
+	sequentialIterations = 10000000
+)
+
+// intSize is the size of the elements of the chain successor tables
+const intSize = int64(unsafe.Sizeof(int(0)))
+
+// TestMemory is the peak memory one selected test needs
+type TestMemory struct {
+	Name  string
+	Bytes int64
+}
+
+// plannedTest describes how much memory and time a test needs and how to
+// make it fit
+type plannedTest struct {
+	name     string
+	enabled  bool
+	peak     func() int64
+	shrink   func() bool // reduces the test's memory, false when it cannot
+	disable  func()      // nil for tests that always run
+	estimate func(cal dryrun.Calibration) dryrun.Step
+}
+
+// plannedTests returns every test with its memory model. Peaks include the
+// chain successor tables, which have one entry per array element.
+func (m *MemTester) plannedTests() []plannedTest {
+	c := m.Config
+	timing := dryrun.Timing{Repetitions: c.Repetitions, Target: c.TargetTime}
+	halveArray := func() bool {
+		if c.ArraySize/2 < minArraySize {
+			return false
+		}
+		c.ArraySize /= 2
+		return true
+	}
+
+	if c.StressDuration > 0 {
+		return []plannedTest{{
+			name:    "Memory Stress Test",
+			enabled: true,
+			peak: func() int64 {
+				return int64(max(1024, c.ArraySize/c.Threads)) * 8 * int64(c.Threads)
+			},
+			shrink: halveArray,
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				return dryrun.Step{
+					WorkingSet: FormatSize(max(1024, c.ArraySize/c.Threads)*8) + " x" + fmt.Sprint(c.Threads),
+					Threads:    c.Threads,
+					Duration:   c.StressDuration,
+				}
+			},
+		}}
+	}
+
+	return []plannedTest{
+		{
+			name:    "Random Access Latency",
+			enabled: m.selected(m.latencyTestName()),
+			peak:    func() int64 { return int64(c.ArraySize) * (8 + intSize) },
+			shrink:  halveArray,
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				bytes := int64(c.ArraySize) * 8
+				return dryrun.Step{
+					WorkingSet: FormatSize(int(bytes)),
+					Iterations: timing.Iterations(int64(c.Iterations)),
+					Threads:    1,
+					Duration:   cal.Setup(int64(c.ArraySize)) + cal.Chase(1000000, bytes) + timing.Duration(cal.Chase(int64(c.Iterations), bytes)),
+				}
+			},
+		},
+		{
+			name:    "Detailed Benchmarks",
+			enabled: c.TestDetailedSizes && len(m.detailedSizes()) > 0,
+			peak: func() int64 {
+				sizes := m.detailedSizes()
+				return int64(sizes[len(sizes)-1]) / 8 * (8 + intSize)
+			},
+			shrink: func() bool {
+				if c.SkipLargeTests {
+					return false
+				}
+				c.SkipLargeTests = true
+				return true
+			},
+			disable: func() { c.TestDetailedSizes = false },
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				sizes := m.detailedSizes()
+				step := dryrun.Step{
+					WorkingSet: FormatSize(sizes[0]) + "-" + FormatSize(sizes[len(sizes)-1]),
+					Threads:    1,
+				}
+				for _, size := range sizes {
+					elements := size / 8
+					iters := int64(detailedIterations(elements))
+					warmup := int64(min(1000000, elements*10))
+					step.Iterations += timing.Iterations(iters)
+					step.Duration += cal.Setup(int64(elements)) + cal.Chase(warmup, int64(size)) + timing.Duration(cal.Chase(iters, int64(size)))
+				}
+				return step
+			},
+		},
+		{
+			name:    "Data Structure Lookups",
+			enabled: c.TestStructures && len(m.structureSizes()) > 0,
+			// One structure at a time, with its shuffled keys and the
+			// pointers it is linked through while it is built
+			peak: func() int64 {
+				sizes := m.structureSizes()
+				size := sizes[len(sizes)-1]
+				return m.largestStructure(size) + int64(size)*2 + 4*workload.LookupStream
+			},
+			shrink: func() bool {
+				if c.SkipLargeTests {
+					return false
+				}
+				c.SkipLargeTests = true
+				return true
+			},
+			disable: func() { c.TestStructures = false },
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				sizes := m.structureSizes()
+				step := dryrun.Step{
+					WorkingSet: fmt.Sprintf("%d-%d elements", sizes[0]/8, sizes[len(sizes)-1]/8),
+					Threads:    1,
+				}
+				for _, size := range sizes {
+					// The chase is measured again unless the detailed
+					// benchmark ran it
+					elements := int64(size / 8)
+					if !c.TestDetailedSizes || !m.selected(blockTestName(size)) {
+						iters := int64(detailedIterations(size / 8))
+						step.Iterations += timing.Iterations(iters)
+						step.Duration += cal.Setup(elements) + cal.Chase(min(1000000, elements*10), int64(size)) + timing.Duration(cal.Chase(iters, int64(size)))
+					}
+					for _, structure := range workload.LookupStructures {
+						if !m.selected(structureTestName(structure, size/8)) {
+							continue
+						}
+						w, err := workload.New("lookup/"+structure, m.workloadParams(size))
+						if err != nil {
+							continue
+						}
+						// Building shuffles the keys and links every element,
+						// and a lookup loads about one line per 64 bytes read
+						info := w.Info()
+						iters := int64(structureIterations(size/8, info))
+						loads := iters * int64(max(1, info.BytesPerOp/64))
+						bytes := int64(info.WorkingSet)
+						step.Iterations += timing.Iterations(iters)
+						step.Duration += cal.Setup(elements) + cal.Chase(elements, bytes) + cal.Chase(loads/10, bytes) + timing.Duration(cal.Chase(loads, bytes))
+					}
+				}
+				return step
+			},
+		},
+		{
+			name:    "Sequential vs Random Access",
+			enabled: c.TestSequential && m.selected(sequentialTestName),
+			// The two patterns run one after the other
+			peak:    func() int64 { return sequentialBytes + sequentialBytes/8*intSize },
+			shrink:  func() bool { return false },
+			disable: func() { c.TestSequential = false },
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				return dryrun.Step{
+					WorkingSet: FormatSize(sequentialBytes) + " x2",
+					Iterations: 2 * timing.Iterations(sequentialIterations),
+					Threads:    1,
+					Duration: cal.Setup(2*sequentialBytes/8) +
+						timing.Duration(cal.Chase(sequentialIterations, 0)) + timing.Duration(cal.Chase(sequentialIterations, sequentialBytes)),
+				}
+			},
+		},
+		{
+			name:    "Multi-threaded Test",
+			enabled: c.TestThreaded && len(m.threadCounts()) > 0,
+			peak: func() int64 {
+				// All threads' arrays are alive at once, plus one successor table
+				counts := m.threadCounts()
+				block := int64(m.threadBlockSize())
+				return block*int64(counts[len(counts)-1]) + block/8*intSize
+			},
+			shrink: func() bool {
+				if c.ThreadBlockSize/2 < minThreadBlock {
+					return false
+				}
+				c.ThreadBlockSize /= 2
+				return true
+			},
+			disable: func() { c.TestThreaded = false },
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				// Every thread count from 1 to Threads sets up its own
+				// arrays, and threads beyond GOMAXPROCS take turns
+				block := int64(m.threadBlockSize())
+				step := dryrun.Step{WorkingSet: FormatSize(int(block)) + " per thread", Threads: c.Threads}
+				for _, t := range m.threadCounts() {
+					iters := int64(max(1000000, c.Iterations/t))
+					rounds := int64((t + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+					step.Iterations += iters * int64(t)
+					step.Duration += cal.Setup(int64(t)*block/8) +
+						cal.Chase(int64(t)*min(100000, block/8), block) +
+						cal.Chase(iters*rounds, block*int64(t))
+				}
+				return step
+			},
+		},
+		{
+			name:    "Page Fault Test",
+			enabled: c.TestPageFaults && m.selected(pageFaultGroup),
+			peak:    func() int64 { return int64(m.pageFaultTestSize()) },
+			shrink:  halveArray,
+			disable: func() { c.TestPageFaults = false },
+			estimate: func(cal dryrun.Calibration) dryrun.Step {
+				size := m.pageFaultTestSize()
+				step := dryrun.Step{WorkingSet: FormatSize(size)}
+				for _, kind := range pageKinds {
+					for _, threads := range m.pageFaultThreadCounts() {
+						if m.selected(pageFaultTestName(kind, threads)) {
+							step.Threads = max(step.Threads, threads)
+							step.Duration += cal.FirstTouch(int64(size))
+						}
+					}
+				}
+				return step
+			},
+		},
+	}
+}
+
+// MemoryPlan returns the peak memory of every selected test
+func (m *MemTester) MemoryPlan() []TestMemory {
+	var plan []TestMemory
+	for _, test := range m.plannedTests() {
+		if test.enabled {
+			plan = append(plan, TestMemory{Name: test.name, Bytes: test.peak()})
+		}
+	}
+	return plan
+}
+
+// DryRun prints every test that RunAll, or RunStressTest when
+// Config.StressDuration is set, would run with its sizes, peak memory and
+// an estimated time from a short calibration probe, without running it
+func (m *MemTester) DryRun() {
+	fmt.Println("\nCalibrating...")
+	cal := dryrun.Calibrate()
+	fmt.Println("Calibration:", cal)
+
+	var steps []dryrun.Step
+	for _, test := range m.plannedTests() {
+		if !test.enabled {
+			continue
+		}
+		step := test.estimate(cal)
+		step.Name = test.name
+		step.PeakBytes = test.peak()
+		steps = append(steps, step)
+	}
+	dryrun.Print(steps)
+}
+
+// CheckMemory compares the peak memory of the selected tests with
+// MemAvailable and the cgroup memory limit before anything is allocated.
+// Depending on Config.OnLowMemory it then refuses to run, scales the
+// configuration down until it fits, or only warns. Tests run one after
+// another, so only the largest one has to fit.
+func (m *MemTester) CheckMemory() error {
+	fmt.Println("\n==== Memory Budget ====")
+
+	budget, err := sysmem.ReadBudget()
+	if err != nil {
+		fmt.Printf("Available memory unknown (%v), skipping the check\n", err)
+		return nil
+	}
+	limit := budget.Available() - sysmem.Reserve
+	fmt.Printf("Available: %s (%s)\n", FormatSize(int(max(0, limit))), budget)
+
+	tests := m.plannedTests()
+	for _, test := range tests {
+		if test.enabled {
+			fmt.Printf("%-28s %10s\n", test.name, FormatSize(int(test.peak())))
+		}
+	}
+
+	var tooLarge []string
+	for _, test := range tests {
+		if test.enabled && test.peak() > limit {
+			tooLarge = append(tooLarge, fmt.Sprintf("%s needs %s", test.name, FormatSize(int(test.peak()))))
+		}
+	}
+	if len(tooLarge) == 0 {
+		fmt.Println("All selected tests fit")
+		limitHeap(limit)
+		return nil
+	}
+
+	switch m.Config.OnLowMemory {
+	case sysmem.LowMemoryWarn:
+		fmt.Printf("Warning: %s, more than the %s available; the process may be OOM killed\n",
+			strings.Join(tooLarge, ", "), FormatSize(int(max(0, limit))))
+		return nil
+	case sysmem.LowMemoryScale:
+		if err := m.scaleToFit(tests, limit); err != nil {
+			return err
+		}
+		limitHeap(limit)
+		return nil
+	default:
+		return fmt.Errorf("not enough memory: %s, but only %s is available (use -size or -on-low-memory=scale)",
+			strings.Join(tooLarge, ", "), FormatSize(int(max(0, limit))))
+	}
+}
+
+// limitHeap lowers the Go runtime's memory limit to the available memory,
+// see sysmem.LimitHeap
+func limitHeap(available int64) {
+	if limit := sysmem.LimitHeap(available); limit > 0 {
+		fmt.Printf("Go memory limit: %s\n", FormatSize(int(limit)))
+	}
+}
+
+// scaleToFit shrinks every test that exceeds limit, and drops optional
+// tests that still do not fit
+func (m *MemTester) scaleToFit(tests []plannedTest, limit int64) error {
+	for _, test := range tests {
+		if !test.enabled || test.peak() <= limit {
+			continue
+		}
+		for test.peak() > limit && test.shrink() {
+		}
+		if test.peak() <= limit {
+			fmt.Printf("Scaled down %s to %s\n", test.name, FormatSize(int(test.peak())))
+			continue
+		}
+		if test.disable == nil {
+			return fmt.Errorf("not enough memory: %s needs at least %s, but only %s is available",
+				test.name, FormatSize(int(test.peak())), FormatSize(int(max(0, limit))))
+		}
+		test.disable()
+		fmt.Printf("Skipping %s, it needs at least %s\n", test.name, FormatSize(int(test.peak())))
+	}
+	return nil
+}
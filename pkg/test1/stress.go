@@ -0,0 +1,171 @@
+package test1
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/edac"
+	"app/pkg/memcheck"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stressWorkloads are run by every stress worker in turn. Write fills the
+// buffer with one value that copy moves between its halves and read checks,
+// so corruption in any of them is found; verify checks its own pattern.
+var stressWorkloads = []string{"write", "copy", "read", "verify"}
+
+// StressResult summarizes a stress run
+type StressResult struct {
+	Elapsed    time.Duration
+	Bytes      int64 // bytes read and written by all workers
+	Errors     int64
+	Mismatches []memcheck.Mismatch // first mismatch of each failing worker
+	ECC        []edac.Delta        // ECC error counters that increased during the run
+}
+
+// RunStressTest burns in memory by running mixed read, write, copy and
+// pattern-verify workloads on Config.Threads workers, each with its own
+// share of Config.ArraySize. It runs for the given duration or until the
+// first data corruption and prints a health snapshot every
+// Config.StressInterval, or none when it is not positive.
+func (m *MemTester) RunStressTest(duration time.Duration) StressResult {
+	fmt.Println("\n==== Memory Stress Test ====")
+
+	threads := m.Config.Threads
+	words := max(1024, m.Config.ArraySize/threads)
+	fmt.Printf("Running %d workers on %s each for %v (until the first error)...\n",
+		threads, FormatSize(words*8), duration)
+
+	var bytes, errors atomic.Int64
+	var stop atomic.Bool
+	var mu sync.Mutex
+	var mismatches []memcheck.Mismatch
+
+	eccBefore := edac.ReadCounters(edac.SysfsDir)
+	done := make(chan struct{})
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	go m.printStressSnapshots(start, &bytes, &errors, done)
+
+	runWorkers(threads, func(threadID int) {
+		buf, buffer := alloc.Make[uint64](m.Config.Alloc, words)
+		defer buffer.Free()
+		half := words / 2
+		seed := uint64(threadID) << 48
+		written := uint64(0) // value of every word since the last write
+
+		// Only the first mismatch of every worker is kept
+		recorded := false
+		record := func(test string, i int, expected, actual uint64) {
+			if recorded {
+				return
+			}
+			recorded = true
+			mu.Lock()
+			mismatches = append(mismatches, memcheck.NewMismatch(test, buf, i, expected, actual))
+			mu.Unlock()
+		}
+		fail := func(failures int) {
+			if failures > 0 {
+				errors.Add(int64(failures))
+				stop.Store(true)
+			}
+		}
+
+		for round := 0; !stop.Load() && time.Now().Before(deadline); round++ {
+			switch stressWorkloads[round%len(stressWorkloads)] {
+			case "read":
+				failures := 0
+				for i, v := range buf {
+					if v != written {
+						record("stress-read", i, written, v)
+						failures++
+					}
+				}
+				bytes.Add(int64(words) * 8)
+				fail(failures)
+			case "write":
+				written = uint64(round) | seed
+				for i := range buf {
+					buf[i] = written
+				}
+				bytes.Add(int64(words) * 8)
+			case "copy":
+				copy(buf[:half], buf[half:2*half])
+				copy(buf[half:2*half], buf[:half])
+				bytes.Add(int64(half) * 8 * 4)
+			case "verify":
+				seed++
+				memcheck.FillRandom(buf, seed)
+				failures := memcheck.VerifyRandom(buf, seed, func(i int, expected, actual uint64) {
+					record("stress-verify", i, expected, actual)
+				})
+				bytes.Add(int64(words) * 8 * 2)
+				fail(failures)
+			}
+		}
+	})
+
+	close(done)
+
+	result := StressResult{
+		Elapsed:    time.Since(start),
+		Bytes:      bytes.Load(),
+		Errors:     errors.Load(),
+		Mismatches: mismatches,
+		ECC:        edac.ReadCounters(edac.SysfsDir).Sub(eccBefore),
+	}
+
+	fmt.Println("\n==== Stress Test Summary ====")
+	fmt.Printf("Elapsed: %v\n", result.Elapsed.Round(time.Second))
+	fmt.Printf("Data moved: %s (%.2f GB/s average)\n",
+		FormatSize(int(result.Bytes)), float64(result.Bytes)/result.Elapsed.Seconds()/1e9)
+	if result.Errors == 0 {
+		fmt.Println("No errors found")
+	} else {
+		fmt.Printf("DATA CORRUPTION: %d errors found\n", result.Errors)
+		for _, mismatch := range result.Mismatches {
+			fmt.Println(" ", mismatch)
+		}
+	}
+	edac.PrintDeltas("Stress Test", result.ECC)
+
+	return result
+}
+
+// printStressSnapshots prints throughput, errors and temperatures at every
+// interval until done is closed. A non-positive interval prints none.
+func (m *MemTester) printStressSnapshots(start time.Time, bytes, errors *atomic.Int64, done chan struct{}) {
+	if m.Config.StressInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.Config.StressInterval)
+	defer ticker.Stop()
+
+	lastBytes := int64(0)
+	lastTime := start
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			total := bytes.Load()
+			throughput := float64(total-lastBytes) / now.Sub(lastTime).Seconds() / 1e9
+			lastBytes, lastTime = total, now
+
+			line := fmt.Sprintf("[%v] throughput: %.2f GB/s, errors: %d",
+				now.Sub(start).Round(time.Second), throughput, errors.Load())
+			if zones := ReadThermalZones(thermalDir); len(zones) > 0 {
+				temps := make([]string, len(zones))
+				for i, zone := range zones {
+					temps[i] = fmt.Sprintf("%s %.1f°C", zone.Name, zone.Celsius)
+				}
+				line += ", temp: " + strings.Join(temps, ", ")
+			}
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package test1
+
+import (
+	"app/pkg/workload"
+	"fmt"
+	"strings"
+)
+
+// structureGroup is the test group of RunStructureBenchmark
+const structureGroup = "structures"
+
+// minStructureLookups is the fewest lookups timed per structure and size,
+// since one linked list lookup at DRAM sizes takes a good part of a second
+const minStructureLookups = 3
+
+// maxChartChaseLoads is the most chase loads a lookup may cost to be drawn
+// in the chart of RunStructureBenchmark
+const maxChartChaseLoads = 1000
+
+// structureRow holds the results of every structure at one element count
+type structureRow struct {
+	elements int
+	chaseNs  float64   // one dependent load through a chain of as many nodes
+	lookupNs []float64 // per structure of workload.LookupStructures, 0 when not run
+	bytes    []int     // heap of every structure
+}
+
+// RunStructureBenchmark looks up random keys in Go data structures of as
+// many int64 elements as the block sizes of the detailed benchmark hold,
+// from L1 to DRAM resident, and prints their latency per lookup next to the
+// pointer chasing latency of the same block size. Lookups depend on the
+// previous one like the loads of the chase. The chase is reused from
+// RunDetailedBenchmark when it ran, and measured otherwise.
+func (m *MemTester) RunStructureBenchmark() {
+	fmt.Println("\n==== Data Structure Lookup Latency ====")
+
+	var rows []structureRow
+	for _, size := range m.structureSizes() {
+		elements := size / 8
+		row := structureRow{
+			elements: elements,
+			lookupNs: make([]float64, len(workload.LookupStructures)),
+			bytes:    make([]int, len(workload.LookupStructures)),
+		}
+		if chase, ok := m.chaseLatency[size]; ok {
+			row.chaseNs = chase
+		} else if result, ok := m.measure("chain/random", size, detailedIterations(elements), min(1000000, elements*10)); ok {
+			row.chaseNs = result.NsPerOp()
+		}
+
+		for i, structure := range workload.LookupStructures {
+			if !m.selected(structureTestName(structure, elements)) {
+				continue
+			}
+			name := "lookup/" + structure
+			w, err := workload.New(name, m.workloadParams(size))
+			if err != nil {
+				fmt.Printf("Skipping %s: %v\n", name, err)
+				continue
+			}
+			iterations := structureIterations(elements, w.Info())
+			if result, ok := m.run(w, iterations, max(1, iterations/10)); ok {
+				row.lookupNs[i] = result.NsPerOp()
+				row.bytes[i] = result.Info.WorkingSet
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	header := fmt.Sprintf("%-10s %10s", "Elements", "chase")
+	for _, structure := range workload.LookupStructures {
+		header += fmt.Sprintf(" %12s", structure)
+	}
+	fmt.Println(header)
+	fmt.Println(strings.Repeat("-", len(header)))
+	for _, row := range rows {
+		line := fmt.Sprintf("%-10d %10s", row.elements, formatLatency(row.chaseNs))
+		for _, ns := range row.lookupNs {
+			line += fmt.Sprintf(" %12s", formatLatency(ns))
+		}
+		fmt.Println(line)
+	}
+
+	// The same lookups in dependent loads, and the memory per element
+	fmt.Println("\nLookup cost in chase loads of the same block size:")
+	fmt.Println(header)
+	fmt.Println(strings.Repeat("-", len(header)))
+	for _, row := range rows {
+		line := fmt.Sprintf("%-10d %10s", row.elements, "1")
+		for _, ns := range row.lookupNs {
+			cell := "-"
+			if ns > 0 && row.chaseNs > 0 {
+				cell = fmt.Sprintf("%.1f", ns/row.chaseNs)
+			}
+			line += fmt.Sprintf(" %12s", cell)
+		}
+		fmt.Println(line)
+	}
+	last := rows[len(rows)-1]
+	perElement := fmt.Sprintf("Heap per element at %d elements:", last.elements)
+	for i, structure := range workload.LookupStructures {
+		if last.bytes[i] > 0 {
+			perElement += fmt.Sprintf(" %s %.1f B,", structure, float64(last.bytes[i])/float64(last.elements))
+		}
+	}
+	fmt.Println(strings.TrimSuffix(perElement, ","))
+
+	// Linear searches would flatten every other bar
+	values := []float64{last.chaseNs}
+	labels := []string{"chase"}
+	var offScale []string
+	for i, structure := range workload.LookupStructures {
+		switch ns := last.lookupNs[i]; {
+		case ns > maxChartChaseLoads*last.chaseNs:
+			offScale = append(offScale, fmt.Sprintf("%s (%s)", structure, formatLatency(ns)))
+		case ns > 0:
+			values = append(values, ns)
+			labels = append(labels, structure)
+		}
+	}
+	m.drawChart(fmt.Sprintf("Lookup Latency at %d Elements", last.elements), values, labels, "ns")
+	if len(offScale) > 0 {
+		fmt.Printf("Off the chart: %s\n", strings.Join(offScale, ", "))
+	}
+}
+
+// structureSizes returns the block sizes of the detailed benchmark at which
+// any data structure is selected
+func (m *MemTester) structureSizes() []int {
+	var selected []int
+	for _, size := range m.blockSizes() {
+		for _, structure := range workload.LookupStructures {
+			if m.selected(structureTestName(structure, size/8)) {
+				selected = append(selected, size)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// largestStructure returns the estimated heap of the largest selected
+// structure at a block size
+func (m *MemTester) largestStructure(size int) int64 {
+	largest := 0
+	for _, structure := range workload.LookupStructures {
+		if !m.selected(structureTestName(structure, size/8)) {
+			continue
+		}
+		if w, err := workload.New("lookup/"+structure, m.workloadParams(size)); err == nil {
+			largest = max(largest, w.Info().WorkingSet)
+		}
+	}
+	return int64(largest)
+}
+
+// structureIterations returns the number of timed lookups in a structure:
+// as many bytes as the detailed benchmark loads at the same size, at least
+// minStructureLookups
+func structureIterations(elements int, info workload.Info) int {
+	return max(minStructureLookups, detailedIterations(elements)*8/max(1, info.BytesPerOp))
+}
+
+// formatLatency formats a latency in ns, us, ms or s, or "-" when it is 0
+func formatLatency(ns float64) string {
+	switch {
+	case ns <= 0:
+		return "-"
+	case ns < 1000:
+		return fmt.Sprintf("%.1f ns", ns)
+	case ns < 1e6:
+		return fmt.Sprintf("%.1f us", ns/1e3)
+	case ns < 1e9:
+		return fmt.Sprintf("%.1f ms", ns/1e6)
+	}
+	return fmt.Sprintf("%.2f s", ns/1e9)
+}
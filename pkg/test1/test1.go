@@ -2,8 +2,14 @@
 package test1
 
 import (
+	"app/pkg/alloc"
+	"app/pkg/edac"
+	"app/pkg/selector"
+	"app/pkg/smbios"
+	"app/pkg/sysmem"
+	"app/pkg/timer"
+	"app/pkg/workload"
 	"fmt"
-	"math/rand"
 	"runtime"
 	"strings"
 	"sync"
@@ -21,6 +27,19 @@ type Config struct {
 	TestSequential    bool
 	TestThreaded      bool
 	TestDetailedSizes bool
+	TestStructures    bool // look up keys in Go data structures at the detailed benchmark's sizes
+	TestPageFaults    bool
+	Repetitions       int              // timed runs per measurement, the median is reported
+	TargetTime        time.Duration    // when > 0, iterations grow until each timed run takes this long
+	VerifyChains      bool             // check every pointer chain is one cycle before timing it
+	Timer             timer.Kind       // clock measurements are timed with
+	FrequencySource   string           // timer.FrequencyMeasured or timer.FrequencySysfs, for cycle counts
+	ThreadBlockSize   int              // bytes per thread in the multi-threaded test
+	Alloc             alloc.Strategy   // how test buffers are allocated
+	Filter            *selector.Filter // -run and -skip patterns, nil runs every test
+	OnLowMemory       string           // sysmem.LowMemoryRefuse, LowMemoryScale or LowMemoryWarn
+	StressDuration    time.Duration    // run the stress test instead of RunAll when > 0
+	StressInterval    time.Duration    // time between stress health snapshots
 }
 
 // NewDefaultConfig creates a Config with sensible defaults
@@ -38,12 +57,26 @@ func NewDefaultConfig() *Config {
 		TestSequential:    true,
 		TestThreaded:      true,
 		TestDetailedSizes: true,
+		TestStructures:    false,
+		TestPageFaults:    true,
+		Repetitions:       1,
+		Timer:             timer.Auto,
+		FrequencySource:   timer.FrequencyMeasured,
+		ThreadBlockSize:   64 * 1024 * 1024,
+		Alloc:             alloc.Heap,
+		OnLowMemory:       sysmem.LowMemoryScale,
+		StressDuration:    0,
+		StressInterval:    10 * time.Second,
 	}
 }
 
 // MemTester is the main struct for memory testing
 type MemTester struct {
-	Config *Config
+	Config       *Config
+	overhead     *workload.Overhead // measured on first use, see measurementOverhead
+	clock        *timer.Timer       // set up on first use, see measurementTimer
+	frequency    *timer.Frequency   // core frequency, nil when unknown
+	chaseLatency map[int]float64    // detailed benchmark results by block size, reused by RunStructureBenchmark
 }
 
 // NewMemTester creates a new memory tester with the given configuration
@@ -51,7 +84,7 @@ func NewMemTester(config *Config) *MemTester {
 	if config == nil {
 		config = NewDefaultConfig()
 	}
-	return &MemTester{Config: config}
+	return &MemTester{Config: config, chaseLatency: make(map[int]float64)}
 }
 
 // PrintSystemInfo prints information about the system
@@ -62,89 +95,70 @@ func (m *MemTester) PrintSystemInfo() {
 	fmt.Printf("Architecture: %s\n", runtime.GOARCH)
 	fmt.Printf("CPU Cores: %d\n", runtime.NumCPU())
 	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	smbios.PrintInventory()
 	fmt.Println()
 }
 
-// RunAll executes all configured memory tests
+// RunAll executes all configured memory tests that Config.Filter selects.
+// ECC error counters are checked around every test when EDAC is available.
 func (m *MemTester) RunAll() {
 	fmt.Println("RAM Latency Test - Similar to AIDA64")
 	m.PrintSystemInfo()
 
-	memorySizeMB := m.Config.ArraySize * 8 / 1024 / 1024
-	fmt.Printf("Allocating %d MB of RAM for testing...\n", memorySizeMB)
-
-	// Allocate a large array
-	array := make([]int64, m.Config.ArraySize)
+	if m.selected(m.latencyTestName()) {
+		edac.Watch("Random Access Latency", m.RunLatencyTest)
+	}
 
-	// Initialize the array with indices to create a linked list of pointers
-	// This creates random access patterns to prevent CPU prefetching
-	indices := rand.Perm(m.Config.ArraySize)
-	for i := 0; i < m.Config.ArraySize-1; i++ {
-		array[indices[i]] = int64(indices[i+1])
+	// Run additional benchmark tests
+	if m.Config.TestDetailedSizes && len(m.detailedSizes()) > 0 {
+		edac.Watch("Detailed Benchmarks", m.RunDetailedBenchmark)
 	}
-	array[indices[m.Config.ArraySize-1]] = int64(indices[0]) // Close the loop
 
-	fmt.Println("Warming up cache...")
-	// Warm up
-	j := int64(0)
-	for i := 0; i < 1000000; i++ {
-		j = array[j]
+	if m.Config.TestStructures && len(m.structureSizes()) > 0 {
+		edac.Watch("Data Structure Lookups", m.RunStructureBenchmark)
 	}
-	// Ensure j is used to prevent compiler optimization
-	if j < 0 {
-		fmt.Println(j)
+
+	if m.Config.TestSequential && m.selected(sequentialTestName) {
+		edac.Watch("Sequential vs Random Access", m.MeasureSequentialAccess)
 	}
 
-	fmt.Println("Running latency test...")
+	if m.Config.TestThreaded && len(m.threadCounts()) > 0 {
+		edac.Watch("Multi-threaded Test", m.RunThreadedTest)
+	}
 
-	// Measure random access time
-	start := time.Now()
-	j = 0
-	for i := 0; i < m.Config.Iterations; i++ {
-		j = array[j]
+	if m.Config.TestPageFaults && m.selected(pageFaultGroup) {
+		edac.Watch("Page Fault Test", func() { m.RunPageFaultTest() })
 	}
-	elapsed := time.Since(start)
+}
+
+// RunLatencyTest measures random access latency over the whole array
+func (m *MemTester) RunLatencyTest() {
+	memorySizeMB := m.Config.ArraySize * 8 / 1024 / 1024
+	fmt.Printf("Allocating %d MB of RAM for testing (%s)...\n", memorySizeMB, m.Config.Alloc)
 
-	// Ensure j is used to prevent compiler optimization
-	if j < 0 {
-		fmt.Println(j)
+	// The array is linked into a random cycle of indices to prevent CPU
+	// prefetching, and the chain is warmed up with a million loads
+	fmt.Println("Running latency test...")
+	result, ok := m.measure("chain/random", m.Config.ArraySize*8, m.Config.Iterations, 1000000)
+	if !ok {
+		return
 	}
 
 	// Calculate average latency per memory access
-	avgLatency := float64(elapsed.Nanoseconds()) / float64(m.Config.Iterations)
+	avgLatency := result.NsPerOp()
 
-	fmt.Printf("\nTest completed with %d iterations\n", m.Config.Iterations)
+	fmt.Printf("\nTest completed with %d iterations\n", result.Iterations)
 	fmt.Printf("Memory size: %d MB\n", memorySizeMB)
-	fmt.Printf("Total time elapsed: %v\n", elapsed)
-	fmt.Printf("Average memory latency: %.2f ns\n", avgLatency)
+	fmt.Printf("Total time elapsed: %v\n", result.Elapsed())
+	fmt.Printf("Average memory latency: %.2f ns%s%s\n", avgLatency, result.Cycles(), result.Spread())
 	m.drawChart("Random Access Latency", []float64{avgLatency}, []string{"256MB"}, "ns")
-
-	// Run additional benchmark tests
-	if m.Config.TestDetailedSizes {
-		m.RunDetailedBenchmark()
-	}
-
-	if m.Config.TestSequential {
-		m.MeasureSequentialAccess()
-	}
-
-	if m.Config.TestThreaded {
-		m.RunThreadedTest()
-	}
 }
 
 // RunDetailedBenchmark tests memory latency with different block sizes
 func (m *MemTester) RunDetailedBenchmark() {
 	fmt.Println("\n==== Detailed Memory Latency Benchmarks ====")
 
-	// Test different memory block sizes to see effects of caching
-	sizes := []int{4 * 1024, 64 * 1024, 1024 * 1024, 8 * 1024 * 1024}
-
-	// Add large test if not skipped
-	if !m.Config.SkipLargeTests {
-		sizes = append(sizes, 64*1024*1024)
-	}
-
+	sizes := m.detailedSizes()
 	results := make([]float64, len(sizes))
 	labels := make([]string, len(sizes))
 
@@ -152,49 +166,14 @@ func (m *MemTester) RunDetailedBenchmark() {
 		elements := size / 8 // For int64
 		labels[i] = fmt.Sprintf("%d KB", size/1024)
 
-		// Create array of appropriate size
-		array := make([]int64, elements)
-
-		// Setup random access pattern
-		indices := rand.Perm(elements)
-		for i := 0; i < elements-1; i++ {
-			array[indices[i]] = int64(indices[i+1])
-		}
-		array[indices[elements-1]] = int64(indices[0])
-
-		// Warm up
-		j := int64(0)
-		for i := 0; i < 1000000 && i < elements*10; i++ {
-			j = array[j]
-		}
-
-		// Use volatile pointer to prevent optimization
-		if j < 0 {
-			fmt.Println(j)
-		}
-
-		// Number of iterations for measurement
-		iters := 10000000
-		if elements < 1000 {
-			iters = 100000000 // More iterations for smaller arrays
-		} else if elements > 1000000 {
-			iters = 1000000 // Fewer iterations for larger arrays
-		}
-
-		start := time.Now()
-		j = 0
-		for i := 0; i < iters; i++ {
-			j = array[j]
-		}
-		elapsed := time.Since(start)
-
-		if j < 0 {
-			fmt.Println(j)
+		// Random access pattern, warmed up with up to ten passes
+		result, ok := m.measure("chain/random", size, detailedIterations(elements), min(1000000, elements*10))
+		if ok {
+			m.chaseLatency[size] = result.NsPerOp()
 		}
 
-		avgLatency := float64(elapsed.Nanoseconds()) / float64(iters)
-		results[i] = avgLatency
-		fmt.Printf("Block size: %7d KB | Latency: %6.2f ns\n", size/1024, avgLatency)
+		results[i] = result.NsPerOp()
+		fmt.Printf("Block size: %7d KB | Latency: %6.2f ns%s%s\n", size/1024, results[i], result.Cycles(), result.Spread())
 	}
 
 	m.drawChart("Memory Latency by Block Size", results, labels, "ns")
@@ -203,54 +182,23 @@ func (m *MemTester) RunDetailedBenchmark() {
 // MeasureSequentialAccess compares sequential vs random memory access
 func (m *MemTester) MeasureSequentialAccess() {
 	fmt.Println("\n==== Sequential vs Random Access ====")
-	size := 64 * 1024 * 1024 // 64MB
-	elements := size / 8
-
-	array := make([]int64, elements)
-
-	// Sequential pattern
-	for i := 0; i < elements-1; i++ {
-		array[i] = int64(i + 1)
-	}
-	array[elements-1] = 0
-
-	// Random pattern
-	randomArray := make([]int64, elements)
-	indices := rand.Perm(elements)
-	for i := 0; i < elements-1; i++ {
-		randomArray[indices[i]] = int64(indices[i+1])
-	}
-	randomArray[indices[elements-1]] = int64(indices[0])
 
-	// Measure sequential access
-	j := int64(0)
-	iters := 10000000
-
-	start := time.Now()
-	for i := 0; i < iters; i++ {
-		j = array[j]
-	}
-	seqElapsed := time.Since(start)
-	if j < 0 {
-		fmt.Println(j)
-	}
-
-	// Measure random access
-	j = 0
-	start = time.Now()
-	for i := 0; i < iters; i++ {
-		j = randomArray[j]
+	// Both patterns are chains over the same number of elements, linked in
+	// ascending and in random order
+	seqResult, ok := m.measure("chain/forward", sequentialBytes, sequentialIterations, 0)
+	if !ok {
+		return
 	}
-	randElapsed := time.Since(start)
-	if j < 0 {
-		fmt.Println(j)
+	randResult, ok := m.measure("chain/random", sequentialBytes, sequentialIterations, 0)
+	if !ok {
+		return
 	}
 
-	seqLatency := float64(seqElapsed.Nanoseconds()) / float64(iters)
-	randLatency := float64(randElapsed.Nanoseconds()) / float64(iters)
+	seqLatency := seqResult.NsPerOp()
+	randLatency := randResult.NsPerOp()
 
-	fmt.Printf("Sequential access latency: %.2f ns\n", seqLatency)
-	fmt.Printf("Random access latency:    %.2f ns\n", randLatency)
+	fmt.Printf("Sequential access latency: %.2f ns%s%s\n", seqLatency, seqResult.Cycles(), seqResult.Spread())
+	fmt.Printf("Random access latency:    %.2f ns%s%s\n", randLatency, randResult.Cycles(), randResult.Spread())
 
 	// Draw chart for sequential vs random
 	m.drawChart("Access Pattern Comparison",
@@ -258,12 +206,11 @@ func (m *MemTester) MeasureSequentialAccess() {
 		[]string{"Sequential", "Random"}, "ns")
 
 	// Calculate memory bandwidth
-	bytesAccessed := iters * 8
-	seqBandwidth := float64(bytesAccessed) / (float64(seqElapsed.Nanoseconds()) / 1e9) / 1e9
-	randBandwidth := float64(bytesAccessed) / (float64(randElapsed.Nanoseconds()) / 1e9) / 1e9
+	seqBandwidth := seqResult.GBs()
+	randBandwidth := randResult.GBs()
 
-	fmt.Printf("Sequential bandwidth: %.2f GB/s\n", seqBandwidth)
-	fmt.Printf("Random bandwidth:    %.2f GB/s\n", randBandwidth)
+	fmt.Printf("Sequential bandwidth: %.2f GB/s%s\n", seqBandwidth, percentOfPeak(seqBandwidth))
+	fmt.Printf("Random bandwidth:    %.2f GB/s%s\n", randBandwidth, percentOfPeak(randBandwidth))
 
 	// Draw bandwidth chart
 	m.drawChart("Memory Bandwidth",
@@ -274,37 +221,39 @@ func (m *MemTester) MeasureSequentialAccess() {
 // RunThreadedTest runs multi-threaded memory tests
 func (m *MemTester) RunThreadedTest() {
 	fmt.Println("\n==== Multi-threaded Memory Latency Test ====")
-	fmt.Printf("Testing with 1-%d threads...\n", m.Config.Threads)
+	threadCounts := m.threadCounts()
+	if len(threadCounts) == 0 {
+		fmt.Println("No thread counts selected")
+		return
+	}
+	fmt.Printf("Testing with up to %d threads...\n", threadCounts[len(threadCounts)-1])
 
 	// Array to store results for different thread counts
-	results := make([]float64, m.Config.Threads)
-	labels := make([]string, m.Config.Threads)
+	results := make([]float64, len(threadCounts))
+	labels := make([]string, len(threadCounts))
+	clock := m.measurementTimer()
 
-	// Allocate array once to avoid repeated allocation
-	blockSize := 64 * 1024 * 1024 // 64MB per thread
-	if blockSize*m.Config.Threads > 1024*1024*1024 {
-		// Limit to 1GB total if too many threads
-		blockSize = 1024 * 1024 * 1024 / m.Config.Threads
-	}
-	elements := blockSize / 8
+	elements := m.threadBlockSize() / 8
 
 	// Test with increasing number of threads
-	for t := 1; t <= m.Config.Threads; t++ {
-		labels[t-1] = fmt.Sprintf("%d", t)
+	for n, t := range threadCounts {
+		labels[n] = fmt.Sprintf("%d", t)
 
-		var wg sync.WaitGroup
 		var mu sync.Mutex
 		totalLatency := 0.0
 
 		// Create arrays for each thread
 		arrays := make([][]int64, t)
+		buffers := make([]*alloc.Buffer, t)
 		for i := 0; i < t; i++ {
-			arrays[i] = make([]int64, elements)
-			indices := rand.Perm(elements)
-			for j := 0; j < elements-1; j++ {
-				arrays[i][indices[j]] = int64(indices[j+1])
+			arrays[i], buffers[i] = alloc.Make[int64](m.Config.Alloc, elements)
+			if err := m.linkChain(arrays[i]); err != nil {
+				fmt.Printf("Skipping multi-threaded test: %v\n", err)
+				for _, buffer := range buffers[:i+1] {
+					buffer.Free()
+				}
+				return
 			}
-			arrays[i][indices[elements-1]] = int64(indices[0])
 		}
 
 		// Warm up all arrays
@@ -318,51 +267,128 @@ func (m *MemTester) RunThreadedTest() {
 			}
 		}
 
-		start := time.Now()
+		start := clock.Now()
 
-		for i := 0; i < t; i++ {
-			wg.Add(1)
-			go func(threadID int) {
-				defer wg.Done()
+		runWorkers(t, func(threadID int) {
+			iters := m.Config.Iterations / t
+			if iters < 1000000 {
+				iters = 1000000
+			}
 
-				iters := m.Config.Iterations / t
-				if iters < 1000000 {
-					iters = 1000000
-				}
+			j := int64(0)
+			threadStart := clock.Now()
+
+			for k := 0; k < iters; k++ {
+				j = arrays[threadID][j]
+			}
 
-				j := int64(0)
-				threadStart := time.Now()
+			threadElapsed := clock.Since(threadStart)
+			latency := float64(threadElapsed.Nanoseconds()) / float64(iters)
 
-				for k := 0; k < iters; k++ {
-					j = arrays[threadID][j]
-				}
+			mu.Lock()
+			totalLatency += latency
+			mu.Unlock()
 
-				threadElapsed := time.Since(threadStart)
-				latency := float64(threadElapsed.Nanoseconds()) / float64(iters)
+			if j < 0 {
+				fmt.Println(j)
+			}
+		})
 
-				mu.Lock()
-				totalLatency += latency
-				mu.Unlock()
+		elapsed := clock.Since(start)
 
-				if j < 0 {
-					fmt.Println(j)
-				}
-			}(i)
+		for _, buffer := range buffers {
+			buffer.Free()
 		}
 
-		wg.Wait()
-		elapsed := time.Since(start)
-
 		avgLatency := totalLatency / float64(t)
-		results[t-1] = avgLatency
+		results[n] = avgLatency
 
-		fmt.Printf("%d thread(s): %.2f ns average latency (total elapsed: %v)\n",
-			t, avgLatency, elapsed)
+		fmt.Printf("%d thread(s): %.2f ns%s average latency (total elapsed: %v)\n",
+			t, avgLatency, m.cycles(avgLatency), elapsed)
 	}
 
 	m.drawChart("Multi-threaded Memory Latency", results, labels, "ns")
 }
 
+// blockSizes returns every block size of the detailed benchmark
+func (m *MemTester) blockSizes() []int {
+	// Test different memory block sizes to see effects of caching
+	sizes := []int{4 * 1024, 64 * 1024, 1024 * 1024, 8 * 1024 * 1024}
+
+	// Add large test if not skipped
+	if !m.Config.SkipLargeTests {
+		sizes = append(sizes, 64*1024*1024)
+	}
+	return sizes
+}
+
+// detailedSizes returns the selected block sizes of the detailed benchmark
+func (m *MemTester) detailedSizes() []int {
+	var selected []int
+	for _, size := range m.blockSizes() {
+		if m.selected(blockTestName(size)) {
+			selected = append(selected, size)
+		}
+	}
+	return selected
+}
+
+// threadCounts returns the selected thread counts of the multi-threaded test
+func (m *MemTester) threadCounts() []int {
+	var counts []int
+	for t := 1; t <= m.Config.Threads; t++ {
+		if m.selected(threadTestName(t)) {
+			counts = append(counts, t)
+		}
+	}
+	return counts
+}
+
+// detailedIterations returns the number of timed accesses of the detailed
+// benchmark for an array of the given number of elements
+func detailedIterations(elements int) int {
+	if elements < 1000 {
+		return 100000000 // More iterations for smaller arrays
+	} else if elements > 1000000 {
+		return 1000000 // Fewer iterations for larger arrays
+	}
+	return 10000000
+}
+
+// threadBlockSize returns the array size per thread of the multi-threaded
+// test, limited to 1GB in total
+func (m *MemTester) threadBlockSize() int {
+	blockSize := m.Config.ThreadBlockSize
+	if blockSize*m.Config.Threads > 1024*1024*1024 {
+		blockSize = 1024 * 1024 * 1024 / m.Config.Threads
+	}
+	return blockSize
+}
+
+// percentOfPeak formats a bandwidth as a share of the theoretical peak from
+// SMBIOS, or returns "" when the peak is unknown
+func percentOfPeak(bandwidthGBs float64) string {
+	peak := smbios.SystemPeakBandwidthGBs()
+	if peak == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%% of %.1f GB/s peak)", bandwidthGBs/peak*100, peak)
+}
+
+// runWorkers runs fn on the given number of goroutines, passing each its
+// thread ID, and waits for all of them to finish
+func runWorkers(threads int, fn func(threadID int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(threadID int) {
+			defer wg.Done()
+			fn(threadID)
+		}(i)
+	}
+	wg.Wait()
+}
+
 // ASCII chart rendering function
 func (m *MemTester) drawChart(title string, values []float64, labels []string, unit string) {
 	fmt.Printf("\n==== %s ====\n", title)
@@ -0,0 +1,47 @@
+package test1
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// thermalDir is where Linux exposes thermal zones
+const thermalDir = "/sys/class/thermal"
+
+// ThermalZone is one temperature sensor reading
+type ThermalZone struct {
+	Name    string  // zone type, e.g. "x86_pkg_temp"
+	Celsius float64 // current temperature
+}
+
+// ReadThermalZones reads all thermal zones below dir (normally
+// /sys/class/thermal). It returns nil when none are available.
+func ReadThermalZones(dir string) []ThermalZone {
+	paths, err := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(paths)
+
+	var zones []ThermalZone
+	for _, path := range paths {
+		temp, err := os.ReadFile(filepath.Join(path, "temp"))
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.Atoi(strings.TrimSpace(string(temp)))
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(path)
+		if kind, err := os.ReadFile(filepath.Join(path, "type")); err == nil {
+			name = strings.TrimSpace(string(kind))
+		}
+		zones = append(zones, ThermalZone{Name: name, Celsius: float64(milli) / 1000})
+	}
+	return zones
+}
@@ -0,0 +1,111 @@
+package test1
+
+import (
+	"app/pkg/chain"
+	"app/pkg/timer"
+	"app/pkg/workload"
+	"fmt"
+)
+
+// workloadParams returns the parameters of a workload over size bytes of
+// int64 nodes
+func (m *MemTester) workloadParams(size int) workload.Params {
+	return workload.Params{Size: size, NodeSize: 8, Alloc: m.Config.Alloc, Verify: m.Config.VerifyChains}
+}
+
+// measure creates the named workload over size bytes of int64 nodes and
+// runs it, see run
+func (m *MemTester) measure(name string, size, iterations, warmup int) (workload.Result, bool) {
+	w, err := workload.New(name, m.workloadParams(size))
+	if err != nil {
+		fmt.Printf("Skipping %s: %v\n", name, err)
+		return workload.Result{}, false
+	}
+	return m.run(w, iterations, warmup)
+}
+
+// run times a workload through the harness with the configured number of
+// repetitions, warning when the loop overhead dominates the result
+func (m *MemTester) run(w workload.Workload, iterations, warmup int) (workload.Result, bool) {
+	// The timer is set up first, since that also finds the frequency
+	clock := m.measurementTimer()
+	opts := workload.Options{
+		Warmup:      warmup,
+		Repetitions: m.Config.Repetitions,
+		Overhead:    m.measurementOverhead(),
+		Target:      m.Config.TargetTime,
+		Timer:       clock,
+		Frequency:   m.frequency,
+	}
+	result, err := workload.Measure(w, iterations, opts)
+	if err != nil {
+		fmt.Printf("Skipping %v\n", err)
+		return result, false
+	}
+	if warning := result.Warning(); warning != "" {
+		fmt.Println(warning)
+	}
+	return result, true
+}
+
+// measurementOverhead measures the loop and RNG baselines once and prints
+// them, since every latency result has them subtracted
+func (m *MemTester) measurementOverhead() *workload.Overhead {
+	if m.overhead == nil {
+		overhead := workload.MeasureOverhead(m.measurementTimer())
+		m.overhead = &overhead
+		fmt.Printf("Measurement overhead: %s (loop overhead subtracted from independent-load latencies)\n", overhead)
+	}
+	return m.overhead
+}
+
+// measurementTimer sets up the configured timer and finds the core
+// frequency once, printing both with the timer's resolution and overhead
+func (m *MemTester) measurementTimer() *timer.Timer {
+	if m.clock != nil {
+		return m.clock
+	}
+	clock, err := timer.New(m.Config.Timer)
+	if err != nil {
+		fmt.Printf("Timer %v, using the monotonic clock\n", err)
+		clock = timer.NewMonotonic()
+	}
+	m.clock = clock
+	fmt.Printf("Timer: %s, %s\n", clock, clock.Calibrate())
+
+	if frequency, err := timer.CoreFrequency(m.Config.FrequencySource); err != nil {
+		fmt.Printf("Core frequency unknown (%v), latencies are reported in ns only\n", err)
+	} else {
+		m.frequency = &frequency
+		fmt.Printf("Core frequency: %s\n", frequency)
+	}
+	return clock
+}
+
+// cycles describes ns in core cycles, e.g. " (251.3 cycles)" or
+// " (12.6M cycles)", and is empty when the core frequency is unknown
+func (m *MemTester) cycles(ns float64) string {
+	if m.frequency == nil {
+		return ""
+	}
+	cycles := m.frequency.Cycles(ns)
+	if cycles >= 1e6 {
+		return fmt.Sprintf(" (%.1fM cycles)", cycles/1e6)
+	}
+	return fmt.Sprintf(" (%.1f cycles)", cycles)
+}
+
+// linkChain links the elements of array into a single random cycle of
+// indices, checking it first when Config.VerifyChains is set
+func (m *MemTester) linkChain(array []int64) error {
+	next := chain.Sattolo(len(array))
+	if m.Config.VerifyChains {
+		if err := chain.Validate(next); err != nil {
+			return err
+		}
+	}
+	for i, n := range next {
+		array[i] = int64(n)
+	}
+	return nil
+}
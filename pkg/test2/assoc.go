@@ -0,0 +1,203 @@
+package test2
+
+import (
+	"app/pkg/alloc"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// maxWays is the highest associativity the conflict test looks for
+const maxWays = 32
+
+// CacheAssociativity holds the number of ways detected for each cache level.
+// A value of 0 means the level could not be measured.
+type CacheAssociativity struct {
+	L1 int
+	L2 int
+	L3 int
+}
+
+// DetectAssociativity estimates the associativity of each cache level by
+// chasing through lines that all map to the same cache set and finding how
+// many of them fit before adding one more line causes conflict misses.
+// The results are cross-checked against sysfs when it is available.
+func (m *MemTester) DetectAssociativity(cacheSizes CacheSizes) CacheAssociativity {
+	fmt.Println("\n==== Cache Associativity Detection ====")
+	fmt.Println("Chasing lines that map to the same cache set to find the number of ways...")
+
+	levels := []struct {
+		name string
+		size int
+	}{
+		{"L1", cacheSizes.L1},
+		{"L2", cacheSizes.L2},
+		{"L3", cacheSizes.L3},
+	}
+
+	// Every level is measured on its own stride, which conflicts in the
+	// lower levels too, so their steps are passed on to be told apart. A
+	// level may have fewer ways than the one below it.
+	detected := make([]int, len(levels))
+	lower := make(map[int]float64)
+	known, _ := m.knownCacheSizes()
+	for i, level := range levels {
+		stride := conflictStride(level.size)
+		if i < len(known) && known[i] > 0 {
+			stride = known[i]
+		}
+		ways, rise := m.measureWays(level.name, stride, lower)
+		detected[i] = ways
+		if ways > 0 {
+			lower[ways] = max(lower[ways], rise)
+		}
+	}
+
+	result := CacheAssociativity{L1: detected[0], L2: detected[1], L3: detected[2]}
+
+	fmt.Println("\n==== Cache Associativity Results ====")
+	knownWays, source := m.knownCacheWays()
+	for i, level := range levels {
+		line := fmt.Sprintf("%s Cache: ", level.name)
+		if detected[i] == 0 {
+			line += "not detected"
+		} else {
+			line += fmt.Sprintf("%d-way", detected[i])
+		}
+
+		if i < len(knownWays) && knownWays[i] > 0 {
+			ways := knownWays[i]
+			if detected[i] == 0 {
+				line += fmt.Sprintf(" (%s: %d-way)", source, ways)
+			} else if detected[i] == ways {
+				line += fmt.Sprintf(" (%s: %d-way, matches)", source, ways)
+			} else {
+				line += fmt.Sprintf(" (%s: %d-way, MISMATCH)", source, ways)
+			}
+		}
+		fmt.Println(line)
+	}
+	fmt.Println("Note: physically indexed and sliced caches (usually L2/L3) may not show clean conflicts,")
+	fmt.Println("and large strides also fill one TLB set, whose step can be taken for the cache's.")
+
+	return result
+}
+
+// knownCacheWays returns the ways of each data cache level that sysfs
+// reports or, for a simulated CPU, the configured ones, 0 where unknown
+func (m *MemTester) knownCacheWays() ([]int, string) {
+	if sim := m.Config.Simulate; sim != nil {
+		ways := make([]int, len(sim.Caches))
+		for i, c := range sim.Caches {
+			ways[i] = c.Ways
+		}
+		return ways, "simulated"
+	}
+	caches := ReadSysfsCaches(sysfsCacheDir)
+	var ways []int
+	for level := 1; level <= maxCacheLevels; level++ {
+		c, _ := sysfsDataCache(caches, level)
+		ways = append(ways, c.Ways)
+	}
+	return ways, "sysfs"
+}
+
+// conflictStride returns a stride that maps lines of a cache of the
+// measured size to one set: a multiple of its way size, the number of sets
+// times the line size. The size from sysfs or a simulated CPU is one, as
+// the way size times the number of ways, and is used when known. A
+// measured size sits on the grid of the latency curve and usually is not,
+// so it is rounded up to a power of two, at least a page: the number of
+// sets and the line size are powers of two, so a power of two no smaller
+// than the cache is a multiple of its way size.
+func conflictStride(size int) int {
+	if size <= 0 {
+		return 0
+	}
+	stride := os.Getpagesize()
+	for stride < size {
+		stride *= 2
+	}
+	return stride
+}
+
+// measureWays measures the latency of chasing 1..maxWays+1 lines spaced by
+// stride bytes, a multiple of every candidate way size (see
+// conflictStride) so all lines fall into one set, and returns the number
+// of ways with the latency rise of the step past them. Lower levels
+// conflict too: lower maps the ways of each lower level to the rise of its
+// own step, and a step at the same number of lines is only taken for this
+// level when it rises clearly more than the lower level's step alone, as
+// when both run out of ways at once.
+func (m *MemTester) measureWays(name string, stride int, lower map[int]float64) (int, float64) {
+	if stride <= 0 {
+		return 0, 0
+	}
+
+	// Keep the (mostly untouched) buffer within the configured test size
+	maxLines := maxWays + 1
+	if budget := m.Config.SizeInMB * 1024 * 1024 / stride; budget < maxLines {
+		maxLines = budget
+	}
+	if maxLines <= 2 {
+		fmt.Printf("%s: skipped, %s stride needs more than %d MB\n", name, formatSize(stride), m.Config.SizeInMB)
+		return 0, 0
+	}
+
+	buffer, allocation := alloc.Make[int64](m.Config.Alloc, maxLines*stride/8)
+	defer allocation.Free()
+
+	latencies := make([]float64, maxLines+1)
+	for lines := 1; lines <= maxLines; lines++ {
+		// Warm up so every line has been touched at least once
+		order := make([]int, lines)
+		for i := range order {
+			order[i] = i * stride / 8
+		}
+		w := &orderChain{name: fmt.Sprintf("conflict/%d-lines", lines), buffer: buffer, order: order}
+		result, err := m.measureWorkload(w, m.Config.Iterations, m.measureOptions(lines*100))
+		if err != nil {
+			fmt.Printf("%s: skipped, %v\n", name, err)
+			return 0, 0
+		}
+		latencies[lines] = result.NsPerOp()
+	}
+
+	ways, rise := 0, 0.0
+	for lines := 2; lines <= maxLines; lines++ {
+		// The step must hold for two consecutive points and is compared to
+		// the median of the points before it, so single noisy samples are
+		// not mistaken for a conflict miss
+		before := median3(latencies[max(1, lines-3):lines])
+		after := min(latencies[lines], latencies[min(maxLines, lines+1)])
+		if after <= before*1.3 {
+			continue
+		}
+		// Right after a lower level's step the median still holds points
+		// before it, so the step is only taken where it starts
+		if latencies[lines-1] > before*1.3 {
+			continue
+		}
+		if lowerRise, ok := lower[lines-1]; ok && after/before <= lowerRise*1.3 {
+			continue
+		}
+		ways, rise = lines-1, after/before
+		break
+	}
+
+	fmt.Printf("%s (%s stride): ", name, formatSize(stride))
+	if ways == 0 {
+		fmt.Println("no conflict miss step found")
+	} else {
+		fmt.Printf("%.2f ns with %d lines, %.2f ns with %d lines\n",
+			latencies[ways], ways, latencies[ways+1], ways+1)
+	}
+	return ways, rise
+}
+
+// median3 returns the median of up to three values
+func median3(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,285 @@
+package test2
+
+import (
+	"app/pkg/changepoint"
+	"app/pkg/workload"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Parameters of the latency curve cache size detection
+const (
+	cacheCurveMinSize     = 4 * 1024 // smallest working set of the curve
+	cacheCurveSteps       = 8        // working sets per doubling of the size
+	cacheCurveMinLength   = 3        // curve points per fitted segment
+	cacheCurveNoise       = 0.02     // relative latency changes always treated as noise
+	cacheFlatSlope        = 0.15     // latency growth per doubling of a plateau, as log2 of the ratio
+	cacheLevelStep        = 1.15     // latency ratio between two plateaus of different levels
+	maxCacheLevels        = 8        // cache levels and main memory the curve is fitted for
+	cacheCurveRepetitions = 3        // timed runs per working set at least
+)
+
+// CachePoint is the latency of one working set size
+type CachePoint struct {
+	Size      int
+	LatencyNs float64
+}
+
+// CacheLevel is one level of the memory hierarchy found on the curve
+type CacheLevel struct {
+	Name       string  // "L1" to "Ln" for caches, "Memory" for main memory
+	Size       int     // largest working set served at this level's latency, 0 for memory
+	LatencyNs  float64 // median latency of the level's plateau
+	Confidence float64 // probability that the latency really changes where the level ends, 0 to 1
+}
+
+// CacheDetection is the structured result of DetectCacheLevels
+type CacheDetection struct {
+	Curve  []CachePoint
+	Levels []CacheLevel // caches from the smallest, then main memory when the curve reached it
+}
+
+// DetectCacheLevels measures the load latency of working sets from 4KB up
+// to Config.CacheMaxMB, eight sizes per doubling, and finds the cache
+// levels on that curve. Each level is a plateau of the latency, so the
+// curve is segmented into lines of log latency over log size with
+// changepoint.Fit, and every flat segment, or run of flat segments at
+// about the same latency, is one level.
+//
+// The walk visits the lines within each page in random order, and the pages
+// in random order within windows of 32 that follow each other. Neither the
+// line nor the next page prefetchers can follow it, but every page is used
+// 64 times in a row and the pages in use fit the TLB, so the limited reach
+// of the TLBs does not add steps of its own to the curve.
+func (m *MemTester) DetectCacheLevels() CacheDetection {
+	var detection CacheDetection
+	for _, size := range m.cacheCurveSizes() {
+		w, err := workload.New("chain/page-window", m.workloadParams(size))
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", formatSize(size), err)
+			continue
+		}
+		// Warm up with a whole pass over the working set, so caches larger
+		// than the timed loads reach are filled too. A single short run of
+		// a small working set is easily disturbed, so the median of at
+		// least three is used. Overhead warnings would repeat for every
+		// size and are left out.
+		nodes := size / m.cacheLineSize()
+		opts := m.measureOptions(nodes)
+		opts.Repetitions = max(opts.Repetitions, cacheCurveRepetitions)
+		result, err := m.measureWorkload(w, m.Config.Iterations, opts)
+		if err != nil {
+			fmt.Printf("Skipping %v\n", err)
+			continue
+		}
+		detection.Curve = append(detection.Curve, CachePoint{Size: size, LatencyNs: result.NsPerOp()})
+	}
+	detection.Levels = findCacheLevels(detection.Curve)
+	return detection
+}
+
+// cacheCurveSizes returns the working sets of the latency curve, whole
+// cache lines from 4KB to Config.CacheMaxMB
+func (m *MemTester) cacheCurveSizes() []int {
+	lineSize := m.cacheLineSize()
+	maxSize := max(cacheCurveMinSize, m.Config.CacheMaxMB*1024*1024)
+
+	var sizes []int
+	for step := 0; ; step++ {
+		size := int(cacheCurveMinSize*math.Pow(2, float64(step)/cacheCurveSteps)) / lineSize * lineSize
+		if size > maxSize {
+			return sizes
+		}
+		if len(sizes) == 0 || size > sizes[len(sizes)-1] {
+			sizes = append(sizes, size)
+		}
+	}
+}
+
+// findCacheLevels finds the plateaus of a latency curve. The last plateau
+// is main memory unless the latency rises above it later on the curve;
+// then every plateau is a cache.
+func findCacheLevels(curve []CachePoint) []CacheLevel {
+	x := make([]float64, len(curve))
+	y := make([]float64, len(curve))
+	for i, p := range curve {
+		x[i] = math.Log2(float64(p.Size))
+		y[i] = math.Log2(max(p.LatencyNs, 0.01))
+	}
+	segments := changepoint.Fit(x, y, changepoint.Options{
+		MinLength:   cacheCurveMinLength,
+		MaxSegments: 2 * maxCacheLevels,
+		Noise:       max(changepoint.NoiseLevel(y), math.Log2(1+cacheCurveNoise)),
+	})
+
+	// A plateau is a run of flat segments, possibly with short bumps in
+	// between, whose latencies differ by less than a level step
+	type plateau struct {
+		start, end int     // curve points
+		last       int     // segment whose end is the plateau's end
+		level      float64 // log2 latency of its first segment
+	}
+	var plateaus []plateau
+	for i, s := range segments {
+		if math.Abs(s.Slope) > cacheFlatSlope {
+			continue
+		}
+		level := s.Mean(x)
+		if n := len(plateaus); n > 0 && math.Abs(level-plateaus[n-1].level) < math.Log2(cacheLevelStep) {
+			plateaus[n-1].end, plateaus[n-1].last = s.End, i
+			continue
+		}
+		plateaus = append(plateaus, plateau{start: s.Start, end: s.End, last: i, level: level})
+	}
+
+	// A level holds at least half a doubling of working sets; shorter
+	// flat stretches are pauses on the way up from one level to the next
+	kept := plateaus[:0]
+	for _, p := range plateaus {
+		if p.end-p.start+1 >= cacheCurveSteps/2 {
+			kept = append(kept, p)
+		}
+	}
+	plateaus = kept
+
+	// On a sharp step the fit may end a plateau a point or two early; the
+	// points after it that are still at its latency belong to it
+	for i := range plateaus {
+		p := &plateaus[i]
+		for p.end+1 < len(y) && y[p.end+1]-p.level < math.Log2(cacheCurveNoise+1) {
+			p.end++
+		}
+	}
+
+	var levels []CacheLevel
+	for i, p := range plateaus {
+		level := CacheLevel{
+			Name:       fmt.Sprintf("L%d", i+1),
+			Size:       curve[p.end].Size,
+			LatencyNs:  medianLatency(curve[p.start : p.end+1]),
+			Confidence: segments[p.last].EndConfidence,
+		}
+		if i == len(plateaus)-1 && !risesAfter(y[p.end+1:], p.level) {
+			// Main memory has no end on the curve, so its confidence is
+			// that of the step up to it
+			level.Name, level.Size = "Memory", 0
+			if i > 0 {
+				level.Confidence = levels[i-1].Confidence
+			}
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// risesAfter reports whether any of the log2 latencies y is a level step
+// above level
+func risesAfter(y []float64, level float64) bool {
+	for _, v := range y {
+		if v-level >= math.Log2(cacheLevelStep) {
+			return true
+		}
+	}
+	return false
+}
+
+// medianLatency returns the median latency of curve points
+func medianLatency(points []CachePoint) float64 {
+	latencies := make([]float64, len(points))
+	for i, p := range points {
+		latencies[i] = p.LatencyNs
+	}
+	sort.Float64s(latencies)
+	return latencies[len(latencies)/2]
+}
+
+// Caches returns the cache levels without main memory
+func (d CacheDetection) Caches() []CacheLevel {
+	var caches []CacheLevel
+	for _, level := range d.Levels {
+		if level.Size > 0 {
+			caches = append(caches, level)
+		}
+	}
+	return caches
+}
+
+// CacheSizes returns the first three detected cache sizes, taking the
+// sizes of levels that were not found from fallback
+func (d CacheDetection) CacheSizes(fallback CacheSizes) CacheSizes {
+	sizes := fallback
+	for i, level := range d.Caches() {
+		switch i {
+		case 0:
+			sizes.L1 = level.Size
+		case 1:
+			sizes.L2 = level.Size
+		case 2:
+			sizes.L3 = level.Size
+		}
+	}
+	return sizes
+}
+
+// EstimateCacheSizes detects the cache levels on a latency curve, prints
+// them and returns the L1, L2 and L3 sizes for the other cache tests.
+// Levels that were not found keep their typical sizes.
+func (m *MemTester) EstimateCacheSizes() CacheSizes {
+	fmt.Println("\n==== Cache Size Estimation ====")
+	fmt.Printf("Measuring load latency from %s to %s, %d sizes per doubling...\n",
+		formatSize(cacheCurveMinSize), formatSize(m.Config.CacheMaxMB*1024*1024), cacheCurveSteps)
+
+	detection := m.DetectCacheLevels()
+	m.PrintCacheDetection(detection)
+	return detection.CacheSizes(defaultCacheSizes)
+}
+
+// PrintCacheDetection prints the latency curve at every doubling of the
+// size and the levels found on it, next to the sizes sysfs reports or,
+// for a simulated CPU, the configured ones
+func (m *MemTester) PrintCacheDetection(d CacheDetection) {
+	for i, p := range d.Curve {
+		if i%cacheCurveSteps == 0 || i == len(d.Curve)-1 {
+			fmt.Printf("Working set: %9s, Latency: %7.2f ns\n", formatSize(p.Size), p.LatencyNs)
+		}
+	}
+
+	known, source := m.knownCacheSizes()
+	fmt.Println("\n==== Cache Size Detection Results ====")
+	fmt.Printf("%-8s %10s %10s %11s %10s\n", "Level", "Size", "Latency", "Confidence", source)
+	for i, level := range d.Levels {
+		size, reference := "-", "-"
+		if level.Size > 0 {
+			size = formatSize(level.Size)
+			if i < len(known) && known[i] > 0 {
+				reference = formatSize(known[i])
+			}
+		}
+		fmt.Printf("%-8s %10s %7.2f ns %10.0f%% %10s\n", level.Name, size, level.LatencyNs, 100*level.Confidence, reference)
+	}
+	if n := len(d.Levels); n == 0 || d.Levels[n-1].Size > 0 {
+		fmt.Println("Latency is still rising at the largest working set; increase -cache-max to reach main memory.")
+	}
+	fmt.Println("Note: sizes are the largest working sets still served at each level's latency.")
+}
+
+// knownCacheSizes returns the data cache sizes from L1 up that the
+// detection is compared with, 0 for levels sysfs does not list, and where
+// they come from
+func (m *MemTester) knownCacheSizes() ([]int, string) {
+	if sim := m.Config.Simulate; sim != nil {
+		sizes := make([]int, len(sim.Caches))
+		for i, c := range sim.Caches {
+			sizes[i] = c.Size
+		}
+		return sizes, "simulated"
+	}
+	caches := ReadSysfsCaches(sysfsCacheDir)
+	var sizes []int
+	for level := 1; level <= maxCacheLevels; level++ {
+		c, _ := sysfsDataCache(caches, level)
+		sizes = append(sizes, c.Size)
+	}
+	return sizes, "sysfs"
+}
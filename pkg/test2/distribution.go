@@ -0,0 +1,88 @@
+package test2
+
+import (
+	"app/pkg/workload"
+	"fmt"
+	"strings"
+)
+
+// Layout of the printed latency histogram
+const (
+	distributionRows     = 24
+	distributionBarWidth = 50
+)
+
+// SampleLatencyDistribution chases pointers through a -size buffer like
+// PointerChasingTest, but times Config.SampleBatch dependent loads at a
+// time with the measurement timer. As many loads as Config.Iterations are
+// sampled. It returns false when the workload cannot be set up.
+func (m *MemTester) SampleLatencyDistribution() (workload.Distribution, bool) {
+	name := "pointer-chase"
+	w, err := workload.New(name, m.workloadParams(m.Config.SizeInMB*1024*1024))
+	if err != nil {
+		fmt.Printf("Skipping %s: %v\n", name, err)
+		return workload.Distribution{}, false
+	}
+
+	// The timer is set up first, since that also finds the frequency
+	clock := m.measurementTimer()
+	batch := max(1, m.Config.SampleBatch)
+	d, err := workload.Sample(w, workload.SampleOptions{
+		Warmup:    1000,
+		Batch:     batch,
+		Samples:   max(1, m.Config.Iterations/batch),
+		Timer:     clock,
+		Frequency: m.frequency,
+	})
+	if err != nil {
+		fmt.Printf("Skipping %v\n", err)
+		return d, false
+	}
+	return d, true
+}
+
+// PrintLatencyDistribution prints the percentiles of a distribution and
+// its histogram, one row per range of latencies
+func (m *MemTester) PrintLatencyDistribution(d workload.Distribution) {
+	fmt.Println("\n==== Latency Distribution ====")
+	fmt.Printf("Buffer: %s, %d samples of %d dependent loads, timing overhead %.2f ns per sample subtracted\n",
+		formatSize(d.Info.WorkingSet), d.Samples, d.Batch, d.OverheadNs)
+
+	fmt.Printf("%-8s %10s %10s\n", "", "ns/load", "cycles")
+	row := func(label string, ns, cycles float64) {
+		if cycles > 0 {
+			fmt.Printf("%-8s %10.2f %10.1f\n", label, ns, cycles)
+		} else {
+			fmt.Printf("%-8s %10.2f %10s\n", label, ns, "-")
+		}
+	}
+	row("mean", d.MeanNs(), d.Cycles(d.MeanNs()))
+	for _, p := range d.Percentiles() {
+		row(fmt.Sprintf("p%g", p.P), p.Ns, p.Cycles)
+	}
+	row("max", d.MaxNs(), d.Cycles(d.MaxNs()))
+
+	// Rare outliers, e.g. interrupts or samples shorter than the timer's
+	// resolution, would squeeze the rest into a few rows. Everything below
+	// p0.1 or a tenth of the median shares the first row, and everything
+	// above p99.9 the last.
+	h := d.Histogram
+	low := max(h.ValueAt(0.001), h.ValueAt(0.5)/10)
+	buckets := h.Coarsen(distributionRows, low, h.ValueAt(0.999)+1)
+	peak := uint64(0)
+	for _, b := range buckets {
+		peak = max(peak, b.Count)
+	}
+	fmt.Println()
+	for _, b := range buckets {
+		bar := 0
+		if peak > 0 {
+			bar = int(b.Count * distributionBarWidth / peak)
+		}
+		if b.Count > 0 {
+			bar = max(bar, 1)
+		}
+		fmt.Printf("%9.2f-%-9.2f ns |%-*s %7.3f%%\n", float64(b.Low)/1000, float64(b.High)/1000,
+			distributionBarWidth, strings.Repeat("#", bar), 100*float64(b.Count)/float64(d.Samples))
+	}
+}
@@ -0,0 +1,98 @@
+package test2
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/chain"
+	"app/pkg/timer"
+	"fmt"
+	"unsafe"
+)
+
+// defaultLineSize is assumed until the line size has been detected
+const defaultLineSize = 64
+
+// nodeSize is the size of a Node in bytes
+const nodeSize = int(unsafe.Sizeof(Node{}))
+
+// lineProbeBlock is the block size the line size probe visits in random
+// order; it must be larger than the biggest stride tested
+const lineProbeBlock = 1024
+
+// DetectLineSize measures the cost of reading at strides from 4 to 512
+// bytes. Blocks are visited in random order and each block is read at
+// offset 0 and then at offset stride through a dependent load, so the
+// second read is almost free while it falls into the same cache line and
+// costs a full miss once it does not. The smallest stride at which the
+// cost jumps is the line size. The result is used for node spacing and
+// strides in all later tests unless Config.LineSize is set.
+func (m *MemTester) DetectLineSize() int {
+	fmt.Println("\n==== Cache Line Size Detection ====")
+
+	// Use the full test size so every new block comes from memory
+	buffer, allocation := alloc.Make[uint32](m.Config.Alloc, m.Config.SizeInMB*1024*1024/4)
+	defer allocation.Free()
+	blocks := len(buffer) * 4 / lineProbeBlock
+
+	strides := []int{4, 8, 16, 32, 64, 128, 256, 512}
+	costs := make([]float64, len(strides))
+	for i, stride := range strides {
+		costs[i] = strideReadCost(m.measurementTimer(), buffer, blocks, stride, m.Config.Iterations)
+		fmt.Printf("Stride: %4d B | Cost per read: %6.2f ns\n", stride, costs[i])
+	}
+
+	// Reads within one line cost about the same as the smallest stride
+	lineSize := defaultLineSize
+	for i := 1; i < len(strides); i++ {
+		if costs[i] > costs[0]*1.4 {
+			lineSize = strides[i]
+			break
+		}
+	}
+
+	fmt.Printf("Detected cache line size: %d bytes", lineSize)
+	if c, ok := sysfsDataCache(ReadSysfsCaches(sysfsCacheDir), 1); ok && c.LineSize > 0 {
+		fmt.Printf(" (sysfs: %d bytes)", c.LineSize)
+	}
+	fmt.Println()
+
+	m.lineSize = lineSize
+	return lineSize
+}
+
+// strideReadCost links the blocks into one random cycle, reading each at
+// offset 0 and offset stride, and returns the average time of one read
+func strideReadCost(clock *timer.Timer, buffer []uint32, blocks, stride, iterations int) float64 {
+	perBlock := lineProbeBlock / 4
+	offset := stride / 4
+
+	for block, next := range chain.Sattolo(blocks) {
+		first := block * perBlock
+		buffer[first] = uint32(first + offset)
+		buffer[first+offset] = uint32(next * perBlock)
+	}
+
+	j := uint32(0)
+	start := clock.Now()
+	for i := 0; i < iterations; i++ {
+		j = buffer[j]
+	}
+	elapsed := clock.Since(start)
+
+	// Prevent optimization
+	if j == ^uint32(0) {
+		fmt.Println(j)
+	}
+
+	return float64(elapsed.Nanoseconds()) / float64(iterations)
+}
+
+// cacheLineSize returns the configured or detected line size
+func (m *MemTester) cacheLineSize() int {
+	if m.Config.LineSize > 0 {
+		return m.Config.LineSize
+	}
+	if m.lineSize > 0 {
+		return m.lineSize
+	}
+	return defaultLineSize
+}
@@ -2,38 +2,77 @@
 package test2
 
 import (
+	"app/pkg/alloc"
+	"app/pkg/edac"
+	"app/pkg/memsim"
+	"app/pkg/selector"
+	"app/pkg/skew"
+	"app/pkg/smbios"
+	"app/pkg/sysmem"
+	"app/pkg/timer"
+	"app/pkg/workload"
 	"fmt"
-	"math/rand"
 	"runtime"
 	"time"
-	"unsafe"
 )
 
 // Config holds all configuration parameters for memory tests
 type Config struct {
-	SizeInMB      int
-	Iterations    int
-	RunBasicTests bool
-	RunAdvanced   bool
-	RunCacheTests bool
+	SizeInMB        int
+	Iterations      int
+	RunBasicTests   bool
+	RunAdvanced     bool
+	RunCacheTests   bool
+	RunAssocTest    bool
+	RunPrefetch     bool
+	RunRuntime      bool
+	RunWorkloads    bool
+	RunDistribution bool
+	RunSkew         bool
+	SkewPatterns    []skew.Spec      // access distributions the skew analysis compares
+	SampleBatch     int              // dependent loads timed together by the latency distribution
+	Repetitions     int              // timed runs per measurement, the median is reported
+	TargetTime      time.Duration    // when > 0, iterations grow until each timed run takes this long
+	VerifyChains    bool             // check every pointer chain is one cycle before timing it
+	Timer           timer.Kind       // clock measurements are timed with
+	FrequencySource string           // timer.FrequencyMeasured or timer.FrequencySysfs, for cycle counts
+	LineSize        int              // cache line size in bytes, 0 to detect it
+	CacheMaxMB      int              // largest working set of the cache size detection
+	Alloc           alloc.Strategy   // how test buffers are allocated
+	Simulate        *memsim.Config   // simulated CPU to run the detection tests on, nil for the real one
+	Filter          *selector.Filter // -run and -skip patterns, nil runs every test
+	OnLowMemory     string           // sysmem.LowMemoryRefuse, LowMemoryScale or LowMemoryWarn
 }
 
 // NewDefaultConfig creates a Config with sensible defaults
 func NewDefaultConfig() *Config {
 	return &Config{
-		SizeInMB:      256, // 256 MB default memory test size
-		Iterations:    1000000,
-		RunBasicTests: true,
-		RunAdvanced:   true,
-		RunCacheTests: true,
+		SizeInMB:        256, // 256 MB default memory test size
+		Iterations:      1000000,
+		RunBasicTests:   true,
+		RunAdvanced:     true,
+		RunCacheTests:   true,
+		RunAssocTest:    false,
+		RunPrefetch:     true,
+		RunRuntime:      false,
+		RunWorkloads:    false,
+		RunDistribution: false,
+		RunSkew:         false,
+		SkewPatterns:    skew.Sweep,
+		SampleBatch:     8,
+		CacheMaxMB:      256,
+		Repetitions:     1,
+		Timer:           timer.Auto,
+		FrequencySource: timer.FrequencyMeasured,
+		Alloc:           alloc.Heap,
+		OnLowMemory:     sysmem.LowMemoryScale,
 	}
 }
 
-// Node represents a node in a linked list for pointer chasing
-type Node struct {
-	Next  *Node
-	Dummy [56]byte // padding to make Node size 64 bytes (cache line size)
-}
+// Node is the linked list node of the pointer-chase workload, which
+// places nodes Params.NodeSize bytes apart, the cache line size, so that
+// each one occupies its own line
+type Node = workload.Node
 
 // CacheSizes represents the typical cache sizes for different levels
 type CacheSizes struct {
@@ -42,9 +81,24 @@ type CacheSizes struct {
 	L3 int
 }
 
+// defaultCacheSizes are typical cache sizes, used when they cannot be measured
+var defaultCacheSizes = CacheSizes{
+	L1: 32 * 1024,       // 32KB L1
+	L2: 256 * 1024,      // 256KB L2
+	L3: 8 * 1024 * 1024, // 8MB L3
+}
+
+// cacheLatencyIterations is the number of timed loads per cache latency test
+const cacheLatencyIterations = 1000000
+
 // MemTester is the main struct for memory testing
 type MemTester struct {
-	Config *Config
+	Config    *Config
+	lineSize  int                // detected cache line size, 0 until detected
+	overhead  *workload.Overhead // measured on first use, see measurementOverhead
+	clock     *timer.Timer       // set up on first use, see measurementTimer
+	frequency *timer.Frequency   // core frequency, nil when unknown
+	skipped   map[string]bool    // tests CheckMemory left out, by step name
 }
 
 // NewMemTester creates a new memory tester with the given configuration
@@ -63,97 +117,113 @@ func (m *MemTester) PrintSystemInfo() {
 	fmt.Printf("Architecture: %s\n", runtime.GOARCH)
 	fmt.Printf("CPU Cores: %d\n", runtime.NumCPU())
 	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	smbios.PrintInventory()
 	fmt.Println()
 }
 
-// RunAll executes all memory tests based on the configuration
+// RunAll executes all memory tests based on the configuration that
+// Config.Filter selects. ECC error counters are checked around every test
+// when EDAC is available. With Config.Simulate set it runs RunSimulation
+// instead.
 func (m *MemTester) RunAll() {
+	if m.Config.Simulate != nil {
+		m.RunSimulation()
+		return
+	}
 	fmt.Println("Memory Latency and Cache Test Suite")
 	m.PrintSystemInfo()
 
+	if m.Config.LineSize == 0 && m.selected(lineSizeTestName) && !m.skipped[lineSizeStep] {
+		m.DetectLineSize()
+	}
+
 	if m.Config.RunBasicTests {
-		m.RandomAccessTest()
-		m.SequentialAccessTest()
-		m.PointerChasingTest()
+		if m.selected(m.randomTestName()) {
+			m.runStep("Random Access Test", m.RandomAccessTest)
+		}
+		if m.selected(m.sequentialTestName()) {
+			m.runStep("Sequential Access Test", m.SequentialAccessTest)
+		}
+		if m.selected(m.pointerChaseTestName()) {
+			m.runStep("Pointer Chasing Test", m.PointerChasingTest)
+		}
 	}
 
-	if m.Config.RunAdvanced {
-		m.AdvancedLatencyTest(m.Config.SizeInMB)
+	if m.Config.RunDistribution && m.selected(m.distributionTestName()) {
+		m.runStep("Latency Distribution", func() {
+			if d, ok := m.SampleLatencyDistribution(); ok {
+				m.PrintLatencyDistribution(d)
+			}
+		})
 	}
 
-	if m.Config.RunCacheTests {
-		cacheSizes := m.EstimateCacheSizes()
-		m.RunCacheTests(cacheSizes)
+	if m.Config.RunAdvanced && m.selected(m.advancedTestName()) {
+		m.runStep("Advanced Latency Test", func() { m.AdvancedLatencyTest(m.Config.SizeInMB) })
 	}
-}
 
-// RandomAccessTest measures latency for random memory access
-func (m *MemTester) RandomAccessTest() {
-	// Create a large array
-	data := make([]int64, m.Config.SizeInMB*1024*1024/8)
+	if m.Config.RunPrefetch && m.selected(prefetchGroup) {
+		m.runStep("Prefetcher Analysis", func() { m.PrintPrefetchReport(m.AnalyzePrefetchers()) })
+	}
 
-	// Fill with some values
-	for i := range data {
-		data[i] = int64(i)
+	if m.Config.RunCacheTests && m.selected(cacheGroup) {
+		// Without the estimation the other cache tests use the sysfs sizes
+		cacheSizes := m.expectedCacheSizes()
+		if m.selected(cacheSizesTestName) {
+			m.runStep("Cache Size Estimation", func() { cacheSizes = m.EstimateCacheSizes() })
+		}
+		m.runStep("Cache Performance Tests", func() { m.RunCacheTests(cacheSizes) })
+		if m.Config.RunAssocTest && m.selected(assocTestName) {
+			m.runStep("Associativity Detection", func() { m.DetectAssociativity(cacheSizes) })
+		}
 	}
 
-	// Random access
-	fmt.Println("\nRandom Access Test:")
-	fmt.Printf("Array size: %d MB\n", m.Config.SizeInMB)
+	if m.Config.RunSkew && m.selected(skewGroup) {
+		m.runStep("Skewed Access Analysis", func() { m.PrintSkewReport(m.AnalyzeSkew()) })
+	}
 
-	// Warm up
-	for i := 0; i < 1000; i++ {
-		idx := rand.Intn(len(data))
-		_ = data[idx]
+	if m.Config.RunRuntime && m.selected(runtimeGroup) {
+		m.runStep("Go Allocator and GC Tests", m.RunRuntimeTests)
 	}
 
-	// Measure
-	start := time.Now()
-	sum := int64(0)
+	if m.Config.RunWorkloads && m.selected(workloadGroup) {
+		m.runStep("Registered Workloads", m.RunWorkloads)
+	}
+}
 
-	for i := 0; i < m.Config.Iterations; i++ {
-		idx := rand.Intn(len(data))
-		sum += data[idx]
+// runStep runs one test of RunAll or RunSimulation, checking the ECC
+// error counters around it on real hardware, unless CheckMemory skipped it
+func (m *MemTester) runStep(name string, test func()) {
+	if m.skipped[name] {
+		fmt.Printf("\nSkipping %s, it does not fit in the available memory\n", name)
+		return
+	}
+	if m.Config.Simulate != nil {
+		test()
+		return
 	}
+	edac.Watch(name, test)
+}
 
-	elapsed := time.Since(start)
-	nsPerAccess := float64(elapsed.Nanoseconds()) / float64(m.Config.Iterations)
+// RandomAccessTest measures latency for random memory access
+func (m *MemTester) RandomAccessTest() {
+	fmt.Println("\nRandom Access Test:")
+	fmt.Printf("Array size: %d MB\n", m.Config.SizeInMB)
 
-	fmt.Printf("Random access latency: %.2f ns (sum: %d)\n", nsPerAccess, sum)
+	result, ok := m.measure("access/random", m.Config.SizeInMB*1024*1024, m.Config.Iterations, 1000)
+	if ok {
+		fmt.Printf("Random access latency: %.2f ns%s%s\n", result.NsPerOp(), result.Cycles(), result.Spread())
+	}
 }
 
 // SequentialAccessTest measures latency for sequential memory access
 func (m *MemTester) SequentialAccessTest() {
-	// Create a large array
-	data := make([]int64, m.Config.SizeInMB*1024*1024/8)
-
-	// Fill with some values
-	for i := range data {
-		data[i] = int64(i)
-	}
-
-	// Sequential access
 	fmt.Println("\nSequential Access Test:")
 	fmt.Printf("Array size: %d MB\n", m.Config.SizeInMB)
 
-	// Warm up
-	for i := 0; i < 1000; i++ {
-		_ = data[i%len(data)]
+	result, ok := m.measure("access/sequential", m.Config.SizeInMB*1024*1024, m.Config.Iterations, 1000)
+	if ok {
+		fmt.Printf("Sequential access latency: %.2f ns%s%s\n", result.NsPerOp(), result.Cycles(), result.Spread())
 	}
-
-	// Measure
-	start := time.Now()
-	sum := int64(0)
-
-	for i := 0; i < m.Config.Iterations; i++ {
-		idx := i % len(data)
-		sum += data[idx]
-	}
-
-	elapsed := time.Since(start)
-	nsPerAccess := float64(elapsed.Nanoseconds()) / float64(m.Config.Iterations)
-
-	fmt.Printf("Sequential access latency: %.2f ns (sum: %d)\n", nsPerAccess, sum)
 }
 
 // PointerChasingTest provides a more accurate latency measurement
@@ -161,43 +231,13 @@ func (m *MemTester) SequentialAccessTest() {
 func (m *MemTester) PointerChasingTest() {
 	fmt.Println("\nPointer Chasing Test (Most Accurate for Latency):")
 
-	// Create array of nodes
-	nodeCount := m.Config.SizeInMB * 1024 * 1024 / 64 // 64 bytes per node
-	nodes := make([]Node, nodeCount)
-
-	// Create a random permutation for true random access pattern
-	indices := rand.Perm(nodeCount)
-
-	// Link nodes in a random order to force cache misses
-	for i := 0; i < nodeCount-1; i++ {
-		nodes[indices[i]].Next = &nodes[indices[i+1]]
-	}
-	// Connect the last node back to a random node (not the first)
-	randomIdx := rand.Intn(nodeCount-2) + 1
-	nodes[indices[nodeCount-1]].Next = &nodes[indices[randomIdx]]
-
-	// Start at a random position
-	current := &nodes[indices[0]]
-
-	// Warm up
-	for i := 0; i < 1000; i++ {
-		current = current.Next
+	// One node per cache line, linked into a single random cycle through
+	// all of them, starting the walk anywhere on it
+	result, ok := m.measure("pointer-chase", m.Config.SizeInMB*1024*1024, m.Config.Iterations, 1000)
+	if !ok {
+		return
 	}
 
-	// Measure pointer chasing latency
-	start := time.Now()
-	node := current
-	count := 0
-
-	for i := 0; i < m.Config.Iterations; i++ {
-		node = node.Next
-		count++
-	}
-
-	elapsed := time.Since(start)
-	nsPerAccess := float64(elapsed.Nanoseconds()) / float64(m.Config.Iterations)
-
-	fmt.Printf("Array size: %d MB, Nodes: %d\n", m.Config.SizeInMB, nodeCount)
-	fmt.Printf("Pointer chasing latency: %.2f ns (count: %d)\n", nsPerAccess, count)
-	fmt.Printf("Memory address of last node: %p\n", unsafe.Pointer(node))
+	fmt.Printf("Array size: %d MB, Nodes: %d\n", m.Config.SizeInMB, m.Config.SizeInMB*1024*1024/m.cacheLineSize())
+	fmt.Printf("Pointer chasing latency: %.2f ns%s%s\n", result.NsPerOp(), result.Cycles(), result.Spread())
 }
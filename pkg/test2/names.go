@@ -0,0 +1,167 @@
+package test2
+
+import (
+	"app/pkg/selector"
+	"app/pkg/skew"
+	"app/pkg/workload"
+	"fmt"
+)
+
+// Names of the tests and test groups, see TestNames
+const (
+	lineSizeTestName         = "cache/line-size"
+	cacheGroup               = "cache"
+	cacheSizesTestName       = "cache/sizes"
+	assocTestName            = "cache/associativity"
+	prefetchGroup            = "prefetch"
+	prefetchDistanceTestName = "prefetch/distance"
+	skewGroup                = "skew"
+	runtimeGroup             = "runtime"
+)
+
+// bandwidthKinds are the sections of the cache bandwidth test
+var bandwidthKinds = []string{"read", "write", "copy"}
+
+// TestNames returns the names of the tests RunAll would run, in order.
+// Names are hierarchical, e.g. "cache/L2/bandwidth/read" or
+// "prefetch/stride-4-lines", and are what the -run and -skip patterns match.
+func (m *MemTester) TestNames() []string {
+	if m.Config.Simulate != nil {
+		return m.simulatedTestNames()
+	}
+	c := m.Config
+	var names []string
+	add := func(name string) {
+		if m.selected(name) {
+			names = append(names, name)
+		}
+	}
+
+	if c.LineSize == 0 {
+		add(lineSizeTestName)
+	}
+	if c.RunBasicTests {
+		add(m.randomTestName())
+		add(m.sequentialTestName())
+		add(m.pointerChaseTestName())
+	}
+	if c.RunDistribution {
+		add(m.distributionTestName())
+	}
+	if c.RunAdvanced {
+		add(m.advancedTestName())
+	}
+	if c.RunPrefetch {
+		for _, kind := range prefetchTypes() {
+			add(prefetchTestName(kind))
+		}
+		add(prefetchDistanceTestName)
+	}
+	if c.RunCacheTests {
+		add(cacheSizesTestName)
+		for _, level := range cacheTestLevels(defaultCacheSizes) {
+			add(cacheLatencyTestName(level.key))
+			for _, kind := range bandwidthKinds {
+				add(cacheBandwidthTestName(level.key, kind))
+			}
+		}
+		if c.RunAssocTest {
+			add(assocTestName)
+		}
+	}
+	if c.RunSkew {
+		for _, spec := range c.SkewPatterns {
+			add(skewTestName(spec))
+		}
+	}
+	if c.RunRuntime {
+		for _, test := range m.runtimeTests() {
+			add(runtimeGroup + "/" + test.name)
+		}
+	}
+	if c.RunWorkloads {
+		for _, name := range workload.Names() {
+			add(workloadTestName(name))
+		}
+	}
+	return names
+}
+
+// selected reports whether Config.Filter selects the named test or group
+func (m *MemTester) selected(name string) bool {
+	return m.Config.Filter.Match(name)
+}
+
+// bufferSizeName is the -size buffer as it appears in test names
+func (m *MemTester) bufferSizeName() string {
+	return selector.SizeName(m.Config.SizeInMB * 1024 * 1024)
+}
+
+// randomTestName names the random access test
+func (m *MemTester) randomTestName() string {
+	return "basic/random/" + m.bufferSizeName()
+}
+
+// sequentialTestName names the sequential access test
+func (m *MemTester) sequentialTestName() string {
+	return "basic/sequential/" + m.bufferSizeName()
+}
+
+// pointerChaseTestName names the pointer chasing test
+func (m *MemTester) pointerChaseTestName() string {
+	return "latency/pointer-chase/" + m.bufferSizeName()
+}
+
+// distributionTestName names the latency distribution test
+func (m *MemTester) distributionTestName() string {
+	return "latency/distribution/" + m.bufferSizeName()
+}
+
+// advancedTestName names the advanced latency test
+func (m *MemTester) advancedTestName() string {
+	return "latency/advanced/" + m.bufferSizeName()
+}
+
+// prefetchTypes returns the prefetcher types AnalyzePrefetchers reports,
+// in order
+func prefetchTypes() []string {
+	types := []string{"forward-stream", "backward-stream"}
+	for _, stride := range workload.ChainStrides {
+		types = append(types, fmt.Sprintf("stride-%d-lines", stride))
+	}
+	for _, streams := range workload.ChainStreams {
+		types = append(types, fmt.Sprintf("interleaved-%d-streams", streams))
+	}
+	return append(types, "page-crossing")
+}
+
+// prefetchTestName names one prefetcher type of the prefetcher analysis
+func prefetchTestName(kind string) string {
+	return prefetchGroup + "/" + kind
+}
+
+// cacheLevelGroup names the tests of one cache level, e.g. "cache/L2"
+func cacheLevelGroup(level string) string {
+	return cacheGroup + "/" + level
+}
+
+// cacheLatencyTestName names the latency test of one cache level
+func cacheLatencyTestName(level string) string {
+	return cacheLevelGroup(level) + "/latency"
+}
+
+// cacheBandwidthGroup names the bandwidth tests of one cache level
+func cacheBandwidthGroup(level string) string {
+	return cacheLevelGroup(level) + "/bandwidth"
+}
+
+// cacheBandwidthTestName names one section of a cache bandwidth test
+func cacheBandwidthTestName(level, kind string) string {
+	return cacheBandwidthGroup(level) + "/" + kind
+}
+
+// skewTestName names one distribution of the skew analysis, e.g.
+// "skew/zipf:0.99"
+func skewTestName(spec skew.Spec) string {
+	return skewGroup + "/" + spec.String()
+}
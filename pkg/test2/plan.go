@@ -0,0 +1,383 @@
+package test2
+
+import (
+	"app/pkg/dryrun"
+	"app/pkg/sysmem"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// intSize is the size of the elements of chain successor tables
+const intSize = int64(unsafe.Sizeof(int(0)))
+
+// minSizeMB is the smallest -size and -cache-max scaling goes down to
+const minSizeMB = 8
+
+// lineSizeStep names the cache line size detection in the dry run and
+// the memory budget
+const lineSizeStep = "Cache Line Size Detection"
+
+// DryRun prints every selected test that RunAll would run with its sizes, peak
+// memory and an estimated time from a short calibration probe, without
+// running it. Cache tests use the sysfs cache sizes, or typical ones when
+// sysfs has none, in place of the sizes RunAll would measure.
+func (m *MemTester) DryRun() {
+	if m.Config.Simulate != nil {
+		dryrun.Print(m.runnableSteps(m.simulationSteps()))
+		return
+	}
+	fmt.Println("\nCalibrating...")
+	cal := dryrun.Calibrate()
+	fmt.Println("Calibration:", cal)
+	dryrun.Print(m.runnableSteps(m.dryRunSteps(cal)))
+}
+
+// runnableSteps leaves out the steps CheckMemory skipped
+func (m *MemTester) runnableSteps(steps []dryrun.Step) []dryrun.Step {
+	var runnable []dryrun.Step
+	for _, step := range steps {
+		if !m.skipped[step.Name] {
+			runnable = append(runnable, step)
+		}
+	}
+	return runnable
+}
+
+// memorySteps returns the steps RunAll, or RunSimulation when
+// Config.Simulate is set, would run with their peak memory
+func (m *MemTester) memorySteps() []dryrun.Step {
+	if m.Config.Simulate != nil {
+		return m.runnableSteps(m.simulationSteps())
+	}
+	// The peak memory does not depend on the calibration
+	return m.runnableSteps(m.dryRunSteps(dryrun.Calibration{}))
+}
+
+// CheckMemory compares the peak memory of the selected tests, as the dry
+// run models it, with MemAvailable and the cgroup memory limit before
+// anything is allocated. Depending on Config.OnLowMemory it then refuses
+// to run, scales -size and -cache-max down and skips tests that still do
+// not fit, or only warns. Tests run one after another, so only the
+// largest one has to fit.
+func (m *MemTester) CheckMemory() error {
+	fmt.Println("\n==== Memory Budget ====")
+
+	budget, err := sysmem.ReadBudget()
+	if err != nil {
+		fmt.Printf("Available memory unknown (%v), skipping the check\n", err)
+		return nil
+	}
+	limit := budget.Available() - sysmem.Reserve
+	fmt.Printf("Available: %s (%s)\n", formatSize(int(max(0, limit))), budget)
+
+	var tooLarge []string
+	for _, step := range m.memorySteps() {
+		fmt.Printf("%-28s %10s\n", step.Name, formatSize(int(step.PeakBytes)))
+		if step.PeakBytes > limit {
+			tooLarge = append(tooLarge, fmt.Sprintf("%s needs %s", step.Name, formatSize(int(step.PeakBytes))))
+		}
+	}
+	if len(tooLarge) == 0 {
+		fmt.Println("All selected tests fit")
+		limitHeap(limit)
+		return nil
+	}
+
+	switch m.Config.OnLowMemory {
+	case sysmem.LowMemoryWarn:
+		fmt.Printf("Warning: %s, more than the %s available; the process may be OOM killed\n",
+			strings.Join(tooLarge, ", "), formatSize(int(max(0, limit))))
+		return nil
+	case sysmem.LowMemoryScale:
+		m.scaleToFit(limit)
+		limitHeap(limit)
+		return nil
+	default:
+		return fmt.Errorf("not enough memory: %s, but only %s is available (use -size, -cache-max or -on-low-memory=scale)",
+			strings.Join(tooLarge, ", "), formatSize(int(max(0, limit))))
+	}
+}
+
+// limitHeap lowers the Go runtime's memory limit to the available memory,
+// see sysmem.LimitHeap
+func limitHeap(available int64) {
+	if limit := sysmem.LimitHeap(available); limit > 0 {
+		fmt.Printf("Go memory limit: %s\n", formatSize(int(limit)))
+	}
+}
+
+// scaleToFit halves the size setting of every step that exceeds limit
+// until it fits, and skips steps that still do not. Most steps grow with
+// -size and the cache size estimation with -cache-max; the cache
+// performance tests use the cache sizes and a fixed memory case.
+func (m *MemTester) scaleToFit(limit int64) {
+	if m.skipped == nil {
+		m.skipped = make(map[string]bool)
+	}
+	for _, step := range m.memorySteps() {
+		// Scaling an earlier step may have shrunk this one already
+		peak := m.stepPeak(step.Name)
+		if peak <= limit {
+			continue
+		}
+		setting, flag := &m.Config.SizeInMB, "-size"
+		switch step.Name {
+		case "Cache Size Estimation":
+			setting, flag = &m.Config.CacheMaxMB, "-cache-max"
+		case "Cache Performance Tests":
+			setting = nil
+		}
+		for setting != nil && *setting > minSizeMB && peak > limit {
+			*setting = max(minSizeMB, *setting/2)
+			peak = m.stepPeak(step.Name)
+		}
+		if peak <= limit {
+			fmt.Printf("Scaled down %s to %s with %s=%d\n", step.Name, formatSize(int(peak)), flag, *setting)
+			continue
+		}
+		m.skipped[step.Name] = true
+		fmt.Printf("Skipping %s, it needs at least %s\n", step.Name, formatSize(int(peak)))
+	}
+}
+
+// stepPeak returns the peak memory of the named step, 0 when it does not run
+func (m *MemTester) stepPeak(name string) int64 {
+	for _, step := range m.memorySteps() {
+		if step.Name == name {
+			return step.PeakBytes
+		}
+	}
+	return 0
+}
+
+// dryRunSteps models the tests in the order RunAll runs them
+func (m *MemTester) dryRunSteps(cal dryrun.Calibration) []dryrun.Step {
+	c := m.Config
+	size := int64(c.SizeInMB) * 1024 * 1024
+	iterations := int64(c.Iterations)
+	timing := m.timing()
+	lines := size / int64(m.cacheLineSize())
+
+	var steps []dryrun.Step
+
+	if c.LineSize == 0 && m.selected(lineSizeTestName) {
+		blocks := size / lineProbeBlock
+		steps = append(steps, dryrun.Step{
+			Name:       lineSizeStep,
+			WorkingSet: formatSize(int(size)),
+			Iterations: 8 * iterations,
+			Threads:    1,
+			PeakBytes:  size + blocks*intSize,
+			Duration:   cal.FirstTouch(size) + 8*(cal.Shuffle(blocks)+cal.Chase(iterations, size)),
+		})
+	}
+
+	if c.RunBasicTests && m.selected(m.randomTestName()) {
+		steps = append(steps, dryrun.Step{
+			Name:       "Random Access Test",
+			WorkingSet: formatSize(int(size)),
+			Iterations: timing.Iterations(iterations),
+			Threads:    1,
+			PeakBytes:  size + min(size/8, 1<<20)*intSize, // plus the precomputed index stream
+			Duration:   cal.FirstTouch(size) + timing.Duration(cal.Chase(iterations, size)),
+		})
+	}
+	if c.RunBasicTests && m.selected(m.sequentialTestName()) {
+		steps = append(steps, dryrun.Step{
+			Name:       "Sequential Access Test",
+			WorkingSet: formatSize(int(size)),
+			Iterations: timing.Iterations(iterations),
+			Threads:    1,
+			PeakBytes:  size,
+			Duration:   cal.FirstTouch(size) + timing.Duration(cal.Chase(iterations, 0)),
+		})
+	}
+	if c.RunBasicTests && m.selected(m.pointerChaseTestName()) {
+		steps = append(steps, m.chaseStep(cal, "Pointer Chasing Test", lines))
+	}
+
+	if c.RunDistribution && m.selected(m.distributionTestName()) {
+		// Every batch also reads the timer twice, which costs about as much
+		// as two loads that hit
+		batch := int64(max(1, c.SampleBatch))
+		steps = append(steps, dryrun.Step{
+			Name:       "Latency Distribution",
+			WorkingSet: formatSize(int(size)),
+			Iterations: iterations / batch * batch,
+			Threads:    1,
+			PeakBytes:  size + lines*intSize,
+			Duration:   cal.FirstTouch(size) + cal.Shuffle(lines) + cal.Chase(iterations, size) + cal.Chase(2*iterations/batch, 0),
+		})
+	}
+
+	if c.RunAdvanced && m.selected(m.advancedTestName()) {
+		steps = append(steps, m.chaseStep(cal, "Advanced Latency Test", max(1000, lines)))
+	}
+
+	if c.RunPrefetch && m.selected(prefetchGroup) {
+		// The random and forward orders are always walked, page-crossing
+		// adds a page-random order and forward-stream reuses the forward walk
+		patterns := int64(2)
+		for _, kind := range prefetchTypes()[1:] {
+			if m.selected(prefetchTestName(kind)) {
+				patterns++
+			}
+		}
+		step := dryrun.Step{
+			Name:       "Prefetcher Analysis",
+			WorkingSet: formatSize(int(size)),
+			Iterations: patterns * timing.Iterations(iterations),
+			Threads:    1,
+			PeakBytes:  size + lines*intSize,
+			// Every pattern is a chain with its own buffer. Only the random
+			// order is shuffled and defeats the prefetchers; linking each
+			// order costs a pass of independent misses.
+			Duration: time.Duration(patterns)*cal.FirstTouch(size) + cal.Shuffle(lines) + cal.Chase(patterns*lines/4, size) +
+				timing.Duration(cal.Chase(iterations, size)) + time.Duration(patterns-1)*timing.Duration(cal.Chase(iterations, 0)),
+		}
+		if m.selected(prefetchDistanceTestName) {
+			// Two runs per distance of at most one load per line walked
+			probes := 2 * int64(len(probeAheadsFor(m.cacheLineSize())))
+			loads := min(iterations, size/probePageSize*(probeTrainLines+1))
+			step.Iterations += probes * timing.Iterations(loads)
+			step.Duration += cal.FirstTouch(size) + time.Duration(probes)*timing.Duration(cal.Chase(loads, size))
+		}
+		steps = append(steps, step)
+	}
+
+	if c.RunCacheTests && m.selected(cacheGroup) && m.selected(cacheSizesTestName) {
+		sizes := m.cacheCurveSizes()
+		estimate := dryrun.Step{
+			Name:       "Cache Size Estimation",
+			WorkingSet: formatSize(sizes[0]) + "-" + formatSize(sizes[len(sizes)-1]),
+			Threads:    1,
+		}
+		// Every size is a chain over its own buffer, warmed up with a pass
+		// and timed at least cacheCurveRepetitions times
+		curveTiming := timing
+		curveTiming.Repetitions = max(curveTiming.Repetitions, cacheCurveRepetitions)
+		for _, s := range sizes {
+			nodes := int64(s / m.cacheLineSize())
+			estimate.Iterations += curveTiming.Iterations(iterations)
+			estimate.PeakBytes = max(estimate.PeakBytes, int64(s)+nodes*intSize)
+			estimate.Duration += cal.FirstTouch(int64(s)) + cal.Setup(nodes) + cal.Chase(nodes, int64(s)) +
+				curveTiming.Duration(cal.Chase(iterations, int64(s)))
+		}
+		steps = append(steps, estimate)
+	}
+
+	if c.RunCacheTests && m.selected(cacheGroup) {
+		cacheSizes := m.expectedCacheSizes()
+		var levels []cacheTestLevel
+		for _, level := range cacheTestLevels(cacheSizes) {
+			if m.selected(cacheLevelGroup(level.key)) {
+				levels = append(levels, level)
+			}
+		}
+		performance := dryrun.Step{Name: "Cache Performance Tests", Threads: 1}
+		if len(levels) > 0 {
+			performance.WorkingSet = formatSize(levels[0].size) + "-" + formatSize(levels[len(levels)-1].size)
+		}
+		for _, level := range levels {
+			s := int64(level.size)
+			if m.selected(cacheLatencyTestName(level.key)) {
+				nodes := s / int64(m.cacheLineSize())
+				performance.Iterations += timing.Iterations(cacheLatencyIterations)
+				performance.PeakBytes = max(performance.PeakBytes, s+nodes*intSize)
+				performance.Duration += cal.Setup(nodes) + cal.Chase(nodes, s) + timing.Duration(cal.Chase(cacheLatencyIterations, s))
+			}
+
+			sections := int64(0)
+			for _, kind := range bandwidthKinds {
+				if m.selected(cacheBandwidthTestName(level.key, kind)) {
+					sections++
+				}
+			}
+			if sections == 0 {
+				continue
+			}
+			// Every section fills its own buffer and warms it up with one pass
+			iters := int64(bandwidthIterations(level.size / 8))
+			performance.Iterations += sections * timing.Iterations(iters*s/8)
+			performance.PeakBytes = max(performance.PeakBytes, s)
+			performance.Duration += time.Duration(sections) * (cal.FirstTouch(s) + cal.Stream(s) + timing.Duration(cal.Stream(iters*s)))
+			if m.selected(cacheBandwidthTestName(level.key, "copy")) {
+				// The copy section holds the buffer and its copy at once
+				performance.PeakBytes = max(performance.PeakBytes, 2*s)
+				performance.Duration += cal.FirstTouch(s)
+			}
+		}
+		if len(levels) > 0 {
+			steps = append(steps, performance)
+		}
+
+		if c.RunAssocTest && m.selected(assocTestName) {
+			assoc := dryrun.Step{Name: "Associativity Detection", WorkingSet: "up to " + formatSize(int(size)), Threads: 1}
+			for _, cacheSize := range []int{cacheSizes.L1, cacheSizes.L2, cacheSizes.L3} {
+				maxLines := int64(min(maxWays+1, int(size)/cacheSize))
+				assoc.Iterations += maxLines * iterations
+				assoc.PeakBytes = max(assoc.PeakBytes, maxLines*int64(cacheSize))
+				// A few dozen lines fit by capacity, so loads hit until they
+				// conflict; on average that about doubles the hit cost
+				assoc.Duration += 2 * cal.Chase(maxLines*iterations, 0)
+			}
+			steps = append(steps, assoc)
+		}
+	}
+
+	if c.RunSkew && m.selected(skewGroup) {
+		steps = append(steps, m.skewStep(cal))
+	}
+
+	if c.RunRuntime && m.selected(runtimeGroup) {
+		// Allocation and GC costs are what this test measures, so there is
+		// nothing to estimate them from
+		steps = append(steps, dryrun.Step{
+			Name:       "Go Allocator and GC Tests",
+			WorkingSet: formatSize(int(size)),
+			Threads:    1,
+			PeakBytes:  size,
+		})
+	}
+
+	if c.RunWorkloads && m.selected(workloadGroup) {
+		steps = append(steps, m.workloadsStep())
+	}
+
+	return steps
+}
+
+// chaseStep models a pointer chasing test over the given number of nodes
+func (m *MemTester) chaseStep(cal dryrun.Calibration, name string, nodes int64) dryrun.Step {
+	bytes := nodes * int64(m.cacheLineSize())
+	iterations := int64(m.Config.Iterations)
+	timing := m.timing()
+	return dryrun.Step{
+		Name:       name,
+		WorkingSet: formatSize(int(bytes)),
+		Iterations: timing.Iterations(iterations),
+		Threads:    1,
+		PeakBytes:  bytes + nodes*intSize,
+		Duration:   cal.FirstTouch(bytes) + cal.Shuffle(nodes) + cal.Chase(1000, bytes) + timing.Duration(cal.Chase(iterations, bytes)),
+	}
+}
+
+// timing returns how the harness times each measurement
+func (m *MemTester) timing() dryrun.Timing {
+	return dryrun.Timing{Repetitions: m.Config.Repetitions, Target: m.Config.TargetTime}
+}
+
+// expectedCacheSizes returns the data cache sizes from sysfs, falling back
+// to typical sizes for levels sysfs does not list
+func (m *MemTester) expectedCacheSizes() CacheSizes {
+	sizes := defaultCacheSizes
+	caches := ReadSysfsCaches(sysfsCacheDir)
+	for level, size := range []*int{&sizes.L1, &sizes.L2, &sizes.L3} {
+		if c, ok := sysfsDataCache(caches, level+1); ok && c.Size > 0 {
+			*size = c.Size
+		}
+	}
+	return sizes
+}
@@ -0,0 +1,31 @@
+package test2
+
+import "testing"
+
+func TestScaleToFit(t *testing.T) {
+	config := NewDefaultConfig()
+	config.RunAssocTest = true
+	config.RunDistribution = true
+	config.RunSkew = true
+	config.LineSize = 64
+	m := NewMemTester(config)
+
+	// The cache performance tests copy their fixed 64MB memory case, every
+	// other step shrinks with -size or -cache-max
+	const limit = 100 << 20
+	m.scaleToFit(limit)
+	for _, step := range m.memorySteps() {
+		if step.PeakBytes > limit {
+			t.Errorf("%s still needs %s", step.Name, formatSize(int(step.PeakBytes)))
+		}
+	}
+	if !m.skipped["Cache Performance Tests"] {
+		t.Error("cache performance tests not skipped")
+	}
+	if m.skipped["Associativity Detection"] || m.skipped["Cache Size Estimation"] {
+		t.Errorf("skipped %v, want only the cache performance tests", m.skipped)
+	}
+	if config.SizeInMB != 64 || config.CacheMaxMB != 64 {
+		t.Errorf("-size=%d and -cache-max=%d, want 64 and 64", config.SizeInMB, config.CacheMaxMB)
+	}
+}
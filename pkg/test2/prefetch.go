@@ -0,0 +1,262 @@
+package test2
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/workload"
+	"fmt"
+	"math/rand"
+)
+
+// PrefetchVerdict is the conclusion reached for one prefetcher type
+type PrefetchVerdict string
+
+const (
+	PrefetchDetected     PrefetchVerdict = "detected"
+	PrefetchNotDetected  PrefetchVerdict = "not detected"
+	PrefetchInconclusive PrefetchVerdict = "inconclusive"
+)
+
+// Ratios to the random baseline below/above which a verdict is reached
+const (
+	prefetchDetectedRatio    = 0.5
+	prefetchNotDetectedRatio = 0.8
+)
+
+// The distance probe trains a forward stream on the first probeTrainLines
+// lines of every probePageSize block, then loads one line further ahead.
+// Prefetchers stop at 4 KB boundaries even on larger pages.
+const (
+	probePageSize   = 4096
+	probeTrainLines = 4
+)
+
+// probeAheads are the distances in lines the probe loads ahead of the
+// trained stream, as far as a block holds them
+var probeAheads = []int{1, 2, 3, 4, 6, 8, 10, 12, 16, 20, 24, 32, 40, 48, 56}
+
+// PrefetchResult holds the measured evidence for one prefetcher type
+type PrefetchResult struct {
+	Type        string  // prefetcher type, e.g. "forward-stream" or "stride-4-lines"
+	NsPerAccess float64 // average time of one dependent load in the pattern
+	Baseline    float64 // ns per access of the pattern it is compared against
+	Ratio       float64 // NsPerAccess / Baseline
+	Verdict     PrefetchVerdict
+}
+
+// PrefetchReport is the structured result of AnalyzePrefetchers
+type PrefetchReport struct {
+	BufferSize int     // bytes walked by every pattern
+	LineSize   int     // cache line size used for the patterns
+	RandomNs   float64 // ns per access with lines visited in random order
+	Results    []PrefetchResult
+
+	// DistanceLines is how far ahead of a trained forward stream lines are
+	// already cached, the largest probe that still hits, 0 when no probe
+	// did or the distance was not measured
+	DistanceLines int
+	Probes        []PrefetchProbe
+}
+
+// PrefetchProbe is the cost of loading the line Ahead lines past a trained
+// forward stream, compared to loading it before the stream
+type PrefetchProbe struct {
+	Ahead     int
+	ColdNs    float64 // ns per access with the probe loaded first
+	TrainedNs float64 // ns per access with the probe loaded after the stream
+}
+
+// SavedNs returns the time the trained stream saved on the probe load
+func (p PrefetchProbe) SavedNs() float64 {
+	return (p.ColdNs - p.TrainedNs) * (probeTrainLines + 1)
+}
+
+// AnalyzePrefetchers characterizes the hardware prefetchers. Every pattern
+// is a chain workload whose cache lines are linked in a precomputed order,
+// so the timed loop contains only the loads themselves. Each pattern's cost
+// is compared to walking the same lines in random order.
+func (m *MemTester) AnalyzePrefetchers() PrefetchReport {
+	lineSize := m.cacheLineSize()
+	bufferSize := m.Config.SizeInMB * 1024 * 1024
+
+	report := PrefetchReport{BufferSize: bufferSize, LineSize: lineSize}
+	measure := func(chain string) float64 {
+		result, _ := m.measure(chain, bufferSize, m.Config.Iterations, 0)
+		return result.NsPerOp()
+	}
+
+	// Patterns not selected by Config.Filter are left out of the report;
+	// the random baseline and the forward walk are measured for all of them
+	report.RandomNs = measure("chain/random")
+	forwardNs := measure("chain/forward")
+	add := func(kind string, baseline float64, ns func() float64) {
+		if m.selected(prefetchTestName(kind)) {
+			report.Results = append(report.Results, newPrefetchResult(kind, ns(), baseline))
+		}
+	}
+
+	add("forward-stream", report.RandomNs, func() float64 { return forwardNs })
+	add("backward-stream", report.RandomNs, func() float64 { return measure("chain/backward") })
+
+	for _, stride := range workload.ChainStrides {
+		add(fmt.Sprintf("stride-%d-lines", stride), report.RandomNs, func() float64 {
+			return measure(fmt.Sprintf("chain/stride-%d", stride))
+		})
+	}
+
+	for _, streams := range workload.ChainStreams {
+		add(fmt.Sprintf("interleaved-%d-streams", streams), report.RandomNs, func() float64 {
+			return measure(fmt.Sprintf("chain/interleaved-%d", streams))
+		})
+	}
+
+	// Crossing pages: a forward walk is compared against the same walk
+	// with the pages visited in random order, which forces the prefetcher
+	// to start over at every page boundary
+	if m.selected(prefetchTestName("page-crossing")) {
+		pageRandomNs := measure("chain/page-random")
+		add("page-crossing", pageRandomNs, func() float64 { return forwardNs })
+	}
+
+	if m.selected(prefetchDistanceTestName) {
+		report.Probes = m.probePrefetchDistance(bufferSize, lineSize)
+		report.DistanceLines = prefetchDistance(report.Probes)
+	}
+	return report
+}
+
+// probePrefetchDistance measures how far ahead of a forward stream lines
+// are cached. Every 4 KB block of the buffer, in random order, is walked
+// forward for probeTrainLines lines, which trains the stream prefetchers,
+// and then the line some distance past the last one is loaded. The same
+// loads with that probe first, before the stream is trained, cost the
+// same except for the probe, so the difference is what the prefetcher
+// saved on it. Each timed run walks every block at most once, so the
+// probes do not find lines cached from the last pass.
+func (m *MemTester) probePrefetchDistance(bufferSize, lineSize int) []PrefetchProbe {
+	blocks := bufferSize / probePageSize
+	if blocks < 2 || len(probeAheadsFor(lineSize)) == 0 {
+		return nil
+	}
+	buffer, allocation := alloc.Make[int64](m.Config.Alloc, blocks*probePageSize/8)
+	defer allocation.Free()
+
+	measure := func(ahead int, probeFirst bool) (float64, bool) {
+		order := probeOrder(blocks, lineSize, ahead, probeFirst)
+		w := &orderChain{name: fmt.Sprintf("prefetch/distance-%d", ahead), buffer: buffer, order: order}
+		result, err := m.measureWorkload(w, min(m.Config.Iterations, len(order)), m.measureOptions(0))
+		if err != nil {
+			fmt.Printf("Skipping %v\n", err)
+			return 0, false
+		}
+		return result.NsPerOp(), true
+	}
+
+	var probes []PrefetchProbe
+	for _, ahead := range probeAheadsFor(lineSize) {
+		cold, ok := measure(ahead, true)
+		if !ok {
+			return probes
+		}
+		trained, ok := measure(ahead, false)
+		if !ok {
+			return probes
+		}
+		probes = append(probes, PrefetchProbe{Ahead: ahead, ColdNs: cold, TrainedNs: trained})
+	}
+	return probes
+}
+
+// probeAheadsFor returns the probe distances that fit in a block after the
+// trained stream
+func probeAheadsFor(lineSize int) []int {
+	var aheads []int
+	for _, ahead := range probeAheads {
+		if probeTrainLines-1+ahead < probePageSize/lineSize {
+			aheads = append(aheads, ahead)
+		}
+	}
+	return aheads
+}
+
+// probeOrder returns the word indices the distance probe loads: the blocks
+// in random order, and in each the first probeTrainLines lines followed by
+// the line ahead lines past the last of them, or preceded by it when
+// probeFirst is set
+func probeOrder(blocks, lineSize, ahead int, probeFirst bool) []int {
+	wordsPerLine := lineSize / 8
+	order := make([]int, 0, blocks*(probeTrainLines+1))
+	for _, block := range rand.Perm(blocks) {
+		first := block * probePageSize / 8
+		probe := first + (probeTrainLines-1+ahead)*wordsPerLine
+		if probeFirst {
+			order = append(order, probe)
+		}
+		for line := 0; line < probeTrainLines; line++ {
+			order = append(order, first+line*wordsPerLine)
+		}
+		if !probeFirst {
+			order = append(order, probe)
+		}
+	}
+	return order
+}
+
+// prefetchDistance returns the largest distance up to which every probe
+// saved at least half of what the nearest probe saved, or 0 when the
+// nearest probe was not clearly faster after the stream, as without a
+// stream prefetcher
+func prefetchDistance(probes []PrefetchProbe) int {
+	if len(probes) == 0 || probes[0].TrainedNs > probes[0].ColdNs*prefetchNotDetectedRatio {
+		return 0
+	}
+	distance := 0
+	for _, p := range probes {
+		if p.SavedNs() < probes[0].SavedNs()/2 {
+			break
+		}
+		distance = p.Ahead
+	}
+	return distance
+}
+
+// newPrefetchResult builds a result and its verdict from the measurements
+func newPrefetchResult(kind string, ns, baseline float64) PrefetchResult {
+	result := PrefetchResult{Type: kind, NsPerAccess: ns, Baseline: baseline}
+	if baseline > 0 {
+		result.Ratio = ns / baseline
+	}
+	switch {
+	case result.Ratio < prefetchDetectedRatio:
+		result.Verdict = PrefetchDetected
+	case result.Ratio > prefetchNotDetectedRatio:
+		result.Verdict = PrefetchNotDetected
+	default:
+		result.Verdict = PrefetchInconclusive
+	}
+	return result
+}
+
+// PrintPrefetchReport prints a prefetcher report as a table
+func (m *MemTester) PrintPrefetchReport(report PrefetchReport) {
+	fmt.Println("\n==== Hardware Prefetcher Analysis ====")
+	fmt.Printf("Buffer: %s, line size: %d B, random baseline: %.2f ns\n",
+		formatSize(report.BufferSize), report.LineSize, report.RandomNs)
+	fmt.Printf("%-22s %10s %10s %7s  %s\n", "Prefetcher", "ns/access", "baseline", "ratio", "verdict")
+	for _, r := range report.Results {
+		fmt.Printf("%-22s %10.2f %10.2f %6.2fx  %s\n", r.Type, r.NsPerAccess, r.Baseline, r.Ratio, r.Verdict)
+	}
+
+	if len(report.Probes) == 0 {
+		return
+	}
+	fmt.Printf("\nProbe past a %d-line forward stream per %s block:\n", probeTrainLines, formatSize(probePageSize))
+	fmt.Printf("%-12s %10s %10s %10s\n", "Lines ahead", "cold", "trained", "saved")
+	for _, p := range report.Probes {
+		fmt.Printf("%-12d %10.2f %10.2f %10.2f\n", p.Ahead, p.ColdNs, p.TrainedNs, p.SavedNs())
+	}
+	if report.DistanceLines == 0 {
+		fmt.Println("Estimated prefetch distance: none, no line ahead of the stream was cached")
+	} else {
+		fmt.Printf("Estimated prefetch distance: %d lines\n", report.DistanceLines)
+	}
+}
@@ -0,0 +1,269 @@
+package test2
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+)
+
+// Runtime metrics recorded before and after every runtime test case
+const (
+	metricAllocBytes   = "/gc/heap/allocs:bytes"
+	metricAllocObjects = "/gc/heap/allocs:objects"
+	metricGCCycles     = "/gc/cycles/total:gc-cycles"
+	metricGCCPU        = "/cpu/classes/gc/total:cpu-seconds"
+	metricGCPauses     = "/sched/pauses/total/gc:seconds"
+)
+
+// runtimeSink keeps allocations reachable so they escape to the heap
+var runtimeSink [64][]byte
+
+// RuntimeMetrics is a snapshot of the Go runtime's memory and GC counters
+type RuntimeMetrics struct {
+	AllocBytes   uint64
+	AllocObjects uint64
+	GCCycles     uint64
+	GCCPUSeconds float64
+	Pauses       uint64  // number of GC stop-the-world pauses
+	PauseTotal   float64 // approximate total pause time in seconds
+}
+
+// ReadRuntimeMetrics samples the runtime/metrics counters used by the
+// runtime tests
+func ReadRuntimeMetrics() RuntimeMetrics {
+	samples := []metrics.Sample{
+		{Name: metricAllocBytes},
+		{Name: metricAllocObjects},
+		{Name: metricGCCycles},
+		{Name: metricGCCPU},
+		{Name: metricGCPauses},
+	}
+	metrics.Read(samples)
+
+	var result RuntimeMetrics
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			switch s.Name {
+			case metricAllocBytes:
+				result.AllocBytes = s.Value.Uint64()
+			case metricAllocObjects:
+				result.AllocObjects = s.Value.Uint64()
+			case metricGCCycles:
+				result.GCCycles = s.Value.Uint64()
+			}
+		case metrics.KindFloat64:
+			result.GCCPUSeconds = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			result.Pauses, result.PauseTotal = summarizeHistogram(s.Value.Float64Histogram())
+		}
+	}
+	return result
+}
+
+// Sub returns the change from an earlier snapshot
+func (r RuntimeMetrics) Sub(before RuntimeMetrics) RuntimeMetrics {
+	return RuntimeMetrics{
+		AllocBytes:   r.AllocBytes - before.AllocBytes,
+		AllocObjects: r.AllocObjects - before.AllocObjects,
+		GCCycles:     r.GCCycles - before.GCCycles,
+		GCCPUSeconds: r.GCCPUSeconds - before.GCCPUSeconds,
+		Pauses:       r.Pauses - before.Pauses,
+		PauseTotal:   r.PauseTotal - before.PauseTotal,
+	}
+}
+
+// String formats a metrics delta for the reports
+func (r RuntimeMetrics) String() string {
+	return fmt.Sprintf("allocs: %d objs / %s, GC cycles: %d, GC CPU: %.2f ms, pauses: %d (total %.2f ms)",
+		r.AllocObjects, formatSize(int(r.AllocBytes)), r.GCCycles, r.GCCPUSeconds*1e3,
+		r.Pauses, r.PauseTotal*1e3)
+}
+
+// summarizeHistogram returns the sample count and the approximate sum of a
+// histogram, using bucket midpoints
+func summarizeHistogram(h *metrics.Float64Histogram) (uint64, float64) {
+	var count uint64
+	var total float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		low, high := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = 0
+		}
+		if math.IsInf(high, 1) {
+			high = low
+		}
+		count += n
+		total += float64(n) * (low + high) / 2
+	}
+	return count, total
+}
+
+// RunRuntimeTests measures the Go runtime's own memory behavior: allocation
+// cost by size class, zeroing of large slices, sync.Pool reuse and GC
+// overhead for pointerful versus pointer-free heaps
+func (m *MemTester) RunRuntimeTests() {
+	fmt.Println("\n==== Go Allocator and GC Tests ====")
+	for _, test := range m.runtimeTests() {
+		if m.selected(runtimeGroup + "/" + test.name) {
+			test.run()
+		}
+	}
+}
+
+// runtimeTest is one named allocator or GC test
+type runtimeTest struct {
+	name string
+	run  func()
+}
+
+// runtimeTests returns the allocator and GC tests in the order they run
+func (m *MemTester) runtimeTests() []runtimeTest {
+	return []runtimeTest{
+		{"alloc-sizes", m.testAllocSizes},
+		{"large-make", m.testLargeMake},
+		{"pool", m.testPoolReuse},
+		{"gc", m.testGCOverhead},
+	}
+}
+
+// testAllocSizes measures allocation throughput and latency by object size
+func (m *MemTester) testAllocSizes() {
+	fmt.Println("\nAllocation cost by object size:")
+
+	clock := m.measurementTimer()
+	sizes := []int{8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536, 1024 * 1024}
+	for _, size := range sizes {
+		count := m.Config.SizeInMB * 1024 * 1024 / size
+		count = max(1000, min(count, m.Config.Iterations))
+
+		before := ReadRuntimeMetrics()
+		start := clock.Now()
+		for i := 0; i < count; i++ {
+			runtimeSink[i%len(runtimeSink)] = make([]byte, size)
+		}
+		elapsed := clock.Since(start)
+		delta := ReadRuntimeMetrics().Sub(before)
+
+		nsPerAlloc := float64(elapsed.Nanoseconds()) / float64(count)
+		bandwidth := float64(size) * float64(count) / elapsed.Seconds() / 1e9
+		fmt.Printf("  %8s: %8.1f ns/alloc%s, %6.2f GB/s | %s\n", formatSize(size), nsPerAlloc, m.cycles(nsPerAlloc), bandwidth, delta)
+	}
+	clear(runtimeSink[:])
+}
+
+// testLargeMake measures how fast make returns zeroed large slices that
+// are ready to use. Fresh slices may come from untouched pages the kernel
+// only zeroes on first access, so every page is written once: the result
+// is the cost of zeroed memory whether the runtime or the kernel clears it.
+func (m *MemTester) testLargeMake() {
+	fmt.Println("\nLarge slice make and first touch of every page (zeroing cost):")
+
+	clock := m.measurementTimer()
+	page := os.Getpagesize()
+	for _, size := range []int{1024 * 1024, 16 * 1024 * 1024, m.Config.SizeInMB * 1024 * 1024} {
+		const rounds = 8
+		before := ReadRuntimeMetrics()
+		start := clock.Now()
+		for i := 0; i < rounds; i++ {
+			buffer := make([]byte, size)
+			for offset := 0; offset < len(buffer); offset += page {
+				buffer[offset] = 1
+			}
+			runtimeSink[0] = buffer
+			runtimeSink[0] = nil
+		}
+		elapsed := clock.Since(start)
+		delta := ReadRuntimeMetrics().Sub(before)
+
+		perMake := elapsed / rounds
+		fmt.Printf("  %8s: %v%s per make, %6.2f GB/s | %s\n",
+			formatSize(size), perMake, m.cycles(float64(perMake.Nanoseconds())), float64(size)/perMake.Seconds()/1e9, delta)
+	}
+}
+
+// testPoolReuse compares sync.Pool reuse against fresh allocation
+func (m *MemTester) testPoolReuse() {
+	fmt.Println("\nsync.Pool reuse vs fresh allocation:")
+
+	const bufferSize = 64 * 1024
+	count := max(1000, min(m.Config.SizeInMB*1024*1024/bufferSize, m.Config.Iterations))
+
+	clock := m.measurementTimer()
+	before := ReadRuntimeMetrics()
+	start := clock.Now()
+	for i := 0; i < count; i++ {
+		buffer := make([]byte, bufferSize)
+		buffer[0] = byte(i)
+		runtimeSink[i%len(runtimeSink)] = buffer
+	}
+	freshElapsed := clock.Since(start)
+	freshDelta := ReadRuntimeMetrics().Sub(before)
+	clear(runtimeSink[:])
+
+	// Pool pointers to slices so Put does not allocate a slice header
+	pool := sync.Pool{New: func() any {
+		buffer := make([]byte, bufferSize)
+		return &buffer
+	}}
+	before = ReadRuntimeMetrics()
+	start = clock.Now()
+	for i := 0; i < count; i++ {
+		buffer := pool.Get().(*[]byte)
+		(*buffer)[0] = byte(i)
+		pool.Put(buffer)
+	}
+	poolElapsed := clock.Since(start)
+	poolDelta := ReadRuntimeMetrics().Sub(before)
+
+	freshNs := float64(freshElapsed.Nanoseconds()) / float64(count)
+	poolNs := float64(poolElapsed.Nanoseconds()) / float64(count)
+	fmt.Printf("  fresh make: %8.1f ns/op%s | %s\n", freshNs, m.cycles(freshNs), freshDelta)
+	fmt.Printf("  sync.Pool:  %8.1f ns/op%s | %s\n", poolNs, m.cycles(poolNs), poolDelta)
+}
+
+// testGCOverhead measures GC pause and CPU cost while the heap holds a large
+// pointerful []Node compared with a pointer-free []int64 of the same size
+func (m *MemTester) testGCOverhead() {
+	fmt.Println("\nGC overhead by live heap type:")
+
+	size := m.Config.SizeInMB * 1024 * 1024
+
+	nodes := make([]Node, size/nodeSize)
+	for i := range nodes {
+		nodes[i].Next = &nodes[(i+1)%len(nodes)]
+	}
+	m.measureGC(fmt.Sprintf("[]Node  (%s, pointerful)", formatSize(size)))
+	runtime.KeepAlive(nodes)
+
+	values := make([]int64, size/8)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	m.measureGC(fmt.Sprintf("[]int64 (%s, pointer-free)", formatSize(size)))
+	runtime.KeepAlive(values)
+}
+
+// measureGC forces a few collections with the current live heap and reports
+// their wall time together with the runtime metrics delta
+func (m *MemTester) measureGC(label string) {
+	const collections = 5
+	clock := m.measurementTimer()
+	runtime.GC()
+
+	before := ReadRuntimeMetrics()
+	start := clock.Now()
+	for i := 0; i < collections; i++ {
+		runtime.GC()
+	}
+	perGC := clock.Since(start) / collections
+	delta := ReadRuntimeMetrics().Sub(before)
+
+	fmt.Printf("  %s: %v%s per GC | %s\n", label, perGC, m.cycles(float64(perGC.Nanoseconds())), delta)
+}
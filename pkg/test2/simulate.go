@@ -0,0 +1,181 @@
+package test2
+
+import (
+	"app/pkg/dryrun"
+	"app/pkg/memsim"
+	"app/pkg/workload"
+	"fmt"
+	"strings"
+)
+
+// RunSimulation runs the tests that detect the memory hierarchy against
+// the simulated CPU of Config.Simulate instead of the real one: the
+// prefetcher analysis, the cache size detection, the skew analysis and the
+// registered workloads. Their access streams are replayed on the simulator,
+// so the results are deterministic and can be checked against the known
+// geometry. Tests that time the hardware directly are left out.
+func (m *MemTester) RunSimulation() {
+	sim := m.Config.Simulate
+	fmt.Println("Memory Latency and Cache Test Suite")
+	fmt.Println("\n==== Simulated Memory Hierarchy ====")
+	fmt.Println(sim)
+
+	// The line size is known, so it is not detected
+	m.lineSize = sim.LineSize
+
+	if m.Config.RunPrefetch && m.selected(prefetchGroup) {
+		m.runStep("Prefetcher Analysis", func() { m.PrintPrefetchReport(m.AnalyzePrefetchers()) })
+	}
+	if m.Config.RunCacheTests && m.selected(cacheSizesTestName) {
+		m.runStep("Cache Size Estimation", func() { m.EstimateCacheSizes() })
+	}
+	if m.Config.RunSkew && m.selected(skewGroup) {
+		m.runStep("Skewed Access Analysis", func() { m.PrintSkewReport(m.AnalyzeSkew()) })
+	}
+	if m.Config.RunWorkloads && m.selected(workloadGroup) {
+		m.runStep("Registered Workloads", m.RunWorkloads)
+	}
+}
+
+// simulatedTestNames returns the names of the tests RunSimulation would
+// run, in order
+func (m *MemTester) simulatedTestNames() []string {
+	c := m.Config
+	var names []string
+	add := func(name string) {
+		if m.selected(name) {
+			names = append(names, name)
+		}
+	}
+
+	if c.RunPrefetch {
+		for _, kind := range prefetchTypes() {
+			add(prefetchTestName(kind))
+		}
+		add(prefetchDistanceTestName)
+	}
+	if c.RunCacheTests {
+		add(cacheSizesTestName)
+	}
+	if c.RunSkew {
+		for _, spec := range c.SkewPatterns {
+			add(skewTestName(spec))
+		}
+	}
+	if c.RunWorkloads {
+		for _, name := range workload.Names() {
+			add(workloadTestName(name))
+		}
+	}
+	return names
+}
+
+// simulationSteps models RunSimulation for the dry run and the memory
+// budget. Simulated loads cost far more than real ones and depend on the
+// geometry, so only the work and the memory are shown, not the time.
+func (m *MemTester) simulationSteps() []dryrun.Step {
+	c := m.Config
+	size := c.SizeInMB * 1024 * 1024
+	iterations := int64(c.Iterations)
+
+	var steps []dryrun.Step
+	if c.RunPrefetch && m.selected(prefetchGroup) {
+		patterns := int64(2)
+		for _, kind := range prefetchTypes()[1:] {
+			if m.selected(prefetchTestName(kind)) {
+				patterns++
+			}
+		}
+		runs := patterns * iterations
+		if m.selected(prefetchDistanceTestName) {
+			probes := 2 * int64(len(probeAheadsFor(m.cacheLineSize())))
+			runs += probes * min(iterations, int64(size/probePageSize*(probeTrainLines+1)))
+		}
+		steps = append(steps, dryrun.Step{
+			Name:       "Prefetcher Analysis",
+			WorkingSet: formatSize(size),
+			Iterations: runs,
+			Threads:    1,
+			PeakBytes:  int64(size) + int64(size/m.cacheLineSize())*intSize,
+		})
+	}
+	if c.RunCacheTests && m.selected(cacheSizesTestName) {
+		sizes := m.cacheCurveSizes()
+		largest := int64(sizes[len(sizes)-1])
+		steps = append(steps, dryrun.Step{
+			Name:       "Cache Size Estimation",
+			WorkingSet: formatSize(sizes[0]) + "-" + formatSize(sizes[len(sizes)-1]),
+			Iterations: int64(len(sizes)) * iterations,
+			Threads:    1,
+			PeakBytes:  largest + largest/int64(m.cacheLineSize())*intSize,
+		})
+	}
+	if c.RunSkew && m.selected(skewGroup) {
+		runs, _ := m.skewRuns()
+		steps = append(steps, dryrun.Step{
+			Name:       "Skewed Access Analysis",
+			WorkingSet: formatSize(size),
+			Iterations: 2 * runs * iterations,
+			Threads:    1,
+			PeakBytes:  m.skewStep(dryrun.Calibration{}).PeakBytes,
+		})
+	}
+	if c.RunWorkloads && m.selected(workloadGroup) {
+		steps = append(steps, m.workloadsStep())
+	}
+	return steps
+}
+
+// measureWorkload times a workload with the harness, or replays its loads
+// on a fresh simulated hierarchy when Config.Simulate is set
+func (m *MemTester) measureWorkload(w workload.Workload, iterations int, opts workload.Options) (workload.Result, error) {
+	if m.Config.Simulate == nil {
+		return workload.Measure(w, iterations, opts)
+	}
+	result, _, err := m.simulate(w, iterations, opts.Warmup)
+	return result, err
+}
+
+// simulate replays a workload on a fresh hierarchy of Config.Simulate and
+// returns the simulated result with the hierarchy's counts
+func (m *MemTester) simulate(w workload.Workload, iterations, warmup int) (workload.Result, memsim.Stats, error) {
+	h, err := memsim.New(*m.Config.Simulate)
+	if err != nil {
+		return workload.Result{}, memsim.Stats{}, err
+	}
+	result, err := workload.Simulate(w, iterations, warmup, h)
+	return result, h.Stats(), err
+}
+
+// PrintSimulationStats prints where the loads of simulated workloads were
+// served, one row per workload
+func (m *MemTester) PrintSimulationStats(names []string, stats []memsim.Stats) {
+	if len(stats) == 0 {
+		return
+	}
+	levels := len(stats[0].Levels)
+	fmt.Println("\n==== Simulated Hit Rates ====")
+	header := fmt.Sprintf("%-28s", "Workload")
+	for i := 0; i < levels; i++ {
+		header += fmt.Sprintf(" %7s", fmt.Sprintf("L%d", i+1))
+	}
+	fmt.Printf("%s %7s %9s %11s\n", header, "Memory", "TLB miss", "Prefetched")
+	fmt.Println(strings.Repeat("-", len(header)+30))
+	for i, s := range stats {
+		row := fmt.Sprintf("%-28s", names[i])
+		for _, level := range s.Levels {
+			row += fmt.Sprintf(" %6.1f%%", 100*level.HitRate())
+		}
+		fmt.Printf("%s %6.1f%% %8.1f%% %10.1f%%\n", row,
+			percent(s.MemoryLoads, s.Loads), percent(s.TLBMisses, s.Loads), percent(s.UsefulPrefetches, s.Loads))
+	}
+	fmt.Println("Note: level hit rates are of the loads that reached the level; the other columns are of all loads.")
+}
+
+// percent returns part as a percentage of total, 0 when total is 0
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
@@ -0,0 +1,213 @@
+package test2
+
+import (
+	"app/pkg/memsim"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// simulatedTester returns a tester that runs the detection tests on a
+// simulated CPU
+func simulatedTester(t *testing.T, spec string) *MemTester {
+	t.Helper()
+	sim, err := memsim.Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewDefaultConfig()
+	config.Simulate = &sim
+	config.LineSize = sim.LineSize
+	config.Iterations = 100000
+	config.SizeInMB = 16
+	return NewMemTester(config)
+}
+
+// within reports whether got is within a factor of tolerance of want
+func within(got, want, tolerance float64) bool {
+	return got >= want/tolerance && got <= want*tolerance
+}
+
+func TestDetectCacheLevelsSimulated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("simulates a latency curve up to 128 MB")
+	}
+	for _, name := range []string{"skylake", "zen3", "m1"} {
+		t.Run(name, func(t *testing.T) {
+			m := simulatedTester(t, name)
+			sim := m.Config.Simulate
+			m.Config.CacheMaxMB = 4 * sim.Caches[len(sim.Caches)-1].Size >> 20
+
+			levels := m.DetectCacheLevels().Levels
+			if len(levels) != len(sim.Caches)+1 {
+				t.Fatalf("found %d levels %+v, want %d caches and memory", len(levels), levels, len(sim.Caches))
+			}
+			for i, cache := range sim.Caches {
+				// Sizes are on a curve of eight sizes per doubling
+				level := levels[i]
+				if !within(float64(level.Size), float64(cache.Size), math.Pow(2, 2.0/cacheCurveSteps)) {
+					t.Errorf("%s is %s, want %s", level.Name, formatSize(level.Size), formatSize(cache.Size))
+				}
+				if !within(level.LatencyNs, cache.LatencyNs, 1.25) {
+					t.Errorf("%s latency is %.2f ns, want %.2f ns", level.Name, level.LatencyNs, cache.LatencyNs)
+				}
+			}
+			memory := levels[len(levels)-1]
+			if memory.Name != "Memory" || !within(memory.LatencyNs, sim.MemoryNs, 1.25) {
+				t.Errorf("last level is %s at %.2f ns, want Memory at %.2f ns", memory.Name, memory.LatencyNs, sim.MemoryNs)
+			}
+		})
+	}
+}
+
+func TestAnalyzePrefetchersSimulated(t *testing.T) {
+	verdicts := func(spec string) map[string]PrefetchVerdict {
+		report := simulatedTester(t, spec).AnalyzePrefetchers()
+		found := make(map[string]PrefetchVerdict)
+		for _, result := range report.Results {
+			found[result.Type] = result.Verdict
+		}
+		return found
+	}
+
+	// The simulated prefetcher follows strides within a page in both
+	// directions
+	with := verdicts("skylake")
+	for _, kind := range []string{"forward-stream", "backward-stream", "stride-2-lines", "interleaved-2-streams"} {
+		if with[kind] != PrefetchDetected {
+			t.Errorf("skylake: %s %s, want %s", kind, with[kind], PrefetchDetected)
+		}
+	}
+
+	// Without it, no pattern is faster than the random walk. Every pattern
+	// still uses each page for several loads, which spares TLB misses.
+	without := verdicts("skylake,prefetch=0")
+	for kind, verdict := range without {
+		if verdict == PrefetchDetected {
+			t.Errorf("skylake without prefetcher: %s %s", kind, verdict)
+		}
+	}
+	if len(without) != len(with) {
+		t.Errorf("reports have %d and %d patterns", len(with), len(without))
+	}
+}
+
+func TestDetectAssociativitySimulated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates conflict strides of the L3 size")
+	}
+	// Each level has at least the ways of the one below, whose hits would
+	// otherwise hide its conflicts. Strides of the L3 size fill a single
+	// TLB set, whose ways would be found first, so the TLB is left out.
+	for _, name := range []string{"zen3", "m1"} {
+		t.Run(name, func(t *testing.T) {
+			m := simulatedTester(t, name+",tlb=0")
+			sim := m.Config.Simulate
+			m.Config.Iterations = 20000
+
+			// Measured sizes off the way size grid, which the simulated
+			// sizes replace
+			var measured CacheSizes
+			for i, size := range []*int{&measured.L1, &measured.L2, &measured.L3} {
+				if i < len(sim.Caches) {
+					*size = sim.Caches[i].Size * 109 / 100
+					m.Config.SizeInMB = max(m.Config.SizeInMB, (sim.Caches[i].Ways+2)*sim.Caches[i].Size>>20)
+				}
+			}
+
+			ways := m.DetectAssociativity(measured)
+			for i, got := range []int{ways.L1, ways.L2, ways.L3}[:len(sim.Caches)] {
+				if want := sim.Caches[i].Ways; got != want {
+					t.Errorf("L%d is %d-way, want %d-way", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConflictStride(t *testing.T) {
+	tests := []struct{ size, want int }{
+		{0, 0},
+		{1000, 4096},
+		{32768, 32768},
+		{35712, 65536}, // a curve size between 32K and 64K
+		{1280 << 10, 2 << 20},
+	}
+	for _, test := range tests {
+		if got := conflictStride(test.size); got != test.want {
+			t.Errorf("conflictStride(%d) = %d, want %d", test.size, got, test.want)
+		}
+	}
+}
+
+func TestPrefetchDistanceSimulated(t *testing.T) {
+	// The simulated prefetcher fetches a fixed number of lines ahead of a
+	// confirmed stream into the L2
+	for _, distance := range []int{0, 2, 8, 12, 24} {
+		spec := fmt.Sprintf("skylake,prefetch=16/%d/2", distance)
+		if distance == 0 {
+			spec = "skylake,prefetch=0"
+		}
+		t.Run(spec, func(t *testing.T) {
+			m := simulatedTester(t, spec)
+			m.Config.Iterations = 20000
+			report := m.AnalyzePrefetchers()
+			if report.DistanceLines != distance {
+				t.Errorf("estimated distance %d lines, want %d: %+v", report.DistanceLines, distance, report.Probes)
+			}
+		})
+	}
+}
+
+func TestPrefetchDistance(t *testing.T) {
+	probe := func(ahead int, cold, trained float64) PrefetchProbe {
+		return PrefetchProbe{Ahead: ahead, ColdNs: cold, TrainedNs: trained}
+	}
+	tests := []struct {
+		name   string
+		probes []PrefetchProbe
+		want   int
+	}{
+		{"no probes", nil, 0},
+		{"nothing cached", []PrefetchProbe{probe(1, 20, 19), probe(2, 20, 20)}, 0},
+		{"all cached", []PrefetchProbe{probe(1, 20, 10), probe(2, 20, 11), probe(4, 20, 10)}, 4},
+		{"last cached", []PrefetchProbe{probe(1, 20, 10), probe(2, 20, 12), probe(4, 20, 18), probe(6, 20, 10)}, 2},
+	}
+	for _, test := range tests {
+		if got := prefetchDistance(test.probes); got != test.want {
+			t.Errorf("%s: prefetchDistance() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProbeOrder(t *testing.T) {
+	for _, probeFirst := range []bool{false, true} {
+		order := probeOrder(3, 64, 6, probeFirst)
+		if len(order) != 3*(probeTrainLines+1) {
+			t.Fatalf("%d loads, want %d", len(order), 3*(probeTrainLines+1))
+		}
+		// Every block is a training stream of consecutive lines and a probe
+		// ahead lines past its end
+		seen := make(map[int]bool)
+		for i := 0; i < len(order); i += probeTrainLines + 1 {
+			block := order[i : i+probeTrainLines+1]
+			probe, stream := block[len(block)-1], block[:probeTrainLines]
+			if probeFirst {
+				probe, stream = block[0], block[1:]
+			}
+			first := stream[0]
+			if first%(probePageSize/8) != 0 || seen[first] {
+				t.Fatalf("stream starts at word %d in %v", first, order)
+			}
+			seen[first] = true
+			for line, index := range stream {
+				if index != first+line*8 {
+					t.Errorf("stream %v is not consecutive lines", stream)
+				}
+			}
+			if probe != first+(probeTrainLines-1+6)*8 {
+				t.Errorf("probe at word %d after stream %v", probe, stream)
+			}
+		}
+	}
+}
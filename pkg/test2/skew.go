@@ -0,0 +1,190 @@
+package test2
+
+import (
+	"app/pkg/dryrun"
+	"app/pkg/skew"
+	"app/pkg/workload"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// skewSampleDraws is the number of draws the ideal hit rates are taken from
+const skewSampleDraws = 1 << 22
+
+// SkewResult holds the measurements of one access distribution
+type SkewResult struct {
+	Spec          skew.Spec
+	DependentNs   float64   // ns per load when every load waits for the previous one
+	IndependentNs float64   // ns per load when the CPU may overlap them
+	Saved         float64   // share of the uniform dependent latency the skew saves
+	IdealHitRates []float64 // share of loads on the hottest lines that fit each cache, see SkewReport.Caches
+	HitRates      []float64 // share of dependent loads each simulated cache served, nil on real hardware
+}
+
+// SkewReport is the structured result of AnalyzeSkew
+type SkewReport struct {
+	BufferSize int
+	LineSize   int
+	Caches     []int   // cache sizes from L1 up the ideal hit rates are computed for
+	UniformNs  float64 // dependent latency of uniform loads, the baseline of Saved
+	Results    []SkewResult
+}
+
+// AnalyzeSkew loads the -size buffer, one node per cache line, in the
+// orders of every distribution in Config.SkewPatterns and compares them
+// with uniform loads. Each distribution runs as a dependent walk for its
+// latency and as independent loads. The ideal hit rates show what share of
+// the loads a cache of each level's size could serve at best, by holding
+// the lines drawn most often.
+func (m *MemTester) AnalyzeSkew() SkewReport {
+	size := m.Config.SizeInMB * 1024 * 1024
+	lineSize := m.cacheLineSize()
+	report := SkewReport{BufferSize: size, LineSize: lineSize, Caches: m.skewCacheSizes()}
+
+	// measure returns the latency of a skewed workload and, on a simulated
+	// CPU, the share of its loads every cache served
+	measure := func(name string, spec skew.Spec) (float64, []float64) {
+		params := m.workloadParams(size)
+		params.Skew = spec
+		w, err := workload.New(name, params)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", name, err)
+			return 0, nil
+		}
+		if m.Config.Simulate == nil {
+			result, _ := m.run(w, m.Config.Iterations, m.Config.Iterations)
+			return result.NsPerOp(), nil
+		}
+		result, stats, err := m.simulate(w, m.Config.Iterations, m.Config.Iterations)
+		if err != nil {
+			fmt.Printf("Skipping %v\n", err)
+			return 0, nil
+		}
+		hitRates := make([]float64, len(stats.Levels))
+		for i, level := range stats.Levels {
+			hitRates[i] = float64(level.Hits) / float64(max(1, stats.Loads))
+		}
+		return result.NsPerOp(), hitRates
+	}
+
+	uniform := skew.Spec{Kind: skew.Uniform}
+	var uniformHitRates []float64
+	report.UniformNs, uniformHitRates = measure("access/skewed-dependent", uniform)
+	lines := size / lineSize
+	top := make([]int, len(report.Caches))
+	for i, c := range report.Caches {
+		top[i] = c / lineSize
+	}
+
+	for _, spec := range m.Config.SkewPatterns {
+		if !m.selected(skewTestName(spec)) {
+			continue
+		}
+		result := SkewResult{Spec: spec, DependentNs: report.UniformNs, HitRates: uniformHitRates}
+		if spec != uniform {
+			result.DependentNs, result.HitRates = measure("access/skewed-dependent", spec)
+		}
+		result.IndependentNs, _ = measure("access/skewed", spec)
+		if report.UniformNs > 0 {
+			result.Saved = 1 - result.DependentNs/report.UniformNs
+		}
+		if g, err := skew.New(spec, lines); err == nil {
+			draws := make([]int32, skewSampleDraws)
+			skew.Fill(g, draws)
+			result.IdealHitRates = skew.TopShare(draws, lines, top)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// skewCacheSizes returns the cache sizes the ideal hit rates are computed
+// for: the simulated ones, or those sysfs reports with typical sizes for
+// the levels it does not list
+func (m *MemTester) skewCacheSizes() []int {
+	if sim := m.Config.Simulate; sim != nil {
+		sizes := make([]int, len(sim.Caches))
+		for i, c := range sim.Caches {
+			sizes[i] = c.Size
+		}
+		return sizes
+	}
+	sizes := m.expectedCacheSizes()
+	return []int{sizes.L1, sizes.L2, sizes.L3}
+}
+
+// skewStep models AnalyzeSkew for the dry run. Every run draws its stream
+// and, for Zipf, tabulates the distribution before it warms up and times
+// the walk.
+func (m *MemTester) skewStep(cal dryrun.Calibration) dryrun.Step {
+	size := int64(m.Config.SizeInMB) * 1024 * 1024
+	lines := size / int64(m.cacheLineSize())
+	iterations := int64(m.Config.Iterations)
+	timing := m.timing()
+	runs, patterns := m.skewRuns()
+
+	run := cal.FirstTouch(size) + cal.Shuffle(lines+workload.SkewedStream) + cal.Chase(iterations, size) +
+		timing.Duration(cal.Chase(iterations, size))
+	return dryrun.Step{
+		Name:       "Skewed Access Analysis",
+		WorkingSet: formatSize(int(size)),
+		Iterations: runs * timing.Iterations(iterations),
+		Threads:    1,
+		PeakBytes:  size + 4*workload.SkewedStream + 12*lines,
+		Duration:   time.Duration(runs)*run + time.Duration(patterns)*cal.Shuffle(skewSampleDraws),
+	}
+}
+
+// skewRuns returns the number of workload runs of AnalyzeSkew, two per
+// selected distribution and the uniform baseline, which the uniform
+// distribution reuses, and the number of distributions
+func (m *MemTester) skewRuns() (runs, patterns int64) {
+	runs = 1
+	for _, spec := range m.Config.SkewPatterns {
+		if !m.selected(skewTestName(spec)) {
+			continue
+		}
+		patterns++
+		runs += 2
+		if spec.Kind == skew.Uniform {
+			runs--
+		}
+	}
+	return runs, patterns
+}
+
+// PrintSkewReport prints a skew report as a table
+func (m *MemTester) PrintSkewReport(report SkewReport) {
+	fmt.Println("\n==== Skewed Access Analysis ====")
+	fmt.Printf("Buffer: %s, line size: %d B, uniform dependent latency: %.2f ns\n",
+		formatSize(report.BufferSize), report.LineSize, report.UniformNs)
+	header := fmt.Sprintf("%-24s %12s %12s %7s", "Distribution", "dependent", "independent", "saved")
+	for i, c := range report.Caches {
+		header += fmt.Sprintf(" %12s", fmt.Sprintf("L%d %s", i+1, formatSize(c)))
+	}
+	simulated := len(report.Results) > 0 && report.Results[0].HitRates != nil
+	if simulated {
+		for i := range report.Caches {
+			header += fmt.Sprintf(" %8s", fmt.Sprintf("L%d hits", i+1))
+		}
+	}
+	fmt.Println(header)
+	fmt.Println(strings.Repeat("-", len(header)))
+	for _, r := range report.Results {
+		row := fmt.Sprintf("%-24s %9.2f ns %9.2f ns %6.1f%%", r.Spec, r.DependentNs, r.IndependentNs, 100*r.Saved)
+		for _, rate := range r.IdealHitRates {
+			row += fmt.Sprintf(" %11.1f%%", 100*rate)
+		}
+		for _, rate := range r.HitRates {
+			row += fmt.Sprintf(" %7.1f%%", 100*rate)
+		}
+		fmt.Println(row)
+	}
+	fmt.Println("Note: L1 to Ln with sizes are ideal hit rates, the share of loads on the hottest lines that fit the cache.")
+	if simulated {
+		fmt.Println("The hits columns are the share of dependent loads each simulated cache served.")
+	} else {
+		fmt.Println("Saved is the share of the uniform latency the skew saves; -simulate also shows the hits of each cache.")
+	}
+}
@@ -0,0 +1,93 @@
+package test2
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysfsCacheDir is where Linux describes the caches of the first CPU
+const sysfsCacheDir = "/sys/devices/system/cpu/cpu0/cache"
+
+// SysfsCache describes one cache as reported by the Linux sysfs tree
+type SysfsCache struct {
+	Level    int
+	Type     string // "Data", "Instruction" or "Unified"
+	Size     int    // in bytes
+	Ways     int
+	LineSize int
+}
+
+// ReadSysfsCaches reads the cache descriptions below dir (normally
+// /sys/devices/system/cpu/cpu0/cache). It returns nil when the tree
+// is not available, e.g. on non-Linux systems.
+func ReadSysfsCaches(dir string) []SysfsCache {
+	entries, err := filepath.Glob(filepath.Join(dir, "index*"))
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	sort.Strings(entries)
+
+	var caches []SysfsCache
+	for _, entry := range entries {
+		level, err := strconv.Atoi(readSysfsString(entry, "level"))
+		if err != nil {
+			continue
+		}
+		ways, _ := strconv.Atoi(readSysfsString(entry, "ways_of_associativity"))
+		lineSize, _ := strconv.Atoi(readSysfsString(entry, "coherency_line_size"))
+		caches = append(caches, SysfsCache{
+			Level:    level,
+			Type:     readSysfsString(entry, "type"),
+			Size:     parseSysfsSize(readSysfsString(entry, "size")),
+			Ways:     ways,
+			LineSize: lineSize,
+		})
+	}
+	return caches
+}
+
+// sysfsDataCache returns the data or unified cache at the given level
+func sysfsDataCache(caches []SysfsCache, level int) (SysfsCache, bool) {
+	for _, c := range caches {
+		if c.Level == level && c.Type != "Instruction" {
+			return c, true
+		}
+	}
+	return SysfsCache{}, false
+}
+
+// readSysfsString reads a single-value sysfs attribute, returning "" on error
+func readSysfsString(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// parseSysfsSize converts sysfs sizes such as "32K" or "8M" into bytes
+func parseSysfsSize(s string) int {
+	if s == "" {
+		return 0
+	}
+	multiplier := 1
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1024
+		s = s[:len(s)-1]
+	case 'M':
+		multiplier = 1024 * 1024
+		s = s[:len(s)-1]
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n * multiplier
+}
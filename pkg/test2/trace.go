@@ -0,0 +1,71 @@
+package test2
+
+import (
+	"app/pkg/trace"
+	"app/pkg/workload"
+	"fmt"
+	"os"
+)
+
+// maxTraceLoads caps the loads RecordTrace keeps, 128 MB of offsets in
+// memory and about 64 MB in the file for a random walk
+const maxTraceLoads = 1 << 24
+
+// RecordTrace records a workload over a -size buffer and saves it to path,
+// see trace.Save. Like RunWorkloads it runs as many operations as touch the
+// bytes of Config.Iterations 8-byte loads, after a warm-up of 1000 loads'
+// worth like the basic tests, and keeps at most maxTraceLoads loads. For
+// example "pointer-chase" records the walk of PointerChasingTest and
+// "chain/stride-4" one of the prefetcher patterns.
+func (m *MemTester) RecordTrace(name, path string) error {
+	w, err := workload.New(name, m.workloadParams(m.Config.SizeInMB*1024*1024))
+	if err != nil {
+		return err
+	}
+	info := w.Info()
+	t, err := workload.Record(w, m.workloadIterations(info), operations(1000, info), maxTraceLoads)
+	if err != nil {
+		return err
+	}
+	if err := trace.Save(path, t); err != nil {
+		return err
+	}
+
+	fmt.Println("\n==== Trace Recording ====")
+	fmt.Printf("Recorded %d loads of %s over %s to %s", len(t.Offsets), t.Name, formatSize(t.Size), path)
+	if info, err := os.Stat(path); err == nil && len(t.Offsets) > 0 {
+		fmt.Printf(" (%s, %.2f bytes/load)", formatSize(int(info.Size())), float64(info.Size())/float64(len(t.Offsets)))
+	}
+	fmt.Println()
+	if len(t.Offsets) == maxTraceLoads {
+		fmt.Printf("Stopped at the limit of %d loads\n", maxTraceLoads)
+	}
+	return nil
+}
+
+// ReplayTrace loads a trace file in the binary or text format and times
+// one pass over it after a warm-up pass, first with every load depending
+// on the previous one for its latency, then with independent loads that
+// the CPU may overlap
+func (m *MemTester) ReplayTrace(path string) error {
+	t, err := trace.Load(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n==== Trace Replay ====")
+	fmt.Printf("Trace: %s, %d loads over %s\n", t.Name, len(t.Offsets), formatSize(t.Size))
+	for _, dependent := range []bool{true, false} {
+		w := workload.NewReplay(t, m.workloadParams(t.Size), dependent)
+		result, ok := m.run(w, len(t.Offsets), len(t.Offsets))
+		if !ok {
+			continue
+		}
+		label := "Dependent loads (latency)"
+		if !dependent {
+			label = "Independent loads (throughput)"
+		}
+		fmt.Printf("%-31s %.2f ns/load%s%s\n", label+":", result.NsPerOp(), result.Cycles(), result.Spread())
+	}
+	return nil
+}
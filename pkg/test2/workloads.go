@@ -0,0 +1,231 @@
+package test2
+
+import (
+	"app/pkg/dryrun"
+	"app/pkg/memsim"
+	"app/pkg/timer"
+	"app/pkg/workload"
+	"fmt"
+)
+
+// workloadGroup is the test group of RunWorkloads
+const workloadGroup = "workload"
+
+// workloadParams returns the parameters of a workload over size bytes with
+// one node per cache line
+func (m *MemTester) workloadParams(size int) workload.Params {
+	return workload.Params{Size: size, NodeSize: m.cacheLineSize(), Alloc: m.Config.Alloc, Verify: m.Config.VerifyChains}
+}
+
+// measure creates the named workload and runs it through the harness
+func (m *MemTester) measure(name string, size, iterations, warmup int) (workload.Result, bool) {
+	w, err := workload.New(name, m.workloadParams(size))
+	if err != nil {
+		fmt.Printf("Skipping %s: %v\n", name, err)
+		return workload.Result{}, false
+	}
+	return m.run(w, iterations, warmup)
+}
+
+// run times a workload with the configured number of repetitions and
+// warns when the loop overhead dominates the result
+func (m *MemTester) run(w workload.Workload, iterations, warmup int) (workload.Result, bool) {
+	result, err := m.measureWorkload(w, iterations, m.measureOptions(warmup))
+	if err != nil {
+		fmt.Printf("Skipping %v\n", err)
+		return result, false
+	}
+	if warning := result.Warning(); warning != "" {
+		fmt.Println(warning)
+	}
+	return result, true
+}
+
+// measurementOverhead measures the loop and RNG baselines once and prints
+// them, since every latency result has them subtracted
+func (m *MemTester) measurementOverhead() *workload.Overhead {
+	if m.overhead == nil {
+		overhead := workload.MeasureOverhead(m.measurementTimer())
+		m.overhead = &overhead
+		fmt.Printf("Measurement overhead: %s (loop overhead subtracted from independent-load latencies)\n", overhead)
+	}
+	return m.overhead
+}
+
+// measurementTimer sets up the configured timer and finds the core
+// frequency once, printing both with the timer's resolution and overhead
+func (m *MemTester) measurementTimer() *timer.Timer {
+	if m.clock != nil {
+		return m.clock
+	}
+	clock, err := timer.New(m.Config.Timer)
+	if err != nil {
+		fmt.Printf("Timer %v, using the monotonic clock\n", err)
+		clock = timer.NewMonotonic()
+	}
+	m.clock = clock
+	fmt.Printf("Timer: %s, %s\n", clock, clock.Calibrate())
+
+	if frequency, err := timer.CoreFrequency(m.Config.FrequencySource); err != nil {
+		fmt.Printf("Core frequency unknown (%v), latencies are reported in ns only\n", err)
+	} else {
+		m.frequency = &frequency
+		fmt.Printf("Core frequency: %s\n", frequency)
+	}
+	return clock
+}
+
+// cycles describes ns in core cycles, e.g. " (251.3 cycles)" or
+// " (12.6M cycles)", and is empty when the core frequency is unknown
+func (m *MemTester) cycles(ns float64) string {
+	if m.frequency == nil {
+		return ""
+	}
+	cycles := m.frequency.Cycles(ns)
+	if cycles >= 1e6 {
+		return fmt.Sprintf(" (%.1fM cycles)", cycles/1e6)
+	}
+	return fmt.Sprintf(" (%.1f cycles)", cycles)
+}
+
+// measureOptions returns the harness options of every measurement
+func (m *MemTester) measureOptions(warmup int) workload.Options {
+	// Simulated loads are not timed, see measureWorkload
+	if m.Config.Simulate != nil {
+		return workload.Options{Warmup: warmup}
+	}
+	// The timer is set up first, since that also finds the frequency
+	clock := m.measurementTimer()
+	return workload.Options{
+		Warmup:      warmup,
+		Repetitions: m.Config.Repetitions,
+		Overhead:    m.measurementOverhead(),
+		Target:      m.Config.TargetTime,
+		Timer:       clock,
+		Frequency:   m.frequency,
+	}
+}
+
+// workloadTestName names one registered workload run by RunWorkloads
+func workloadTestName(name string) string {
+	return workloadGroup + "/" + name
+}
+
+// workloadIterations returns the operations RunWorkloads times for a
+// workload: as many bytes as Config.Iterations 8-byte loads, at least one
+// operation
+func (m *MemTester) workloadIterations(info workload.Info) int {
+	return operations(m.Config.Iterations, info)
+}
+
+// operations returns the operations of a workload that touch as many bytes
+// as the given number of 8-byte loads, at least one
+func operations(loads int, info workload.Info) int {
+	return max(1, loads*8/max(1, info.BytesPerOp))
+}
+
+// RunWorkloads runs every registered workload that Config.Filter selects
+// over a -size buffer, including ones registered by other packages, and
+// prints them as one table
+func (m *MemTester) RunWorkloads() {
+	var results []workload.Result
+	var simulated []memsim.Stats
+	for _, name := range workload.Names() {
+		if !m.selected(workloadTestName(name)) {
+			continue
+		}
+		w, err := workload.New(name, m.workloadParams(m.Config.SizeInMB*1024*1024))
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", name, err)
+			continue
+		}
+		iterations := m.workloadIterations(w.Info())
+		var result workload.Result
+		if m.Config.Simulate != nil {
+			var stats memsim.Stats
+			result, stats, err = m.simulate(w, iterations, iterations/10)
+			if err == nil {
+				simulated = append(simulated, stats)
+			}
+		} else {
+			result, err = workload.Measure(w, iterations, m.measureOptions(iterations/10))
+		}
+		if err != nil {
+			fmt.Printf("Skipping %v\n", err)
+			continue
+		}
+		results = append(results, result)
+	}
+
+	// The report prints the overhead warnings below the table
+	workload.Report("Registered Workloads", results)
+	if len(simulated) > 0 {
+		names := make([]string, len(results))
+		for i, r := range results {
+			names[i] = r.Info.Name
+		}
+		m.PrintSimulationStats(names, simulated)
+	}
+}
+
+// workloadsStep models RunWorkloads for the dry run. Registered workloads
+// can do anything, so only their working sets are known.
+func (m *MemTester) workloadsStep() dryrun.Step {
+	size := m.Config.SizeInMB * 1024 * 1024
+	step := dryrun.Step{Name: "Registered Workloads", WorkingSet: formatSize(size), Threads: 1}
+	for _, name := range workload.Names() {
+		if !m.selected(workloadTestName(name)) {
+			continue
+		}
+		if w, err := workload.New(name, m.workloadParams(size)); err == nil {
+			step.PeakBytes = max(step.PeakBytes, int64(w.Info().WorkingSet))
+		}
+	}
+	return step
+}
+
+// orderChain links words of a shared buffer into one cycle in the given
+// order, for walks that leave most of the buffer out, such as the lines
+// of one cache set. Every operation is one dependent load.
+type orderChain struct {
+	name   string
+	buffer []int64
+	order  []int // word indices, each at most once
+	next   int64 // index of the next word to load
+}
+
+// Info describes the chain
+func (c *orderChain) Info() workload.Info {
+	return workload.Info{Name: c.name, Unit: workload.NsPerOp, WorkingSet: len(c.buffer) * 8, BytesPerOp: 8, Dependent: true}
+}
+
+// Setup links the words
+func (c *orderChain) Setup() error {
+	for i, word := range c.order {
+		c.buffer[word] = int64(c.order[(i+1)%len(c.order)])
+	}
+	c.next = int64(c.order[0])
+	return nil
+}
+
+// Run follows the chain for the given number of loads
+func (c *orderChain) Run(iterations int) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		j = c.buffer[j]
+	}
+	c.next = j
+}
+
+// Trace reports the loads of Run
+func (c *orderChain) Trace(iterations int, load func(offset int)) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		load(int(j) * 8)
+		j = c.buffer[j]
+	}
+	c.next = j
+}
+
+// Teardown leaves the shared buffer to its owner
+func (c *orderChain) Teardown() {}
@@ -0,0 +1,101 @@
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How the core frequency is found
+const (
+	FrequencyMeasured = "measured" // timing a chain of dependent additions
+	FrequencySysfs    = "sysfs"    // reading cpufreq, which may lag turbo changes
+)
+
+// SysfsCPUFreqDir is where Linux describes the frequency of the first CPU
+const SysfsCPUFreqDir = "/sys/devices/system/cpu/cpu0/cpufreq"
+
+// addChainLength is the number of dependent additions per addChain round
+const addChainLength = 16
+
+// Frequency is the clock frequency of a core
+type Frequency struct {
+	Hz     float64
+	Source string // FrequencyMeasured or FrequencySysfs
+}
+
+// CoreFrequency finds the core frequency the way source names
+func CoreFrequency(source string) (Frequency, error) {
+	switch source {
+	case FrequencyMeasured:
+		return MeasureFrequency()
+	case FrequencySysfs:
+		return SysfsFrequency(SysfsCPUFreqDir)
+	}
+	return Frequency{}, fmt.Errorf("unknown frequency source %q (want %s or %s)", source, FrequencyMeasured, FrequencySysfs)
+}
+
+// MeasureFrequency times a chain of dependent register additions, each of
+// which takes one cycle on every core this runs on, and returns the
+// fastest of several runs. Unlike sysfs it sees the frequency the core
+// actually runs at while busy, turbo included.
+func MeasureFrequency() (Frequency, error) {
+	const (
+		runs   = 5
+		rounds = 1000000
+	)
+	if addChain(1) != addChainLength {
+		return Frequency{}, ErrUnsupported
+	}
+
+	// Ramp the core up before timing it
+	addChain(100 * rounds)
+
+	best := time.Duration(0)
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		addChain(rounds)
+		if elapsed := time.Since(start); i == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	if best <= 0 {
+		return Frequency{}, errors.New("addition chain took no measurable time")
+	}
+	return Frequency{Hz: addChainLength * rounds / best.Seconds(), Source: FrequencyMeasured}, nil
+}
+
+// SysfsFrequency reads the current frequency below dir (normally
+// /sys/devices/system/cpu/cpu0/cpufreq), falling back to the maximum
+// when the current one is not reported
+func SysfsFrequency(dir string) (Frequency, error) {
+	var lastErr error
+	for _, name := range []string{"scaling_cur_freq", "cpuinfo_cur_freq", "cpuinfo_max_freq"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		khz, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil || khz <= 0 {
+			lastErr = fmt.Errorf("%s: invalid frequency %q", name, strings.TrimSpace(string(data)))
+			continue
+		}
+		return Frequency{Hz: khz * 1000, Source: FrequencySysfs}, nil
+	}
+	return Frequency{}, lastErr
+}
+
+// Cycles converts nanoseconds to core cycles
+func (f Frequency) Cycles(ns float64) float64 {
+	return ns * f.Hz / 1e9
+}
+
+// String formats the frequency and its source, e.g. "3.20 GHz (measured)"
+func (f Frequency) String() string {
+	return fmt.Sprintf("%.2f GHz (%s)", f.Hz/1e9, f.Source)
+}
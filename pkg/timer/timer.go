@@ -0,0 +1,193 @@
+// Package timer reads the clocks measurements are timed with: Go's
+// monotonic clock, the x86 time stamp counter or the arm64 virtual counter.
+// It also calibrates their resolution and read cost and finds the core
+// frequency, so results can be reported in cycles.
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind selects a timer backend
+type Kind string
+
+const (
+	Auto      Kind = "auto"      // the best invariant counter of this CPU, else Monotonic
+	Monotonic Kind = "monotonic" // Go's monotonic clock, as used by time.Now
+	TSC       Kind = "rdtsc"     // x86 time stamp counter read with LFENCE; RDTSC
+	TSCP      Kind = "rdtscp"    // x86 time stamp counter read with RDTSCP, after earlier loads
+	CNTVCT    Kind = "cntvct"    // arm64 virtual counter CNTVCT_EL0 read after ISB
+)
+
+// Kinds lists every timer kind in the order used by help texts
+var Kinds = []Kind{Auto, Monotonic, TSC, TSCP, CNTVCT}
+
+// ErrUnsupported is returned for timers this CPU or platform cannot provide
+var ErrUnsupported = errors.New("timer not supported on this platform")
+
+// frequencyProbe is how long a counter is compared with the monotonic
+// clock to find its frequency
+const frequencyProbe = 20 * time.Millisecond
+
+// ParseKind returns the timer kind with the given name
+func ParseKind(name string) (Kind, error) {
+	for _, k := range Kinds {
+		if string(k) == name {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown timer %q (want one of %s)", name, KindNames())
+}
+
+// KindNames returns the timer names separated by "|" for help texts
+func KindNames() string {
+	names := make([]string, len(Kinds))
+	for i, k := range Kinds {
+		names[i] = string(k)
+	}
+	return strings.Join(names, "|")
+}
+
+// String implements flag.Value
+func (k *Kind) String() string {
+	if k == nil {
+		return ""
+	}
+	return string(*k)
+}
+
+// Set implements flag.Value
+func (k *Kind) Set(name string) error {
+	kind, err := ParseKind(name)
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
+
+// Timer reads one clock as a count of ticks
+type Timer struct {
+	Kind Kind
+	read func() uint64
+	hz   float64 // ticks per second
+}
+
+// New returns a timer of the given kind. Counters whose frequency the CPU
+// does not report are calibrated against the monotonic clock first.
+// Auto picks the first invariant counter of this platform, or the
+// monotonic clock when there is none.
+func New(kind Kind) (*Timer, error) {
+	switch kind {
+	case Auto:
+		for _, k := range autoKinds {
+			if t, err := New(k); err == nil && invariant() {
+				return t, nil
+			}
+		}
+		return NewMonotonic(), nil
+	case Monotonic:
+		return NewMonotonic(), nil
+	}
+
+	read, hz, err := counter(kind)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", kind, err)
+	}
+	if hz == 0 {
+		hz = counterFrequency(read)
+	}
+	return &Timer{Kind: kind, read: read, hz: hz}, nil
+}
+
+// NewMonotonic returns a timer of Go's monotonic clock, which counts
+// nanoseconds and is available everywhere
+func NewMonotonic() *Timer {
+	epoch := time.Now()
+	read := func() uint64 { return uint64(time.Since(epoch)) }
+	return &Timer{Kind: Monotonic, read: read, hz: 1e9}
+}
+
+// counterFrequency compares a counter with the monotonic clock while
+// spinning for frequencyProbe and returns its ticks per second
+func counterFrequency(read func() uint64) float64 {
+	start, ticks := time.Now(), read()
+	for time.Since(start) < frequencyProbe {
+	}
+	elapsed, ticks := time.Since(start), read()-ticks
+	return float64(ticks) / elapsed.Seconds()
+}
+
+// Now returns the current tick count
+func (t *Timer) Now() uint64 {
+	return t.read()
+}
+
+// Since returns the time passed since the tick count start
+func (t *Timer) Since(start uint64) time.Duration {
+	return t.Duration(t.read() - start)
+}
+
+// Duration converts a number of ticks to a duration
+func (t *Timer) Duration(ticks uint64) time.Duration {
+	return time.Duration(float64(ticks) * 1e9 / t.hz)
+}
+
+// Frequency returns the ticks per second of the timer
+func (t *Timer) Frequency() float64 {
+	return t.hz
+}
+
+// String names the timer and its frequency, e.g. "rdtscp at 2.90 GHz"
+func (t *Timer) String() string {
+	if t.Kind == Monotonic {
+		return string(t.Kind)
+	}
+	return fmt.Sprintf("%s at %.3f GHz", t.Kind, t.hz/1e9)
+}
+
+// Calibration is the resolution and read cost of a timer
+type Calibration struct {
+	ResolutionNs float64 // smallest nonzero step between two consecutive reads
+	OverheadNs   float64 // cost of one Now call
+}
+
+// Calibrate measures the resolution and read overhead of the timer. The
+// overhead is the fastest of several batches of back-to-back reads.
+func (t *Timer) Calibrate() Calibration {
+	const (
+		batches = 5
+		reads   = 100000
+	)
+	var cal Calibration
+
+	step := uint64(0)
+	for i, prev := 0, t.read(); i < reads; i++ {
+		now := t.read()
+		if d := now - prev; d > 0 && (step == 0 || d < step) {
+			step = d
+		}
+		prev = now
+	}
+	cal.ResolutionNs = float64(step) * 1e9 / t.hz
+
+	for b := 0; b < batches; b++ {
+		start := t.read()
+		for i := 0; i < reads; i++ {
+			t.read()
+		}
+		ns := float64(t.read()-start) * 1e9 / t.hz / reads
+		if b == 0 || ns < cal.OverheadNs {
+			cal.OverheadNs = ns
+		}
+	}
+	return cal
+}
+
+// String summarizes the calibration for reports
+func (c Calibration) String() string {
+	return fmt.Sprintf("resolution %.2f ns, overhead %.2f ns/read", c.ResolutionNs, c.OverheadNs)
+}
@@ -0,0 +1,57 @@
+package timer
+
+// autoKinds are the counters Auto tries, in order
+var autoKinds = []Kind{TSCP, TSC}
+
+// rdtsc reads the time stamp counter once every earlier instruction has
+// completed
+func rdtsc() uint64
+
+// rdtscp reads the time stamp counter once every earlier load is done
+func rdtscp() uint64
+
+// cpuid executes CPUID for a leaf with subleaf 0
+func cpuid(leaf uint32) (eax, ebx, ecx, edx uint32)
+
+// addChain runs n rounds of 16 dependent register additions and returns
+// the sum. Additions of an immediate are not used, since some cores fold
+// several of them into one operation.
+func addChain(n int) int
+
+// counter returns the read function of a time stamp counter timer. The
+// frequency is left to be calibrated, since CPUID reports it only on some
+// processors.
+func counter(kind Kind) (func() uint64, float64, error) {
+	switch kind {
+	case TSC:
+		if _, _, _, edx := cpuid(1); edx&(1<<4) == 0 {
+			return nil, 0, ErrUnsupported
+		}
+		return rdtsc, 0, nil
+	case TSCP:
+		if maxExtendedLeaf() < 0x80000001 {
+			return nil, 0, ErrUnsupported
+		}
+		if _, _, _, edx := cpuid(0x80000001); edx&(1<<27) == 0 {
+			return nil, 0, ErrUnsupported
+		}
+		return rdtscp, 0, nil
+	}
+	return nil, 0, ErrUnsupported
+}
+
+// invariant reports whether the time stamp counter ticks at a constant
+// rate in every power state, so it measures time rather than cycles
+func invariant() bool {
+	if maxExtendedLeaf() < 0x80000007 {
+		return false
+	}
+	_, _, _, edx := cpuid(0x80000007)
+	return edx&(1<<8) != 0
+}
+
+// maxExtendedLeaf returns the highest extended CPUID leaf
+func maxExtendedLeaf() uint32 {
+	eax, _, _, _ := cpuid(0x80000000)
+	return eax
+}
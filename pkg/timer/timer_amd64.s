@@ -0,0 +1,59 @@
+#include "textflag.h"
+
+// func rdtsc() uint64
+TEXT ·rdtsc(SB), NOSPLIT, $0-8
+	LFENCE
+	RDTSC
+	SHLQ	$32, DX
+	ORQ	DX, AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// func rdtscp() uint64
+TEXT ·rdtscp(SB), NOSPLIT, $0-8
+	RDTSCP
+	SHLQ	$32, DX
+	ORQ	DX, AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// func cpuid(leaf uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL	leaf+0(FP), AX
+	XORL	CX, CX
+	CPUID
+	MOVL	AX, eax+8(FP)
+	MOVL	BX, ebx+12(FP)
+	MOVL	CX, ecx+16(FP)
+	MOVL	DX, edx+20(FP)
+	RET
+
+// func addChain(n int) int
+TEXT ·addChain(SB), NOSPLIT, $0-16
+	MOVQ	n+0(FP), CX
+	XORQ	AX, AX
+	MOVQ	$1, DX
+	TESTQ	CX, CX
+	JLE	done
+loop:
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	ADDQ	DX, AX
+	DECQ	CX
+	JNZ	loop
+done:
+	MOVQ	AX, ret+8(FP)
+	RET
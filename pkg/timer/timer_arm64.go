@@ -0,0 +1,30 @@
+package timer
+
+// autoKinds are the counters Auto tries, in order
+var autoKinds = []Kind{CNTVCT}
+
+// cntvct reads the virtual counter once earlier instructions are done
+func cntvct() uint64
+
+// cntfrq reads the frequency of the virtual counter in Hz
+func cntfrq() uint64
+
+// addChain runs n rounds of 16 dependent register additions and returns
+// the sum. Additions of an immediate are not used, since some cores fold
+// several of them into one operation.
+func addChain(n int) int
+
+// counter returns the read function and frequency of the virtual counter
+// timer, calibrating the frequency when the firmware left CNTFRQ_EL0 unset
+func counter(kind Kind) (func() uint64, float64, error) {
+	if kind != CNTVCT {
+		return nil, 0, ErrUnsupported
+	}
+	return cntvct, float64(cntfrq()), nil
+}
+
+// invariant reports whether the counter ticks at a constant rate, which
+// the architecture guarantees for the generic timer
+func invariant() bool {
+	return true
+}
@@ -0,0 +1,44 @@
+#include "textflag.h"
+
+// func cntvct() uint64
+TEXT ·cntvct(SB), NOSPLIT, $0-8
+	ISB	$15
+	MRS	CNTVCT_EL0, R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+// func cntfrq() uint64
+TEXT ·cntfrq(SB), NOSPLIT, $0-8
+	MRS	CNTFRQ_EL0, R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+// func addChain(n int) int
+TEXT ·addChain(SB), NOSPLIT, $0-16
+	MOVD	n+0(FP), R1
+	MOVD	$0, R0
+	MOVD	$1, R2
+	CMP	$0, R1
+	BLE	done
+loop:
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	ADD	R2, R0
+	SUBS	$1, R1
+	BNE	loop
+done:
+	MOVD	R0, ret+8(FP)
+	RET
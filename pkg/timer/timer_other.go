@@ -0,0 +1,22 @@
+//go:build !amd64 && !arm64
+
+package timer
+
+// autoKinds is empty, only the monotonic clock is available
+var autoKinds []Kind
+
+// counter is only implemented on amd64 and arm64
+func counter(kind Kind) (func() uint64, float64, error) {
+	return nil, 0, ErrUnsupported
+}
+
+// invariant is only implemented on amd64 and arm64
+func invariant() bool {
+	return false
+}
+
+// addChain is only implemented on amd64 and arm64, where the loop is
+// written in assembly so its additions cannot be folded
+func addChain(n int) int {
+	return -1
+}
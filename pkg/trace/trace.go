@@ -0,0 +1,207 @@
+// Package trace stores the address streams of workloads. A trace is the
+// byte offset of every load into one buffer, in order. The binary format
+// keeps the difference to the previous offset as a zigzag varint, so
+// sequential and strided streams take one or two bytes per load and even
+// random ones over a large buffer rarely more than four. A plain text
+// format, one offset per line, brings in traces from other tools.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// magic starts every binary trace, followed by the format version
+const magic = "GMTRACE"
+
+// version is the binary format version written
+const version = 1
+
+// MaxSize is the largest buffer a trace may span. Read and ReadText reject
+// larger ones, which a corrupt file or addresses of unrelated mappings
+// would otherwise turn into an allocation of hundreds of GB on replay.
+const MaxSize = 64 << 30
+
+// Trace is the address stream of one workload
+type Trace struct {
+	Name    string // what the stream was recorded from, e.g. "pointer-chase"
+	Size    int    // bytes of the buffer the offsets fall in
+	Offsets []int  // byte offset of every load, in order
+}
+
+// New returns a trace of offsets, sized to hold the largest one
+func New(name string, offsets []int) *Trace {
+	t := &Trace{Name: name, Offsets: offsets}
+	for _, offset := range offsets {
+		t.Size = max(t.Size, offset+8)
+	}
+	return t
+}
+
+// Write writes the trace in the binary format
+func Write(w io.Writer, t *Trace) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	bw.WriteByte(version)
+
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	putUvarint(uint64(len(t.Name)))
+	bw.WriteString(t.Name)
+	putUvarint(uint64(t.Size))
+	putUvarint(uint64(len(t.Offsets)))
+
+	prev := 0
+	for _, offset := range t.Offsets {
+		bw.Write(buf[:binary.PutVarint(buf[:], int64(offset-prev))])
+		prev = offset
+	}
+	return bw.Flush()
+}
+
+// Read reads a trace in the binary format, or in the text format when it
+// does not start with the binary header, see ReadText
+func Read(r io.Reader) (*Trace, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(magic))
+	if err != nil || string(header) != magic {
+		return ReadText(br)
+	}
+	br.Discard(len(magic))
+	if v, err := br.ReadByte(); err != nil || v != version {
+		return nil, fmt.Errorf("unsupported trace version %d", v)
+	}
+
+	nameLen, err := binary.ReadUvarint(br)
+	if err != nil || nameLen > 1<<16 {
+		return nil, errors.New("corrupt trace header")
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, errors.New("corrupt trace header")
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, errors.New("corrupt trace header")
+	}
+	if size > MaxSize {
+		return nil, fmt.Errorf("trace buffer of %d bytes is larger than %d GB", size, MaxSize>>30)
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, errors.New("corrupt trace header")
+	}
+
+	// The count is only a hint for the allocation, a corrupt one must not
+	// exhaust memory
+	t := &Trace{Name: string(name), Size: int(size), Offsets: make([]int, 0, min(count, 1<<24))}
+	offset := 0
+	for i := uint64(0); i < count; i++ {
+		delta, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("trace ends after %d of %d loads", i, count)
+		}
+		offset += int(delta)
+		if offset < 0 || offset >= t.Size {
+			return nil, fmt.Errorf("load %d at offset %d is outside the %d byte buffer", i, offset, t.Size)
+		}
+		t.Offsets = append(t.Offsets, offset)
+	}
+	return t, nil
+}
+
+// ReadText reads a trace of one address per line, in decimal or in hex
+// with a 0x prefix, as other tools print them. Empty lines and lines
+// starting with # are skipped. The addresses are made offsets from the
+// lowest one, so absolute addresses of another process can be replayed on
+// a buffer of the same span.
+func ReadText(r io.Reader) (*Trace, error) {
+	scanner := bufio.NewScanner(r)
+	var addresses []uint64
+	lowest := ^uint64(0)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// Tools often add a size or an access type after the address
+		field := strings.Fields(strings.ReplaceAll(text, ",", " "))[0]
+		address, err := strconv.ParseUint(field, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, field)
+		}
+		addresses = append(addresses, address)
+		lowest = min(lowest, address)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("trace has no loads")
+	}
+
+	offsets := make([]int, len(addresses))
+	for i, address := range addresses {
+		if address-lowest >= MaxSize {
+			return nil, fmt.Errorf("addresses span more than %d GB", MaxSize>>30)
+		}
+		offsets[i] = int(address - lowest)
+	}
+	return New("", offsets), nil
+}
+
+// WriteText writes the offsets of a trace one per line, in hex
+func WriteText(w io.Writer, t *Trace) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s, %d bytes, %d loads\n", t.Name, t.Size, len(t.Offsets))
+	for _, offset := range t.Offsets {
+		fmt.Fprintf(bw, "%#x\n", offset)
+	}
+	return bw.Flush()
+}
+
+// Save writes a trace to a file, as text when its name ends in .txt and
+// in the binary format otherwise
+func Save(path string, t *Trace) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".txt") {
+		err = WriteText(f, t)
+	} else {
+		err = Write(f, t)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Load reads a trace file in either format. Traces without a name, such
+// as text ones, are named after the file.
+func Load(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return t, nil
+}
@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	want := New("chain/stride-4", []int{0, 256, 512, 4096, 8, 1 << 30})
+	for name, write := range map[string]func(*bytes.Buffer, *Trace) error{
+		"binary": func(b *bytes.Buffer, t *Trace) error { return Write(b, t) },
+		"text":   func(b *bytes.Buffer, t *Trace) error { return WriteText(b, t) },
+	} {
+		var b bytes.Buffer
+		if err := write(&b, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(&b)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Text traces do not keep the name
+		if name == "text" {
+			got.Name = want.Name
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestReadText(t *testing.T) {
+	got, err := ReadText(strings.NewReader("# from another tool\n0x7f0000001000 R 8\n\n0x7f0000000ff8,W\n139637985120256\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{8, 0, 0x800008}; !reflect.DeepEqual(got.Offsets, want) {
+		t.Errorf("offsets %#x, want %#x", got.Offsets, want)
+	}
+	if got.Size != 0x800010 {
+		t.Errorf("size %#x, want 0x800010", got.Size)
+	}
+}
+
+// header returns a binary trace header with the given buffer size and
+// number of loads
+func header(size, count uint64) []byte {
+	b := append([]byte(magic), version, 0)
+	b = binary.AppendUvarint(b, size)
+	return binary.AppendUvarint(b, count)
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"no loads", []byte("# nothing\n"), "no loads"},
+		{"invalid address", []byte("0x10\nnext\n"), "line 2"},
+		{"wide text span", []byte("0x1000\n0x1000001000\n"), "span more than 64 GB"},
+		{"version", []byte(magic + "\x09"), "version 9"},
+		{"huge buffer", header(1<<50, 1), "larger than 64 GB"},
+		{"negative buffer", header(^uint64(0), 1), "larger than 64 GB"},
+		{"truncated", header(64, 2), "ends after 0 of 2 loads"},
+		{"outside", binary.AppendVarint(header(64, 1), 64), "outside the 64 byte buffer"},
+		{"before start", binary.AppendVarint(header(64, 1), -8), "outside the 64 byte buffer"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(test.data)); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Read() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
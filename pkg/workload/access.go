@@ -0,0 +1,131 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+	"math/rand"
+)
+
+// maxIndexStream is the most random indices RandomAccess precomputes; Run
+// cycles through them
+const maxIndexStream = 1 << 20
+
+// arrayWorkload holds the int64 array shared by the indexed access workloads
+type arrayWorkload struct {
+	name   string
+	params Params
+
+	data   []int64
+	buffer *alloc.Buffer
+	sum    int64 // keeps the loads from being optimized away
+}
+
+// Info describes the array workload
+func (a *arrayWorkload) Info() Info {
+	return Info{Name: a.name, Unit: NsPerOp, WorkingSet: a.params.Size / 8 * 8, BytesPerOp: 8}
+}
+
+// Setup allocates the array and fills it with its indices
+func (a *arrayWorkload) Setup() error {
+	a.data, a.buffer = alloc.Make[int64](a.params.Alloc, max(1, a.params.Size/8))
+	for i := range a.data {
+		a.data[i] = int64(i)
+	}
+	return nil
+}
+
+// Teardown frees the array
+func (a *arrayWorkload) Teardown() {
+	a.buffer.Free()
+	a.data = nil
+}
+
+// RandomAccess reads array elements at random indices. The loads are
+// independent, so the CPU can overlap them. The indices are drawn before
+// timing and read sequentially from a stream of up to a million entries,
+// so the timed loop contains no RNG calls.
+type RandomAccess struct {
+	arrayWorkload
+	indices []int
+	next    int // position in indices
+}
+
+// NewRandomAccess creates a random access workload
+func NewRandomAccess(name string, p Params) *RandomAccess {
+	return &RandomAccess{arrayWorkload: arrayWorkload{name: name, params: p}}
+}
+
+// Setup allocates the array and draws the index stream
+func (r *RandomAccess) Setup() error {
+	if err := r.arrayWorkload.Setup(); err != nil {
+		return err
+	}
+	r.indices = make([]int, min(len(r.data), maxIndexStream))
+	for i := range r.indices {
+		r.indices[i] = rand.Intn(len(r.data))
+	}
+	r.next = 0
+	return nil
+}
+
+// Run reads the given number of random elements
+func (r *RandomAccess) Run(iterations int) {
+	sum := r.sum
+	for iterations > 0 {
+		batch := r.indices[r.next:min(len(r.indices), r.next+iterations)]
+		for _, idx := range batch {
+			sum += r.data[idx]
+		}
+		iterations -= len(batch)
+		r.next = (r.next + len(batch)) % len(r.indices)
+	}
+	r.sum = sum
+}
+
+// Trace reports the loads of Run
+func (r *RandomAccess) Trace(iterations int, load func(offset int)) {
+	for i := 0; i < iterations; i++ {
+		load(r.indices[r.next] * 8)
+		r.next = (r.next + 1) % len(r.indices)
+	}
+}
+
+// Teardown frees the array and the index stream
+func (r *RandomAccess) Teardown() {
+	r.arrayWorkload.Teardown()
+	r.indices = nil
+}
+
+// SequentialAccess reads array elements in ascending order, wrapping around
+// at the end
+type SequentialAccess struct {
+	arrayWorkload
+	next int // index of the next element
+}
+
+// NewSequentialAccess creates a sequential access workload
+func NewSequentialAccess(name string, p Params) *SequentialAccess {
+	return &SequentialAccess{arrayWorkload: arrayWorkload{name: name, params: p}}
+}
+
+// Run reads the given number of consecutive elements, in whole slices of
+// the array so the timed loop needs no modulo
+func (s *SequentialAccess) Run(iterations int) {
+	sum := s.sum
+	for iterations > 0 {
+		batch := s.data[s.next:min(len(s.data), s.next+iterations)]
+		for _, v := range batch {
+			sum += v
+		}
+		iterations -= len(batch)
+		s.next = (s.next + len(batch)) % len(s.data)
+	}
+	s.sum = sum
+}
+
+// Trace reports the loads of Run
+func (s *SequentialAccess) Trace(iterations int, load func(offset int)) {
+	for i := 0; i < iterations; i++ {
+		load(s.next * 8)
+		s.next = (s.next + 1) % len(s.data)
+	}
+}
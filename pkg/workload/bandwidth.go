@@ -0,0 +1,100 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+)
+
+// BandwidthKind selects what a Bandwidth workload does with its buffer
+type BandwidthKind string
+
+const (
+	Read  BandwidthKind = "read"
+	Write BandwidthKind = "write"
+	Copy  BandwidthKind = "copy" // read one buffer and write a second one
+)
+
+// Bandwidth streams sequentially through a buffer; one operation is one
+// pass over the whole buffer
+type Bandwidth struct {
+	name   string
+	params Params
+	kind   BandwidthKind
+
+	data    []int64
+	target  []int64 // copy destination
+	buffers []*alloc.Buffer
+	sum     int64 // keeps the reads from being optimized away
+}
+
+// NewBandwidth creates a bandwidth workload of the given kind
+func NewBandwidth(name string, p Params, kind BandwidthKind) *Bandwidth {
+	return &Bandwidth{name: name, params: p, kind: kind}
+}
+
+// Info describes the bandwidth workload
+func (b *Bandwidth) Info() Info {
+	bytes := b.params.Size / 8 * 8
+	return Info{Name: b.name, Unit: GBs, WorkingSet: bytes, BytesPerOp: bytes}
+}
+
+// Setup allocates the buffer, and the copy destination for Copy, and fills
+// it with sequential values
+func (b *Bandwidth) Setup() error {
+	elements := max(1, b.params.Size/8)
+	data, buffer := alloc.Make[int64](b.params.Alloc, elements)
+	b.data, b.buffers = data, []*alloc.Buffer{buffer}
+	for i := range b.data {
+		b.data[i] = int64(i)
+	}
+	if b.kind == Copy {
+		target, buffer := alloc.Make[int64](b.params.Alloc, elements)
+		b.target, b.buffers = target, append(b.buffers, buffer)
+	}
+	return nil
+}
+
+// Run makes the given number of passes over the buffer
+func (b *Bandwidth) Run(iterations int) {
+	switch b.kind {
+	case Write:
+		for iter := 0; iter < iterations; iter++ {
+			for i := range b.data {
+				b.data[i] = int64(i) + b.sum
+			}
+		}
+	case Copy:
+		for iter := 0; iter < iterations; iter++ {
+			copy(b.target, b.data)
+		}
+	default:
+		sum := b.sum
+		for iter := 0; iter < iterations; iter++ {
+			for i := range b.data {
+				sum += b.data[i]
+			}
+		}
+		b.sum = sum
+	}
+}
+
+// Trace reports the accesses of Run. Stores are reported like loads, and
+// the copy destination follows the source on the next page.
+func (b *Bandwidth) Trace(iterations int, load func(offset int)) {
+	target := (len(b.data)*8 + pageSize - 1) / pageSize * pageSize
+	for iter := 0; iter < iterations; iter++ {
+		for i := range b.data {
+			load(i * 8)
+			if b.kind == Copy {
+				load(target + i*8)
+			}
+		}
+	}
+}
+
+// Teardown frees the buffers
+func (b *Bandwidth) Teardown() {
+	for _, buffer := range b.buffers {
+		buffer.Free()
+	}
+	b.data, b.target, b.buffers = nil, nil, nil
+}
@@ -0,0 +1,57 @@
+package workload
+
+import (
+	"app/pkg/chain"
+	"fmt"
+)
+
+// Strides and stream counts of the registered stride and interleaved chains
+var (
+	ChainStrides = []int{2, 4, 8, 16}
+	ChainStreams = []int{2, 4, 8}
+)
+
+// The built-in workloads that the test suites run
+func init() {
+	registerChain := func(name string, cycle Cycle) {
+		Register(name, func(p Params) Workload { return NewChain(name, p, cycle) })
+	}
+	registerChain("chain/random", chain.Sattolo)
+	registerChain("chain/forward", chain.Sequential)
+	registerChain("chain/backward", chain.Reverse)
+	for _, stride := range ChainStrides {
+		registerChain(fmt.Sprintf("chain/stride-%d", stride), func(n int) []int { return chain.Strided(n, stride) })
+	}
+	for _, streams := range ChainStreams {
+		registerChain(fmt.Sprintf("chain/interleaved-%d", streams), func(n int) []int { return chain.Interleaved(n, streams) })
+	}
+	Register("chain/page-random", func(p Params) Workload {
+		nodesPerPage := pageSize / p.nodeSize()
+		return NewChain("chain/page-random", p, func(n int) []int { return chain.PageRandom(n, nodesPerPage) })
+	})
+	Register("chain/within-page", func(p Params) Workload {
+		nodesPerPage := pageSize / p.nodeSize()
+		return NewChain("chain/within-page", p, func(n int) []int { return chain.WithinPage(n, nodesPerPage) })
+	})
+	Register("chain/page-window", func(p Params) Workload {
+		nodesPerPage := pageSize / p.nodeSize()
+		return NewChain("chain/page-window", p, func(n int) []int { return chain.PageWindow(n, nodesPerPage, tlbWindowPages) })
+	})
+
+	Register("access/random", func(p Params) Workload { return NewRandomAccess("access/random", p) })
+	Register("access/sequential", func(p Params) Workload { return NewSequentialAccess("access/sequential", p) })
+	Register("access/skewed", func(p Params) Workload { return NewSkewed("access/skewed", p, false) })
+	Register("access/skewed-dependent", func(p Params) Workload { return NewSkewed("access/skewed-dependent", p, true) })
+	Register("chain/skewed", func(p Params) Workload { return NewSkewedChain("chain/skewed", p) })
+	Register("pointer-chase", func(p Params) Workload { return NewPointerChase("pointer-chase", p, chain.Sattolo) })
+
+	for _, structure := range LookupStructures {
+		name := "lookup/" + structure
+		Register(name, func(p Params) Workload { return NewLookup(name, p, structure) })
+	}
+
+	for _, kind := range []BandwidthKind{Read, Write, Copy} {
+		name := "bandwidth/" + string(kind)
+		Register(name, func(p Params) Workload { return NewBandwidth(name, p, kind) })
+	}
+}
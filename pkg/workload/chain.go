@@ -0,0 +1,110 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/chain"
+	"fmt"
+)
+
+// pageSize is the page size the page-random cycle assumes
+const pageSize = 4096
+
+// tlbWindowPages is the number of pages the page-window cycle shuffles
+// together, half the 64 entries of a typical first level data TLB
+const tlbWindowPages = 32
+
+// Cycle returns the successor table of a single cycle through all nodes,
+// see package chain
+type Cycle func(nodes int) []int
+
+// Chain links the nodes of an int64 array, NodeSize bytes apart, into the
+// given cycle. Every operation is one dependent load, so the CPU cannot
+// overlap them and the time per operation is the load latency that the
+// order of the cycle allows.
+type Chain struct {
+	name   string
+	params Params
+	cycle  Cycle
+
+	array  []int64
+	buffer *alloc.Buffer
+	next   int64 // index of the next node to load
+}
+
+// NewChain creates a chain workload that links its nodes into cycle
+func NewChain(name string, p Params, cycle Cycle) *Chain {
+	return &Chain{name: name, params: p, cycle: cycle}
+}
+
+// Info describes the chain
+func (c *Chain) Info() Info {
+	nodeSize := c.params.nodeSize()
+	return Info{
+		Name:       c.name,
+		Unit:       NsPerOp,
+		WorkingSet: c.params.Size / nodeSize * nodeSize,
+		BytesPerOp: 8,
+		Dependent:  true,
+	}
+}
+
+// Setup allocates the array and links the nodes
+func (c *Chain) Setup() error {
+	stride := c.params.nodeSize() / 8
+	nodes := c.params.Size / (stride * 8)
+	if nodes < 2 {
+		return fmt.Errorf("working set of %d bytes holds fewer than 2 nodes", c.params.Size)
+	}
+	next, err := buildCycle(c.cycle, nodes, c.params.Verify)
+	if err != nil {
+		return err
+	}
+
+	c.array, c.buffer = alloc.Make[int64](c.params.Alloc, nodes*stride)
+	for i, n := range next {
+		c.array[i*stride] = int64(n * stride)
+	}
+	c.next = 0
+	return nil
+}
+
+// Run follows the chain for the given number of loads
+func (c *Chain) Run(iterations int) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		j = c.array[j]
+	}
+	// Storing the position keeps the loads from being optimized away
+	c.next = j
+}
+
+// Trace reports the loads of Run
+func (c *Chain) Trace(iterations int, load func(offset int)) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		load(int(j) * 8)
+		j = c.array[j]
+	}
+	c.next = j
+}
+
+// Teardown frees the array
+func (c *Chain) Teardown() {
+	c.buffer.Free()
+	c.array = nil
+}
+
+// buildCycle builds the successor table of a cycle and, when verify is
+// set, checks that it is one cycle through all nodes
+func buildCycle(cycle Cycle, nodes int, verify bool) ([]int, error) {
+	next := cycle(nodes)
+	if len(next) != nodes {
+		return nil, fmt.Errorf("cycle has %d of %d nodes", len(next), nodes)
+	}
+	if verify {
+		if err := chain.Validate(next); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
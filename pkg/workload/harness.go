@@ -0,0 +1,303 @@
+package workload
+
+import (
+	"app/pkg/timer"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// overheadWarnFraction is the share of a latency measurement above which
+// the loop and RNG overhead is flagged as dominating it
+const overheadWarnFraction = 0.2
+
+// maxIterations caps the operations the target time calibration picks
+const maxIterations = 1e9
+
+// Options controls how Measure runs a workload
+type Options struct {
+	Warmup      int              // operations run before timing, 0 for none
+	Repetitions int              // timed runs, 1 when 0
+	Overhead    *Overhead        // subtracted from latency results, nil for none
+	Target      time.Duration    // when > 0, iterations grow until one run takes this long
+	Timer       *timer.Timer     // clock the runs are timed with, the monotonic clock when nil
+	Frequency   *timer.Frequency // core frequency latencies are converted to cycles with, nil for none
+}
+
+// Result holds the timed runs of one workload
+type Result struct {
+	Info       Info
+	Iterations int             // operations per timed run
+	Times      []time.Duration // one per repetition
+	OverheadNs float64         // non-memory cost per operation subtracted from NsPerOp
+	CoreHz     float64         // core frequency for CyclesPerOp, 0 when unknown
+}
+
+// Overhead is the cost of the work around the memory accesses of a timed
+// loop. Latency results have it subtracted, so they approach the cost of
+// the loads alone.
+type Overhead struct {
+	LoopNs float64 // one iteration of an empty loop
+	RNGNs  float64 // one rand.Intn call
+}
+
+// MeasureOverhead times an empty loop and rand.Intn with the given timer
+func MeasureOverhead(t *timer.Timer) Overhead {
+	const iterations = 10000000
+	var o Overhead
+
+	start := t.Now()
+	sink := emptyLoop(iterations)
+	o.LoopNs = nsPerOp(t.Since(start), iterations)
+
+	start = t.Now()
+	for i := 0; i < iterations/10; i++ {
+		sink += rand.Intn(iterations)
+	}
+	o.RNGNs = max(0, nsPerOp(t.Since(start), iterations/10)-o.LoopNs)
+
+	if sink == -1 {
+		fmt.Println(sink)
+	}
+	return o
+}
+
+// emptyLoop runs a loop that does nothing but count. It is not inlined so
+// the loop is compiled the same way as a workload's Run loop.
+//
+//go:noinline
+func emptyLoop(iterations int) int {
+	i := 0
+	for ; i < iterations; i++ {
+	}
+	return i
+}
+
+// String summarizes the overhead for reports
+func (o Overhead) String() string {
+	return fmt.Sprintf("loop %.2f ns/iteration, rand.Intn %.2f ns/call", o.LoopNs, o.RNGNs)
+}
+
+// perOp returns the overhead of one operation of a workload. The loop of a
+// dependent workload overlaps its loads, so only its RNG calls count.
+func (o Overhead) perOp(info Info) float64 {
+	rng := float64(info.RNGCalls) * o.RNGNs
+	if info.Dependent {
+		return rng
+	}
+	return o.LoopNs + rng
+}
+
+// Measure sets up the workload, warms it up, times Run the configured
+// number of times and tears it down again. With a target time the given
+// iterations are ignored and calibrated like testing.B instead.
+func Measure(w Workload, iterations int, opts Options) (Result, error) {
+	clock := opts.Timer
+	if clock == nil {
+		clock = timer.NewMonotonic()
+	}
+
+	if err := w.Setup(); err != nil {
+		return Result{}, fmt.Errorf("%s: %w", w.Info().Name, err)
+	}
+	defer w.Teardown()
+
+	// Settle the heap so a collection is unlikely during the timed runs
+	runtime.GC()
+
+	if opts.Warmup > 0 {
+		w.Run(opts.Warmup)
+	}
+	if opts.Target > 0 {
+		iterations = calibrate(w, clock, opts.Target)
+	}
+
+	result := Result{Info: w.Info(), Iterations: iterations}
+	if opts.Overhead != nil && result.Info.Unit == NsPerOp {
+		result.OverheadNs = opts.Overhead.perOp(result.Info)
+	}
+	if opts.Frequency != nil {
+		result.CoreHz = opts.Frequency.Hz
+	}
+	for i := 0; i < max(1, opts.Repetitions); i++ {
+		start := clock.Now()
+		w.Run(iterations)
+		result.Times = append(result.Times, clock.Since(start))
+	}
+	return result, nil
+}
+
+// calibrate grows the number of operations until one run of the workload
+// takes at least target and returns it. Like testing.B it predicts the
+// count from the previous run, adds 20% and grows at most 100x per step.
+func calibrate(w Workload, clock *timer.Timer, target time.Duration) int {
+	n := 1
+	for {
+		start := clock.Now()
+		w.Run(n)
+		elapsed := clock.Since(start)
+		if elapsed >= target || n >= maxIterations {
+			return n
+		}
+
+		prev := n
+		if elapsed > 0 {
+			n = int(float64(prev) * float64(target) / float64(elapsed))
+		} else {
+			n = prev * 100
+		}
+		n += n / 5
+		n = min(n, 100*prev, maxIterations)
+		n = max(n, prev+1)
+	}
+}
+
+// Elapsed returns the median time of the timed runs
+func (r Result) Elapsed() time.Duration {
+	if len(r.Times) == 0 {
+		return 0
+	}
+	times := append([]time.Duration(nil), r.Times...)
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// NsPerOp returns the median time of one operation less the overhead
+func (r Result) NsPerOp() float64 {
+	return max(0, r.RawNsPerOp()-r.OverheadNs)
+}
+
+// RawNsPerOp returns the median time of one operation as measured
+func (r Result) RawNsPerOp() float64 {
+	return nsPerOp(r.Elapsed(), r.Iterations)
+}
+
+// CyclesPerOp returns NsPerOp in core cycles, or 0 when the frequency is
+// unknown or the workload measures bandwidth
+func (r Result) CyclesPerOp() float64 {
+	if r.CoreHz == 0 || r.Info.Unit != NsPerOp {
+		return 0
+	}
+	return r.NsPerOp() * r.CoreHz / 1e9
+}
+
+// Cycles describes the median latency in core cycles, e.g. " (251.3
+// cycles)", and is empty when CyclesPerOp is unknown
+func (r Result) Cycles() string {
+	cycles := r.CyclesPerOp()
+	if cycles == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f cycles)", cycles)
+}
+
+// Warning returns a warning when the subtracted overhead is a large part
+// of the measured time, so the result says more about the loop than about
+// memory, or "" otherwise
+func (r Result) Warning() string {
+	raw := r.RawNsPerOp()
+	if r.OverheadNs == 0 || raw == 0 || r.OverheadNs < overheadWarnFraction*raw {
+		return ""
+	}
+	return fmt.Sprintf("Warning: %s: loop overhead of %.2f ns is %.0f%% of the measured %.2f ns/op",
+		r.Info.Name, r.OverheadNs, 100*r.OverheadNs/raw, raw)
+}
+
+// GBs returns the bandwidth of the median run
+func (r Result) GBs() float64 {
+	return gbs(r.Elapsed(), r.Iterations, r.Info.BytesPerOp)
+}
+
+// Value returns the median result in the workload's unit
+func (r Result) Value() float64 {
+	if r.Info.Unit == GBs {
+		return r.GBs()
+	}
+	return r.NsPerOp()
+}
+
+// Range returns the lowest and highest result of the timed runs in the
+// workload's unit
+func (r Result) Range() (lo, hi float64) {
+	for i, t := range r.Times {
+		v := max(0, nsPerOp(t, r.Iterations)-r.OverheadNs)
+		if r.Info.Unit == GBs {
+			v = gbs(t, r.Iterations, r.Info.BytesPerOp)
+		}
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+	return lo, hi
+}
+
+// Spread describes the range of the timed runs, e.g. " (min 80.1, max 84.0
+// over 5 runs)", and is empty for a single run
+func (r Result) Spread() string {
+	if len(r.Times) < 2 {
+		return ""
+	}
+	lo, hi := r.Range()
+	return fmt.Sprintf(" (min %.2f, max %.2f over %d runs)", lo, hi, len(r.Times))
+}
+
+// String formats the median result with its unit and spread
+func (r Result) String() string {
+	return fmt.Sprintf("%.2f %s%s%s", r.Value(), r.Info.Unit, r.Cycles(), r.Spread())
+}
+
+// Report prints results as a table
+func Report(title string, results []Result) {
+	fmt.Printf("\n==== %s ====\n", title)
+	fmt.Printf("%-28s %12s %12s %12s %12s %12s %10s\n", "Workload", "Working set", "Iterations", "Median", "Min", "Max", "Cycles")
+	fmt.Println(strings.Repeat("-", 104))
+	for _, r := range results {
+		lo, hi := r.Range()
+		cycles := "-"
+		if c := r.CyclesPerOp(); c > 0 {
+			cycles = fmt.Sprintf("%.1f", c)
+		}
+		fmt.Printf("%-28s %12s %12d %12s %12.2f %12.2f %10s\n", r.Info.Name, formatBytes(r.Info.WorkingSet),
+			r.Iterations, fmt.Sprintf("%.2f %s", r.Value(), r.Info.Unit), lo, hi, cycles)
+	}
+	for _, r := range results {
+		if warning := r.Warning(); warning != "" {
+			fmt.Println(warning)
+		}
+	}
+}
+
+// nsPerOp converts a run time to ns per operation
+func nsPerOp(elapsed time.Duration, iterations int) float64 {
+	if iterations == 0 {
+		return 0
+	}
+	return float64(elapsed.Nanoseconds()) / float64(iterations)
+}
+
+// gbs converts a run time to GB/s
+func gbs(elapsed time.Duration, iterations, bytesPerOp int) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(iterations) * float64(bytesPerOp) / elapsed.Seconds() / 1e9
+}
+
+// formatBytes formats a byte count for the report
+func formatBytes(bytes int) string {
+	switch {
+	case bytes >= 1024*1024*1024:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+	case bytes >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	case bytes >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
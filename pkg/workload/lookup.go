@@ -0,0 +1,110 @@
+package workload
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+)
+
+// LookupStream is the most keys a Lookup workload draws in advance; Run
+// cycles through them
+const LookupStream = 1 << 20
+
+// Lookup looks up random keys in a Go data structure of Size/NodeSize
+// elements, as many as a chain over the same Params has nodes. Every key
+// is computed from the value of the previous lookup, which is always equal
+// to its key, so lookups cannot overlap and each costs its full latency,
+// as when a program follows references from one record to the next. The
+// structures live on the Go heap, so Params.Alloc does not apply.
+type Lookup struct {
+	name      string
+	params    Params
+	structure string
+
+	table     lookupTable
+	footprint int     // heap bytes of the table, measured by Setup
+	keys      []int32 // key of every operation
+	next      int     // position in keys
+	sum       int64   // keeps the lookups from being optimized away
+}
+
+// NewLookup creates a lookup workload over a structure of LookupStructures
+func NewLookup(name string, p Params, structure string) *Lookup {
+	return &Lookup{name: name, params: p, structure: structure}
+}
+
+// elements returns the number of elements of the structure
+func (l *Lookup) elements() int {
+	return l.params.Size / l.params.nodeSize()
+}
+
+// Info describes the workload. The working set is the heap the structure
+// takes once Setup has measured it, and an estimate before.
+func (l *Lookup) Info() Info {
+	n := l.elements()
+	info := Info{Name: l.name, Unit: NsPerOp, WorkingSet: l.footprint, Dependent: true}
+	if table := newLookupTable(l.structure); table != nil {
+		info.BytesPerOp = table.lookupBytes(n)
+		if info.WorkingSet == 0 {
+			info.WorkingSet = n * table.entryBytes()
+		}
+	}
+	return info
+}
+
+// Setup builds the structure from the keys 0 to n-1 in random order and
+// draws the lookup keys
+func (l *Lookup) Setup() error {
+	n := l.elements()
+	if n < 1 {
+		return fmt.Errorf("working set of %d bytes holds no elements", l.params.Size)
+	}
+	l.table = newLookupTable(l.structure)
+	if l.table == nil {
+		return fmt.Errorf("unknown data structure %q", l.structure)
+	}
+
+	before := heapInUse()
+	keys := make([]int64, n)
+	for i, key := range rand.Perm(n) {
+		keys[i] = int64(key)
+	}
+	l.table.build(keys)
+	l.footprint = max(0, heapInUse()-before)
+
+	l.keys = make([]int32, min(n*4, LookupStream))
+	for i := range l.keys {
+		l.keys[i] = int32(rand.Intn(n))
+	}
+	l.next = 0
+	return nil
+}
+
+// Run looks up the given number of keys
+func (l *Lookup) Run(iterations int) {
+	sum, table := l.sum, l.table
+	for iterations > 0 {
+		batch := l.keys[l.next:min(len(l.keys), l.next+iterations)]
+		for _, k := range batch {
+			// sum stays zero, but the CPU cannot know before the lookup
+			key := int64(k) + sum
+			sum = table.get(key) - key
+		}
+		iterations -= len(batch)
+		l.next = (l.next + len(batch)) % len(l.keys)
+	}
+	l.sum = sum
+}
+
+// Teardown drops the structure for the garbage collector
+func (l *Lookup) Teardown() {
+	l.table, l.keys = nil, nil
+}
+
+// heapInUse returns the bytes of live heap objects after a collection
+func heapInUse() int {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int(stats.HeapAlloc)
+}
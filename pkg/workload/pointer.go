@@ -0,0 +1,103 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+	"fmt"
+	"unsafe"
+)
+
+// Node represents a node in a linked list for pointer chasing. Its padding
+// makes it one 64-byte cache line.
+type Node struct {
+	Next  *Node
+	Dummy [56]byte // padding to make Node size 64 bytes (cache line size)
+}
+
+// nodeBytes is the size of a Node
+const nodeBytes = 64
+
+// PointerChase follows Next pointers through Nodes spaced NodeSize bytes
+// apart, so every operation is one dependent load through a real pointer
+type PointerChase struct {
+	name   string
+	params Params
+	cycle  Cycle
+
+	nodes   []Node
+	buffer  *alloc.Buffer
+	current *Node
+}
+
+// NewPointerChase creates a pointer chasing workload that links its nodes
+// into cycle
+func NewPointerChase(name string, p Params, cycle Cycle) *PointerChase {
+	return &PointerChase{name: name, params: p, cycle: cycle}
+}
+
+// Info describes the pointer chase
+func (c *PointerChase) Info() Info {
+	return Info{
+		Name:       c.name,
+		Unit:       NsPerOp,
+		WorkingSet: c.count() * c.spacing() * nodeBytes,
+		BytesPerOp: 8,
+		Dependent:  true,
+	}
+}
+
+// spacing returns how many Nodes apart consecutive list nodes are placed
+func (c *PointerChase) spacing() int {
+	return max(1, c.params.nodeSize()/nodeBytes)
+}
+
+// count returns the number of list nodes
+func (c *PointerChase) count() int {
+	return c.params.Size / (c.spacing() * nodeBytes)
+}
+
+// Setup allocates the nodes and links them
+func (c *PointerChase) Setup() error {
+	count, spacing := c.count(), c.spacing()
+	if count < 2 {
+		return fmt.Errorf("working set of %d bytes holds fewer than 2 nodes", c.params.Size)
+	}
+	next, err := buildCycle(c.cycle, count, c.params.Verify)
+	if err != nil {
+		return err
+	}
+
+	c.nodes, c.buffer = alloc.Make[Node](c.params.Alloc, count*spacing)
+	for i, n := range next {
+		c.nodes[i*spacing].Next = &c.nodes[n*spacing]
+	}
+	// Every node is on the cycle, so the walk can start at any of them
+	c.current = &c.nodes[0]
+	return nil
+}
+
+// Run follows the list for the given number of loads
+func (c *PointerChase) Run(iterations int) {
+	node := c.current
+	for i := 0; i < iterations; i++ {
+		node = node.Next
+	}
+	// Storing the position keeps the loads from being optimized away
+	c.current = node
+}
+
+// Trace reports the loads of Run
+func (c *PointerChase) Trace(iterations int, load func(offset int)) {
+	base := uintptr(unsafe.Pointer(&c.nodes[0]))
+	node := c.current
+	for i := 0; i < iterations; i++ {
+		load(int(uintptr(unsafe.Pointer(node)) - base))
+		node = node.Next
+	}
+	c.current = node
+}
+
+// Teardown frees the nodes
+func (c *PointerChase) Teardown() {
+	c.buffer.Free()
+	c.nodes, c.current = nil, nil
+}
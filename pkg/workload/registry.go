@@ -0,0 +1,53 @@
+package workload
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a workload from its parameters
+type Factory func(p Params) Workload
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a workload available under name. It is meant to be called
+// from init functions, so packages outside this repository can add their
+// own workloads, and panics when the name is already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("workload: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("workload: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates the workload registered under name
+func New(name string, p Params) (Workload, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown workload %q", name)
+	}
+	return factory(p), nil
+}
+
+// Names returns the names of all registered workloads, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,131 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/sysmem"
+	"app/pkg/trace"
+	"fmt"
+)
+
+// Record sets the workload up, warms it up like Measure and records the
+// offsets of the loads of iterations operations, keeping at most maxLoads
+// of them. The workload must implement Tracer.
+func Record(w Workload, iterations, warmup, maxLoads int) (*trace.Trace, error) {
+	tracer, ok := w.(Tracer)
+	if !ok {
+		return nil, fmt.Errorf("%s: cannot be recorded, it does not report its loads", w.Info().Name)
+	}
+	if err := w.Setup(); err != nil {
+		return nil, fmt.Errorf("%s: %w", w.Info().Name, err)
+	}
+	defer w.Teardown()
+
+	if warmup > 0 {
+		tracer.Trace(warmup, func(int) {})
+	}
+	var offsets []int
+	tracer.Trace(iterations, func(offset int) {
+		if len(offsets) < maxLoads {
+			offsets = append(offsets, offset)
+		}
+	})
+
+	t := trace.New(w.Info().Name, offsets)
+	t.Size = max(t.Size, w.Info().WorkingSet)
+	return t, nil
+}
+
+// Replay loads the int64s at the offsets of a trace from a buffer of the
+// trace's size, one load per operation, and starts over at the end of the
+// trace. Dependent replays make the address of every load depend on the
+// value of the previous one, which the buffer holds as zero, so the loads
+// cannot overlap and the time per operation is their latency, like a
+// pointer chase. Independent replays let the CPU overlap them.
+type Replay struct {
+	name      string
+	params    Params
+	trace     *trace.Trace
+	dependent bool
+
+	data    []int64
+	buffer  *alloc.Buffer
+	indices []int // int64 index of every load
+	next    int   // position in indices
+	sum     int64 // keeps the loads from being optimized away
+}
+
+// NewReplay creates a replay of t. Params.Size is ignored in favor of the
+// trace's size.
+func NewReplay(t *trace.Trace, p Params, dependent bool) *Replay {
+	mode := "independent"
+	if dependent {
+		mode = "dependent"
+	}
+	return &Replay{name: fmt.Sprintf("replay/%s/%s", t.Name, mode), params: p, trace: t, dependent: dependent}
+}
+
+// Info describes the replay
+func (r *Replay) Info() Info {
+	return Info{Name: r.name, Unit: NsPerOp, WorkingSet: r.trace.Size, BytesPerOp: 8, Dependent: r.dependent}
+}
+
+// Setup allocates the zeroed buffer and converts the offsets to indices.
+// Offsets are rounded down to whole int64s. It fails rather than allocate
+// more than the available memory, see sysmem.Budget.
+func (r *Replay) Setup() error {
+	if len(r.trace.Offsets) == 0 {
+		return fmt.Errorf("trace %s has no loads", r.trace.Name)
+	}
+	if r.trace.Size < 0 || r.trace.Size > trace.MaxSize {
+		return fmt.Errorf("trace %s spans %d bytes, at most %d GB can be replayed", r.trace.Name, r.trace.Size, trace.MaxSize>>30)
+	}
+	// A missing /proc/meminfo leaves the allocation unchecked
+	need := int64(r.trace.Size) + 8*int64(len(r.trace.Offsets))
+	if budget, err := sysmem.ReadBudget(); err == nil && need > budget.Available() {
+		return fmt.Errorf("trace %s needs %d MB for its buffer and indices, but only %d MB is available",
+			r.trace.Name, need>>20, budget.Available()>>20)
+	}
+	r.data, r.buffer = alloc.Make[int64](r.params.Alloc, max(1, (r.trace.Size+7)/8))
+	clear(r.data)
+	r.indices = make([]int, len(r.trace.Offsets))
+	for i, offset := range r.trace.Offsets {
+		r.indices[i] = min(offset/8, len(r.data)-1)
+	}
+	r.next = 0
+	return nil
+}
+
+// Run replays the given number of loads
+func (r *Replay) Run(iterations int) {
+	sum := r.sum
+	for iterations > 0 {
+		batch := r.indices[r.next:min(len(r.indices), r.next+iterations)]
+		if r.dependent {
+			// sum stays zero, but the CPU cannot know before the load
+			for _, idx := range batch {
+				sum = r.data[idx+int(sum)]
+			}
+		} else {
+			for _, idx := range batch {
+				sum += r.data[idx]
+			}
+		}
+		iterations -= len(batch)
+		r.next = (r.next + len(batch)) % len(r.indices)
+	}
+	r.sum = sum
+}
+
+// Trace reports the loads of Run
+func (r *Replay) Trace(iterations int, load func(offset int)) {
+	for i := 0; i < iterations; i++ {
+		load(r.indices[r.next] * 8)
+		r.next = (r.next + 1) % len(r.indices)
+	}
+}
+
+// Teardown frees the buffer and the indices
+func (r *Replay) Teardown() {
+	r.buffer.Free()
+	r.data, r.indices = nil, nil
+}
@@ -0,0 +1,128 @@
+package workload
+
+import (
+	"app/pkg/histogram"
+	"app/pkg/timer"
+	"fmt"
+	"math"
+	"runtime"
+)
+
+// Sampling constants
+const (
+	histogramBits = 5    // HDR sub-bucket bits, for a relative error of 3%
+	emptySamples  = 1000 // empty batches timed to find the sampling overhead
+)
+
+// ReportedPercentiles are the percentiles Distribution.Percentiles returns
+var ReportedPercentiles = []float64{50, 90, 99, 99.9}
+
+// SampleOptions controls how Sample times a workload
+type SampleOptions struct {
+	Warmup    int              // operations run before sampling, 0 for none
+	Batch     int              // operations timed together per sample, 1 when 0
+	Samples   int              // batches timed
+	Timer     *timer.Timer     // clock the batches are timed with, the monotonic clock when nil
+	Frequency *timer.Frequency // core frequency for cycle counts, nil for none
+}
+
+// Distribution is the spread of the time of one operation of a workload,
+// sampled in small batches. Averages hide bimodal latencies, e.g. when
+// only some loads miss the TLB or hit an open DRAM page; percentiles and
+// the histogram show them.
+type Distribution struct {
+	Info       Info
+	Batch      int
+	Samples    int
+	OverheadNs float64              // cost of timing an empty batch, subtracted from every sample
+	CoreHz     float64              // core frequency for cycle counts, 0 when unknown
+	Histogram  *histogram.Histogram // picoseconds per operation
+}
+
+// Percentile is one percentile of a Distribution
+type Percentile struct {
+	P      float64 // e.g. 99.9
+	Ns     float64
+	Cycles float64 // 0 when the core frequency is unknown
+}
+
+// Sample sets the workload up like Measure and times opts.Samples batches
+// of opts.Batch operations, recording the time per operation of every
+// batch. The cheapest of many empty batches is the cost of the timer reads
+// and the call itself, and is subtracted from every batch first.
+func Sample(w Workload, opts SampleOptions) (Distribution, error) {
+	if err := w.Setup(); err != nil {
+		return Distribution{}, fmt.Errorf("%s: %w", w.Info().Name, err)
+	}
+	defer w.Teardown()
+
+	clock := opts.Timer
+	if clock == nil {
+		clock = timer.NewMonotonic()
+	}
+	batch := max(1, opts.Batch)
+
+	runtime.GC()
+	if opts.Warmup > 0 {
+		w.Run(opts.Warmup)
+	}
+
+	overhead := uint64(math.MaxUint64)
+	for i := 0; i < emptySamples; i++ {
+		start := clock.Now()
+		w.Run(0)
+		overhead = min(overhead, clock.Now()-start)
+	}
+
+	d := Distribution{
+		Info:       w.Info(),
+		Batch:      batch,
+		Samples:    opts.Samples,
+		OverheadNs: float64(overhead) * 1e9 / clock.Frequency(),
+		Histogram:  histogram.New(histogramBits),
+	}
+	if opts.Frequency != nil {
+		d.CoreHz = opts.Frequency.Hz
+	}
+
+	psPerTick := 1e12 / clock.Frequency() / float64(batch)
+	for i := 0; i < opts.Samples; i++ {
+		start := clock.Now()
+		w.Run(batch)
+		ticks := clock.Now() - start
+		ticks -= min(ticks, overhead)
+		d.Histogram.Record(uint64(float64(ticks)*psPerTick + 0.5))
+	}
+	return d, nil
+}
+
+// Percentile returns the time of one operation below which p percent of
+// the samples fall
+func (d Distribution) Percentile(p float64) float64 {
+	return float64(d.Histogram.ValueAt(p/100)) / 1000
+}
+
+// Percentiles returns the ReportedPercentiles
+func (d Distribution) Percentiles() []Percentile {
+	percentiles := make([]Percentile, len(ReportedPercentiles))
+	for i, p := range ReportedPercentiles {
+		ns := d.Percentile(p)
+		percentiles[i] = Percentile{P: p, Ns: ns, Cycles: d.Cycles(ns)}
+	}
+	return percentiles
+}
+
+// MaxNs returns the slowest sample's time per operation
+func (d Distribution) MaxNs() float64 {
+	return float64(d.Histogram.Max()) / 1000
+}
+
+// MeanNs returns the average time per operation
+func (d Distribution) MeanNs() float64 {
+	return d.Histogram.Mean() / 1000
+}
+
+// Cycles converts ns to core cycles, 0 when the frequency is unknown
+func (d Distribution) Cycles(ns float64) float64 {
+	return ns * d.CoreHz / 1e9
+}
@@ -0,0 +1,34 @@
+package workload
+
+import (
+	"app/pkg/memsim"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Simulate sets the workload up like Measure and replays the loads of
+// warmup and then of iterations operations on a simulated memory
+// hierarchy instead of timing them. The result holds one run of the
+// simulated time, and the hierarchy's Stats count the timed operations
+// only. The workload must implement Tracer.
+func Simulate(w Workload, iterations, warmup int, h *memsim.Hierarchy) (Result, error) {
+	tracer, ok := w.(Tracer)
+	if !ok {
+		return Result{}, fmt.Errorf("%s: cannot be simulated, it does not report its loads", w.Info().Name)
+	}
+	if err := w.Setup(); err != nil {
+		return Result{}, fmt.Errorf("%s: %w", w.Info().Name, err)
+	}
+	defer w.Teardown()
+
+	load := func(offset int) { h.Load(uint64(offset)) }
+	if warmup > 0 {
+		tracer.Trace(warmup, load)
+	}
+	h.Reset()
+	tracer.Trace(iterations, load)
+
+	elapsed := time.Duration(math.Round(h.Stats().TotalNs))
+	return Result{Info: w.Info(), Iterations: iterations, Times: []time.Duration{elapsed}}, nil
+}
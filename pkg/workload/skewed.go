@@ -0,0 +1,211 @@
+package workload
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/chain"
+	"app/pkg/skew"
+	"fmt"
+)
+
+// SkewedStream is the number of nodes a Skewed workload draws in advance.
+// It is long enough that a warm-up and a timed run of a few million
+// operations do not repeat it, since a repeated stream would find its cold
+// nodes cached from the last pass.
+const SkewedStream = 1 << 22
+
+// Skewed loads nodes NodeSize bytes apart in the order of a stream drawn
+// from Params.Skew, or skew.Default when it has no kind. Dependent walks
+// make the address of every load depend on the value of the previous one,
+// which the buffer holds as zero, so the loads cannot overlap although no
+// node links to the next. Unlike SkewedChain they keep the full popularity
+// of the distribution. Independent walks let the CPU overlap the loads.
+type Skewed struct {
+	name      string
+	params    Params
+	dependent bool
+
+	data   []int64
+	buffer *alloc.Buffer
+	stride int     // int64s between nodes
+	stream []int32 // node of every operation
+	next   int     // position in stream
+	sum    int64   // keeps the loads from being optimized away
+}
+
+// NewSkewed creates a skewed workload
+func NewSkewed(name string, p Params, dependent bool) *Skewed {
+	return &Skewed{name: name, params: p, dependent: dependent}
+}
+
+// Spec returns the distribution the workload draws its nodes from
+func (s *Skewed) Spec() skew.Spec {
+	return s.params.skewSpec()
+}
+
+// Info describes the workload
+func (s *Skewed) Info() Info {
+	nodeSize := s.params.nodeSize()
+	return Info{
+		Name:       s.name,
+		Unit:       NsPerOp,
+		WorkingSet: s.params.Size / nodeSize * nodeSize,
+		BytesPerOp: 8,
+		Dependent:  s.dependent,
+	}
+}
+
+// Setup allocates the zeroed nodes and draws the stream
+func (s *Skewed) Setup() error {
+	s.stride = s.params.nodeSize() / 8
+	nodes := s.params.Size / (s.stride * 8)
+	g, err := newSkewGenerator(s.params, nodes)
+	if err != nil {
+		return err
+	}
+	s.stream = make([]int32, SkewedStream)
+	skew.Fill(g, s.stream)
+
+	s.data, s.buffer = alloc.Make[int64](s.params.Alloc, nodes*s.stride)
+	clear(s.data)
+	s.next = 0
+	return nil
+}
+
+// Run loads the given number of nodes from the stream
+func (s *Skewed) Run(iterations int) {
+	sum, stride := s.sum, s.stride
+	for iterations > 0 {
+		batch := s.stream[s.next:min(len(s.stream), s.next+iterations)]
+		if s.dependent {
+			// sum stays zero, but the CPU cannot know before the load
+			for _, node := range batch {
+				sum = s.data[int(node)*stride+int(sum)]
+			}
+		} else {
+			for _, node := range batch {
+				sum += s.data[int(node)*stride]
+			}
+		}
+		iterations -= len(batch)
+		s.next = (s.next + len(batch)) % len(s.stream)
+	}
+	s.sum = sum
+}
+
+// Trace reports the loads of Run
+func (s *Skewed) Trace(iterations int, load func(offset int)) {
+	for i := 0; i < iterations; i++ {
+		load(int(s.stream[s.next]) * s.stride * 8)
+		s.next = (s.next + 1) % len(s.stream)
+	}
+}
+
+// Teardown frees the nodes and the stream
+func (s *Skewed) Teardown() {
+	s.buffer.Free()
+	s.data, s.stream = nil, nil
+}
+
+// skewSpec returns Params.Skew, or skew.Default when it has no kind
+func (p Params) skewSpec() skew.Spec {
+	if p.Skew.Kind == "" {
+		return skew.Default
+	}
+	return p.Skew
+}
+
+// newSkewGenerator creates a generator of the distribution of p over the
+// given number of nodes
+func newSkewGenerator(p Params, nodes int) (skew.Generator, error) {
+	g, err := skew.New(p.skewSpec(), nodes)
+	if err != nil {
+		return nil, fmt.Errorf("working set of %d bytes: %w", p.Size, err)
+	}
+	return g, nil
+}
+
+// SkewedChain links words of nodes NodeSize bytes apart into a pointer
+// chain that visits the nodes with the popularity of Params.Skew, see
+// chain.Skewed. Every operation is one dependent load of the next word, as
+// in Chain. Since a chain passes each word once per cycle, a node is
+// visited at most NodeSize/8 times per cycle, which flattens strongly
+// skewed distributions such as a small hot set that takes nearly all
+// loads; Skewed keeps their full popularity.
+type SkewedChain struct {
+	name   string
+	params Params
+
+	array  []int64
+	buffer *alloc.Buffer
+	next   int64 // index of the next word to load
+}
+
+// NewSkewedChain creates a skewed chain workload
+func NewSkewedChain(name string, p Params) *SkewedChain {
+	return &SkewedChain{name: name, params: p}
+}
+
+// Spec returns the distribution the workload draws its nodes from
+func (c *SkewedChain) Spec() skew.Spec {
+	return c.params.skewSpec()
+}
+
+// Info describes the chain
+func (c *SkewedChain) Info() Info {
+	nodeSize := c.params.nodeSize()
+	return Info{
+		Name:       c.name,
+		Unit:       NsPerOp,
+		WorkingSet: c.params.Size / nodeSize * nodeSize,
+		BytesPerOp: 8,
+		Dependent:  true,
+	}
+}
+
+// Setup allocates the array and links a walk of up to SkewedStream loads,
+// long enough that a repeated cycle does not find its cold nodes cached
+func (c *SkewedChain) Setup() error {
+	stride := c.params.nodeSize() / 8
+	nodes := c.params.Size / (stride * 8)
+	g, err := newSkewGenerator(c.params, nodes)
+	if err != nil {
+		return err
+	}
+	order := chain.Skewed(nodes, stride, SkewedStream, g.Next)
+	if len(order) < 2 {
+		return fmt.Errorf("%s links fewer than 2 loads", c.Spec())
+	}
+
+	c.array, c.buffer = alloc.Make[int64](c.params.Alloc, nodes*stride)
+	clear(c.array)
+	for i, word := range order {
+		c.array[word] = int64(order[(i+1)%len(order)])
+	}
+	c.next = int64(order[0])
+	return nil
+}
+
+// Run follows the chain for the given number of loads
+func (c *SkewedChain) Run(iterations int) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		j = c.array[j]
+	}
+	c.next = j
+}
+
+// Trace reports the loads of Run
+func (c *SkewedChain) Trace(iterations int, load func(offset int)) {
+	j := c.next
+	for i := 0; i < iterations; i++ {
+		load(int(j) * 8)
+		j = c.array[j]
+	}
+	c.next = j
+}
+
+// Teardown frees the array
+func (c *SkewedChain) Teardown() {
+	c.buffer.Free()
+	c.array = nil
+}
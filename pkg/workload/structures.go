@@ -0,0 +1,279 @@
+package workload
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// LookupStructures are the data structures of the registered lookup
+// workloads, "lookup/<structure>"
+var LookupStructures = []string{"map", "sorted-slice", "binary-tree", "btree", "linked-list"}
+
+// lookupTable is a Go data structure that maps int64 keys to values. Every
+// key is stored with itself as its value.
+type lookupTable interface {
+	// build inserts the keys, a permutation of 0 to n-1, in the given
+	// order, which the tables that allocate a node per key also allocate
+	// them in
+	build(keys []int64)
+	// get returns the value of key, -1 when it is missing
+	get(key int64) int64
+	// entryBytes estimates the memory of one element
+	entryBytes() int
+	// lookupBytes estimates the bytes one lookup reads among n elements
+	lookupBytes(n int) int
+}
+
+// newLookupTable creates an empty table of a structure of LookupStructures
+func newLookupTable(structure string) lookupTable {
+	switch structure {
+	case "map":
+		return &mapTable{}
+	case "sorted-slice":
+		return &sortedSlice{}
+	case "binary-tree":
+		return &binaryTree{}
+	case "btree":
+		return &bTree{}
+	case "linked-list":
+		return &linkedList{}
+	}
+	return nil
+}
+
+// entry is a key with its value
+type entry struct {
+	key, value int64
+}
+
+// depth returns the number of levels of a balanced tree of n elements with
+// the given fan-out
+func depth(n, fanout int) int {
+	levels := 1
+	for capacity := fanout; capacity < n; capacity *= fanout {
+		levels++
+	}
+	return levels
+}
+
+// mapTable is the built-in map
+type mapTable struct {
+	m map[int64]int64
+}
+
+func (t *mapTable) build(keys []int64) {
+	t.m = make(map[int64]int64, len(keys))
+	for _, key := range keys {
+		t.m[key] = key
+	}
+}
+
+func (t *mapTable) get(key int64) int64 {
+	if value, ok := t.m[key]; ok {
+		return value
+	}
+	return -1
+}
+
+// entryBytes is the slot with its control byte, at the load factor halfway
+// between two growths
+func (t *mapTable) entryBytes() int { return 24 }
+
+// lookupBytes is the control word and the slot of the key
+func (t *mapTable) lookupBytes(n int) int { return 24 }
+
+// sortedSlice is a slice sorted by key and searched with sort.Search
+type sortedSlice struct {
+	entries []entry
+}
+
+func (t *sortedSlice) build(keys []int64) {
+	t.entries = make([]entry, len(keys))
+	for i, key := range keys {
+		t.entries[i] = entry{key, key}
+	}
+	sort.Slice(t.entries, func(i, j int) bool { return t.entries[i].key < t.entries[j].key })
+}
+
+func (t *sortedSlice) get(key int64) int64 {
+	i := sort.Search(len(t.entries), func(i int) bool { return t.entries[i].key >= key })
+	if i < len(t.entries) && t.entries[i].key == key {
+		return t.entries[i].value
+	}
+	return -1
+}
+
+func (t *sortedSlice) entryBytes() int { return 16 }
+
+func (t *sortedSlice) lookupBytes(n int) int { return 16 * (bits.Len(uint(n)) + 1) }
+
+// treeNode is a node of binaryTree
+type treeNode struct {
+	key, value  int64
+	left, right *treeNode
+}
+
+// binaryTree is a balanced binary search tree of individually allocated
+// nodes. The nodes are allocated in insertion order, so their addresses
+// follow the order keys arrived in, not the tree's.
+type binaryTree struct {
+	root *treeNode
+}
+
+func (t *binaryTree) build(keys []int64) {
+	nodes := make([]*treeNode, len(keys))
+	for _, key := range keys {
+		nodes[key] = &treeNode{key: key, value: key}
+	}
+	var link func(nodes []*treeNode) *treeNode
+	link = func(nodes []*treeNode) *treeNode {
+		if len(nodes) == 0 {
+			return nil
+		}
+		mid := len(nodes) / 2
+		node := nodes[mid]
+		node.left, node.right = link(nodes[:mid]), link(nodes[mid+1:])
+		return node
+	}
+	t.root = link(nodes)
+}
+
+func (t *binaryTree) get(key int64) int64 {
+	node := t.root
+	for node != nil {
+		switch {
+		case key < node.key:
+			node = node.left
+		case key > node.key:
+			node = node.right
+		default:
+			return node.value
+		}
+	}
+	return -1
+}
+
+func (t *binaryTree) entryBytes() int { return 32 }
+
+func (t *binaryTree) lookupBytes(n int) int { return 32 * bits.Len(uint(n)) }
+
+// bTreeKeys is the number of keys of a B-tree node, which makes a node
+// four 64-byte lines
+const bTreeKeys = 15
+
+// bTreeNode is a node of bTree. Leaves hold entries, inner nodes hold
+// separators: child i has the keys from keys[i-1] up to below keys[i].
+type bTreeNode struct {
+	count int32 // keys in use
+	leaf  bool
+	keys  [bTreeKeys]int64
+	refs  [bTreeKeys + 1]int64 // values of a leaf, node indices of an inner node
+}
+
+// bTree is a B+tree whose nodes are elements of one slice, linked by index
+// instead of pointers. It is bulk loaded with full nodes, like a read-only
+// index, and nodes are scanned linearly.
+type bTree struct {
+	nodes []bTreeNode
+	root  int
+}
+
+func (t *bTree) build(keys []int64) {
+	sorted := append([]int64(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Leaves first, then every level of inner nodes up to the root, with
+	// the smallest key below each node as its separator in the parent.
+	// Inner nodes add at most a fifteenth to the leaves.
+	leaves := (len(sorted) + bTreeKeys - 1) / bTreeKeys
+	t.nodes = make([]bTreeNode, 0, leaves+leaves/bTreeKeys+depth(len(sorted), bTreeKeys))
+	var level, first []int64
+	for start := 0; start < len(sorted); start += bTreeKeys {
+		node := bTreeNode{leaf: true}
+		for i, key := range sorted[start:min(len(sorted), start+bTreeKeys)] {
+			node.keys[i], node.refs[i] = key, key
+			node.count++
+		}
+		level = append(level, int64(len(t.nodes)))
+		first = append(first, node.keys[0])
+		t.nodes = append(t.nodes, node)
+	}
+	for len(level) > 1 {
+		var parents, parentFirst []int64
+		for start := 0; start < len(level); start += bTreeKeys + 1 {
+			children := level[start:min(len(level), start+bTreeKeys+1)]
+			node := bTreeNode{count: int32(len(children) - 1)}
+			copy(node.refs[:], children)
+			copy(node.keys[:], first[start+1:start+len(children)])
+			parents = append(parents, int64(len(t.nodes)))
+			parentFirst = append(parentFirst, first[start])
+			t.nodes = append(t.nodes, node)
+		}
+		level, first = parents, parentFirst
+	}
+	if len(level) == 1 {
+		t.root = int(level[0])
+	}
+}
+
+func (t *bTree) get(key int64) int64 {
+	if len(t.nodes) == 0 {
+		return -1
+	}
+	node := &t.nodes[t.root]
+	for !node.leaf {
+		i := 0
+		for i < int(node.count) && node.keys[i] <= key {
+			i++
+		}
+		node = &t.nodes[node.refs[i]]
+	}
+	for i := 0; i < int(node.count); i++ {
+		if node.keys[i] == key {
+			return node.refs[i]
+		}
+	}
+	return -1
+}
+
+func (t *bTree) entryBytes() int { return 256 / bTreeKeys }
+
+// lookupBytes is half a node's keys at every level
+func (t *bTree) lookupBytes(n int) int { return 64 * depth(n, bTreeKeys) }
+
+// listNode is a node of linkedList
+type listNode struct {
+	key, value int64
+	next       *listNode
+}
+
+// linkedList is a singly linked list in key order, searched from its head.
+// The nodes are allocated in insertion order like those of binaryTree.
+type linkedList struct {
+	head *listNode
+}
+
+func (t *linkedList) build(keys []int64) {
+	nodes := make([]*listNode, len(keys))
+	for _, key := range keys {
+		nodes[key] = &listNode{key: key, value: key}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		nodes[i].next = t.head
+		t.head = nodes[i]
+	}
+}
+
+func (t *linkedList) get(key int64) int64 {
+	for node := t.head; node != nil; node = node.next {
+		if node.key == key {
+			return node.value
+		}
+	}
+	return -1
+}
+
+func (t *linkedList) entryBytes() int { return 24 }
+
+// lookupBytes is the nodes before the key, half the list on average
+func (t *linkedList) lookupBytes(n int) int { return 24 * max(1, n/2) }
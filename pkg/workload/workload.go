@@ -0,0 +1,71 @@
+// Package workload defines the memory access patterns the test suites
+// measure as pluggable workloads, a registry to create them by name and a
+// harness that warms them up, times them and reports the results
+package workload
+
+import (
+	"app/pkg/alloc"
+	"app/pkg/skew"
+)
+
+// Unit is the unit a workload's result is reported in
+type Unit string
+
+const (
+	NsPerOp Unit = "ns/op" // average time of one operation, for latency workloads
+	GBs     Unit = "GB/s"  // bytes moved per second, for bandwidth workloads
+)
+
+// defaultNodeSize is the node spacing used when Params.NodeSize is 0
+const defaultNodeSize = 64
+
+// Info describes a workload
+type Info struct {
+	Name       string // registry name, e.g. "chain/random"
+	Unit       Unit
+	WorkingSet int // bytes the operations walk over
+	BytesPerOp int // bytes read or written by one operation
+	RNGCalls   int // random numbers drawn per operation inside Run, subtracted as overhead
+
+	// Dependent is set when every operation needs the result of the one
+	// before it. The loop then runs while the load is outstanding, so its
+	// cost is hidden in the latency and not subtracted.
+	Dependent bool
+}
+
+// Workload is one memory access pattern. Setup allocates and prepares its
+// memory, Run performs the given number of operations and Teardown releases
+// the memory again. Only Run is timed, and it may be called several times
+// between Setup and Teardown.
+type Workload interface {
+	Info() Info
+	Setup() error
+	Run(iterations int)
+	Teardown()
+}
+
+// Tracer is implemented by workloads whose loads can be replayed on a
+// simulated memory hierarchy, see Simulate. Trace reports the byte offset
+// of every load that Run(iterations) would make, in the same order, and
+// advances the workload as Run would. Offsets count from the start of the
+// workload's first buffer; further buffers follow on the next page.
+type Tracer interface {
+	Trace(iterations int, load func(offset int))
+}
+
+// Params configures a workload created from the registry
+type Params struct {
+	Size     int            // working set in bytes
+	NodeSize int            // bytes between the nodes of linked workloads, 0 for 64
+	Alloc    alloc.Strategy // how the workload's buffers are allocated
+	Verify   bool           // check that linked workloads form one cycle, slow for large sizes
+	Skew     skew.Spec      // distribution of the skewed workloads, skew.Default when it has no kind
+}
+
+// nodeSize returns the node spacing in bytes, at least one int64
+func (p Params) nodeSize() int {
+	if p.NodeSize <= 0 {
+		return defaultNodeSize
+	}
+	return max(8, p.NodeSize)
+}
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"app/pkg/alloc"
+	"app/pkg/selector"
+	"app/pkg/sysmem"
 	"app/pkg/test1"
+	"app/pkg/timer"
 	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes of the stress test
+const (
+	exitCorruption = 2 // data read back differently than written
+	exitECCErrors  = 3 // no corruption, but ECC error counters increased
 )
 
 func main() {
@@ -12,6 +24,11 @@ func main() {
 	// Parse command-line flags
 	flag.IntVar(&config.ArraySize, "size", config.ArraySize, "Size of array to allocate (in elements)")
 	flag.IntVar(&config.Iterations, "iter", config.Iterations, "Number of iterations for memory access test")
+	flag.IntVar(&config.Repetitions, "reps", config.Repetitions, "Timed runs per measurement, the median is reported")
+	flag.DurationVar(&config.TargetTime, "target", config.TargetTime, "Grow iterations until each timed run takes this long (e.g. 100ms) instead of using -iter")
+	flag.Var(&config.Timer, "timer", "Clock measurements are timed with: "+timer.KindNames())
+	flag.StringVar(&config.FrequencySource, "freq", config.FrequencySource, "How the core frequency for cycle counts is found: measured or sysfs")
+	flag.BoolVar(&config.VerifyChains, "verify-chains", config.VerifyChains, "Check every pointer chain is one cycle through all its nodes before timing it")
 	flag.IntVar(&config.Threads, "threads", config.Threads, "Number of threads to use for multi-threaded test")
 	flag.BoolVar(&config.Verbose, "verbose", config.Verbose, "Enable verbose output")
 	flag.BoolVar(&config.SkipLargeTests, "skip-large", config.SkipLargeTests, "Skip large memory tests")
@@ -19,11 +36,65 @@ func main() {
 	flag.BoolVar(&config.TestSequential, "test-seq", config.TestSequential, "Run sequential vs random access test")
 	flag.BoolVar(&config.TestThreaded, "test-threaded", config.TestThreaded, "Run multi-threaded test")
 	flag.BoolVar(&config.TestDetailedSizes, "test-sizes", config.TestDetailedSizes, "Run detailed size tests")
+	flag.BoolVar(&config.TestStructures, "test-structures", config.TestStructures, "Run data structure lookup tests at the detailed sizes' element counts")
+	flag.BoolVar(&config.TestPageFaults, "test-faults", config.TestPageFaults, "Run page fault / first-touch test")
+	flag.Var(&config.Alloc, "alloc", "Buffer allocation strategy: "+alloc.StrategyNames())
+	flag.StringVar(&config.OnLowMemory, "on-low-memory", config.OnLowMemory, "What to do when the tests need more memory than available: refuse, scale or warn")
+	flag.DurationVar(&config.StressDuration, "stress", config.StressDuration, "Run the stress test for this long (e.g. 24h) instead of the benchmarks")
+	flag.DurationVar(&config.StressInterval, "stress-interval", config.StressInterval, "Time between stress test health snapshots, 0 for none")
+	run := flag.String("run", "", "Run only tests whose names match this regular expression, split on / per level")
+	skip := flag.String("skip", "", "Skip tests whose names match this regular expression, split on / per level")
+	list := flag.Bool("list", false, "List the names of the tests that would run, then exit")
+	dryRun := flag.Bool("dry-run", false, "Print the tests that would run with their memory and estimated time, then exit")
 	flag.Parse()
 
+	if err := sysmem.ValidateLowMemory(config.OnLowMemory); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	filter, err := selector.New(*run, *skip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	config.Filter = filter
+
 	// Create tester with the configured settings
 	tester := test1.NewMemTester(config)
 
+	// Only list the selected tests when requested
+	if *list {
+		for _, name := range tester.TestNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	// Check the tests fit in memory before allocating anything
+	if err := tester.CheckMemory(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// Only show what would run when requested
+	if *dryRun {
+		tester.DryRun()
+		return
+	}
+
+	// Burn in memory when requested
+	if config.StressDuration > 0 {
+		result := tester.RunStressTest(config.StressDuration)
+		if result.Errors > 0 {
+			os.Exit(exitCorruption)
+		}
+		if len(result.ECC) > 0 {
+			os.Exit(exitECCErrors)
+		}
+		return
+	}
+
 	// Run all tests
 	tester.RunAll()
 }
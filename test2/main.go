@@ -1,9 +1,16 @@
 package main
 
 import (
+	"app/pkg/alloc"
+	"app/pkg/memsim"
+	"app/pkg/selector"
+	"app/pkg/skew"
+	"app/pkg/sysmem"
 	"app/pkg/test2"
+	"app/pkg/timer"
 	"flag"
 	"fmt"
+	"os"
 )
 
 func main() {
@@ -13,9 +20,34 @@ func main() {
 	// Define command line flags
 	flag.IntVar(&config.SizeInMB, "size", config.SizeInMB, "Size of memory to test in MB")
 	flag.IntVar(&config.Iterations, "iter", config.Iterations, "Number of iterations for memory tests")
+	flag.IntVar(&config.Repetitions, "reps", config.Repetitions, "Timed runs per measurement, the median is reported")
+	flag.DurationVar(&config.TargetTime, "target", config.TargetTime, "Grow iterations until each timed run takes this long (e.g. 100ms) instead of using -iter")
+	flag.Var(&config.Timer, "timer", "Clock measurements are timed with: "+timer.KindNames())
+	flag.StringVar(&config.FrequencySource, "freq", config.FrequencySource, "How the core frequency for cycle counts is found: measured or sysfs")
+	flag.BoolVar(&config.VerifyChains, "verify-chains", config.VerifyChains, "Check every pointer chain is one cycle through all its nodes before timing it")
+	flag.Var(&config.Alloc, "alloc", "Buffer allocation strategy: "+alloc.StrategyNames())
+	flag.IntVar(&config.LineSize, "line-size", config.LineSize, "Cache line size in bytes (0 to detect)")
+	flag.IntVar(&config.CacheMaxMB, "cache-max", config.CacheMaxMB, "Largest working set in MB of the cache size detection")
+	flag.StringVar(&config.OnLowMemory, "on-low-memory", config.OnLowMemory, "What to do when the tests need more memory than available: refuse, scale or warn")
+	simulate := flag.String("simulate", "", "Run the detection tests on a simulated CPU: "+memsim.PresetNames()+" or a spec")
 	runBasicPtr := flag.Bool("basic", true, "Run basic memory tests")
-	runAdvancedPtr := flag.Bool("advanced", true, "Run advanced memory tests")
+	runAdvancedPtr := flag.Bool("advanced", true, "Run the advanced latency test, random within each page to avoid TLB misses")
 	runCachePtr := flag.Bool("cache", true, "Run cache detection and testing")
+	runPrefetchPtr := flag.Bool("prefetch", true, "Run hardware prefetcher analysis")
+	runRuntimePtr := flag.Bool("runtime", false, "Run Go allocator and GC tests")
+	flag.BoolVar(&config.RunDistribution, "distribution", config.RunDistribution, "Sample per-load latencies of a pointer chase into a histogram")
+	flag.IntVar(&config.SampleBatch, "batch", config.SampleBatch, "Dependent loads timed together per latency distribution sample")
+	flag.BoolVar(&config.RunSkew, "skew", config.RunSkew, "Compare latencies of skewed access distributions with uniform loads")
+	skewPatterns := flag.String("skew-patterns", "", "Comma separated distributions -skew compares, e.g. uniform,zipf:0.99,hotcold:0.1:0.9,gaussian:1024:1")
+	flag.BoolVar(&config.RunWorkloads, "workloads", config.RunWorkloads, "Run every registered workload over the -size buffer")
+	runAssocPtr := flag.Bool("assoc", false, "Run cache associativity detection (requires -cache)")
+	record := flag.String("record", "", "Record the loads of the -record-workload to this trace file, then exit")
+	recordWorkload := flag.String("record-workload", "pointer-chase", "Registered workload whose loads -record saves")
+	replay := flag.String("replay", "", "Time the loads of this binary or text trace file, then exit")
+	run := flag.String("run", "", "Run only tests whose names match this regular expression, split on / per level")
+	skip := flag.String("skip", "", "Skip tests whose names match this regular expression, split on / per level")
+	list := flag.Bool("list", false, "List the names of the tests that would run, then exit")
+	dryRun := flag.Bool("dry-run", false, "Print the tests that would run with their memory and estimated time, then exit")
 	showHelp := flag.Bool("help", false, "Show help")
 
 	// Parse command line arguments
@@ -25,6 +57,9 @@ func main() {
 	config.RunBasicTests = *runBasicPtr
 	config.RunAdvanced = *runAdvancedPtr
 	config.RunCacheTests = *runCachePtr
+	config.RunAssocTest = *runAssocPtr
+	config.RunPrefetch = *runPrefetchPtr
+	config.RunRuntime = *runRuntimePtr
 
 	// Show help if requested
 	if *showHelp {
@@ -32,9 +67,73 @@ func main() {
 		return
 	}
 
+	if err := sysmem.ValidateLowMemory(config.OnLowMemory); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if *simulate != "" {
+		sim, err := memsim.Parse(*simulate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		config.Simulate = &sim
+	}
+
+	if *skewPatterns != "" {
+		specs, err := skew.ParseList(*skewPatterns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		config.SkewPatterns = specs
+	}
+
+	filter, err := selector.New(*run, *skip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	config.Filter = filter
+
 	// Create tester with the configured settings
 	tester := test2.NewMemTester(config)
 
+	// Only record or replay a trace when requested
+	if *record != "" || *replay != "" {
+		if *record != "" {
+			err = tester.RecordTrace(*recordWorkload, *record)
+		} else {
+			err = tester.ReplayTrace(*replay)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Only list the selected tests when requested
+	if *list {
+		for _, name := range tester.TestNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	// Check the tests fit in memory before allocating anything
+	if err := tester.CheckMemory(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// Only show what would run when requested
+	if *dryRun {
+		tester.DryRun()
+		return
+	}
+
 	// Run all tests
 	tester.RunAll()
 }
@@ -47,11 +146,40 @@ func printHelp() {
 	fmt.Println("\nOptions:")
 	fmt.Println("  -size=N      Size of memory to test in MB (default: 256)")
 	fmt.Println("  -iter=N      Number of iterations for tests (default: 1,000,000)")
+	fmt.Println("  -reps=N      Timed runs per measurement, the median is reported (default: 1)")
+	fmt.Println("  -target=D    Grow iterations until each timed run takes D, e.g. 100ms (default: 0, use -iter)")
+	fmt.Println("  -timer=S     Clock measurements are timed with: " + timer.KindNames() + " (default: auto)")
+	fmt.Println("  -freq=S      Core frequency for cycle counts: measured or sysfs (default: measured)")
+	fmt.Println("  -verify-chains Check every pointer chain is one cycle before timing it (default: false)")
+	fmt.Println("  -line-size=N Cache line size in bytes, 0 to detect (default: 0)")
+	fmt.Println("  -cache-max=N Largest working set in MB of the cache size detection (default: 256)")
+	fmt.Println("  -on-low-memory=S What to do when the tests need more memory than available: refuse, scale or warn (default: scale)")
+	fmt.Println("  -simulate=S  Run the detection tests on a simulated CPU: " + memsim.PresetNames() + " or a spec")
+	fmt.Println("  -alloc=S     Buffer allocation strategy: " + alloc.StrategyNames() + " (default: heap)")
 	fmt.Println("  -basic       Run basic memory tests (default: true)")
-	fmt.Println("  -advanced    Run advanced latency tests (default: true)")
+	fmt.Println("  -advanced    Run the advanced latency test without TLB misses (default: true)")
 	fmt.Println("  -cache       Run cache detection and testing (default: true)")
+	fmt.Println("  -prefetch    Run hardware prefetcher analysis (default: true)")
+	fmt.Println("  -assoc       Run cache associativity detection (default: false)")
+	fmt.Println("  -runtime     Run Go allocator and GC tests (default: false)")
+	fmt.Println("  -distribution Sample per-load latencies into a histogram with percentiles (default: false)")
+	fmt.Println("  -batch=N     Dependent loads timed together per distribution sample (default: 8)")
+	fmt.Println("  -skew        Compare skewed access distributions with uniform loads (default: false)")
+	fmt.Println("  -skew-patterns=S Distributions -skew compares: uniform, zipf:S, hotcold:FRACTION:PROB, gaussian:SIGMA:STEP")
+	fmt.Println("  -workloads   Run every registered workload over the -size buffer (default: false)")
+	fmt.Println("  -record=FILE Record the loads of -record-workload to a trace file (.txt for text), then exit")
+	fmt.Println("  -record-workload=S Registered workload -record saves (default: pointer-chase)")
+	fmt.Println("  -replay=FILE Time the loads of a binary or text trace file, then exit")
+	fmt.Println("  -run=RE      Run only tests whose names match, e.g. cache/L2 or prefetch/stride")
+	fmt.Println("  -skip=RE     Skip tests whose names match, e.g. cache/memory")
+	fmt.Println("  -list        List the names of the tests that would run, then exit")
+	fmt.Println("  -dry-run     Print the tests that would run with estimated time, then exit")
 	fmt.Println("  -help        Show this help message")
 	fmt.Println("\nExamples:")
 	fmt.Println("  gomemtest -size=512")
 	fmt.Println("  gomemtest -cache=false -basic=true -advanced=false")
+	fmt.Println("  gomemtest -run 'cache/L[12]/latency'")
+	fmt.Println("  gomemtest -simulate=skylake,L3=16M/16/12 -workloads")
+	fmt.Println("  gomemtest -skew -skew-patterns=uniform,zipf:0.99,hotcold:0.01:0.99")
+	fmt.Println("  gomemtest -record=chase.trace -size=64 && gomemtest -replay=chase.trace")
 }